@@ -1,12 +1,19 @@
 #!/bin/bash
 
 PORT="50000"
+# 第一個參數是服務名稱 (KEEPALIVED.INSTANCES 的 SERVICE) 沒有帶就檢查交管
+SERVICE="$1"
+
+URL="http://localhost:$PORT/health"
+if [ -n "$SERVICE" ]; then
+    URL="$URL/service/$SERVICE"
+fi
 
 # 使用 curl 檢查
 # -s: 靜音模式 (Silent)
 # -f: 如果 HTTP 狀態碼 >= 400，curl 會回傳非 0 的結束碼 (Fail silently)
 # -o /dev/null: 把輸出的內容丟掉，我們只需要知道「成功還是失敗」
-curl -sf http://localhost:$PORT/health -o /dev/null
+curl -sf "$URL" -o /dev/null
 
 # $? 會抓取上一個指令 (curl) 的執行結果
 # 0 代表成功 (HTTP 200)
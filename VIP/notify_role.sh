@@ -1,9 +1,36 @@
 #!/bin/bash
 
-ROLE=$1
+# keepalived.conf 的 notify 會帶 TYPE NAME STATE PRIORITY (ha_arbiter keepalived render 產生的)
+# 例如 INSTANCE VI_1 MASTER 100
+# 舊版的 notify_master "notify_role.sh MASTER VI_1" 也可以用
+if [ "$1" = "INSTANCE" ] || [ "$1" = "GROUP" ]; then
+    TYPE=$1
+    NAME=$2
+    STATE=$3
+    PRIORITY=$4
+else
+    TYPE="INSTANCE"
+    NAME=$2
+    STATE=$1
+    PRIORITY=""
+fi
 PORT=50000
+# 跟 config.yaml 的 API_AUTH.UNIX_SOCKET 一樣 從 socket 來的請求不用 token
+SOCKET="/run/ha_arbiter/api.sock"
+# 沒有 socket 時用 TCP 需要 operator token
+TOKEN="${HA_API_TOKEN:-}"
+QUERY="type=${TYPE}&name=${NAME}&state=${STATE}&priority=${PRIORITY}"
 
-
-curl -X POST "http://localhost:${PORT}/role_change?role=${ROLE}" \
-     -H "Content-Type: application/json" \
-     --max-time 2
\ No newline at end of file
+# 失敗時重試 仲裁程式也會定時用網卡上的 VIP 校正 不會一直錯下去
+for i in 1 2 3; do
+    if [ -S "$SOCKET" ]; then
+        curl -sf -X POST --unix-socket "$SOCKET" "http://localhost/keepalived/notify?${QUERY}" \
+             --max-time 2 && exit 0
+    else
+        curl -sf -X POST "http://localhost:${PORT}/keepalived/notify?${QUERY}" \
+             -H "Authorization: Bearer ${TOKEN}" \
+             --max-time 2 && exit 0
+    fi
+    sleep 1
+done
+exit 1
@@ -0,0 +1,109 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+// 在 stream metadata 帶上自己的節點名稱
+const NodeIDMetadataKey = "x-ha-node-id"
+
+// PeerAdmission 決定哪些連線可以送資料進來
+// 節點名稱一定要等於 NodeID 來源位址一定要在 AllowedNets 裡
+type PeerAdmission struct {
+	NodeID      string
+	AllowedNets []*net.IPNet
+}
+
+// allowed 可以是 IP 或 CIDR 兩個都不能空白 不然誰都可以連進來
+func NewPeerAdmission(nodeID string, allowed []string) (PeerAdmission, error) {
+	admission := PeerAdmission{NodeID: nodeID}
+	if nodeID == "" {
+		return admission, errors.New("沒有設定另外一台的節點名稱")
+	}
+	if len(allowed) == 0 {
+		return admission, errors.New("沒有允許的來源位址")
+	}
+
+	for _, a := range allowed {
+		if !strings.Contains(a, "/") {
+			ip := net.ParseIP(a)
+			if ip == nil {
+				return admission, fmt.Errorf("無效的來源位址: %q", a)
+			}
+			bits := 32
+			if ip.To4() == nil {
+				bits = 128
+			}
+			a = fmt.Sprintf("%s/%d", ip, bits)
+		}
+
+		_, ipnet, err := net.ParseCIDR(a)
+		if err != nil {
+			return admission, fmt.Errorf("無效的來源位址: %q", a)
+		}
+		admission.AllowedNets = append(admission.AllowedNets, ipnet)
+	}
+
+	return admission, nil
+}
+
+// 連線進來的對方資訊
+type peerIdentity struct {
+	NodeID    string
+	Remote    string
+	CertNames []string
+}
+
+func identityFromContext(ctx context.Context) peerIdentity {
+	var id peerIdentity
+
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(NodeIDMetadataKey); len(values) > 0 {
+			id.NodeID = values[0]
+		}
+	}
+
+	if p, ok := peer.FromContext(ctx); ok {
+		id.Remote = p.Addr.String()
+		if tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo); ok && len(tlsInfo.State.PeerCertificates) > 0 {
+			id.CertNames = CertificateNames(tlsInfo.State.PeerCertificates[0])
+		}
+	}
+
+	return id
+}
+
+// 檢查來源位址以及節點名稱 憑證名稱已經在 TLS handshake 時依照 PEER_NAMES 檢查過
+func (a PeerAdmission) check(id peerIdentity) error {
+	host, _, err := net.SplitHostPort(id.Remote)
+	if err != nil {
+		host = id.Remote
+	}
+	ip := net.ParseIP(host)
+
+	allowed := false
+	for _, ipnet := range a.AllowedNets {
+		if ip != nil && ipnet.Contains(ip) {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		return fmt.Errorf("來源位址 %s 不在允許清單中", id.Remote)
+	}
+
+	// 沒有帶節點名稱的連線也不接受 (空白的設定在 NewPeerAdmission 就擋掉了)
+	if id.NodeID == "" || id.NodeID != a.NodeID {
+		return fmt.Errorf("節點名稱 %q 不是設定的 %q", id.NodeID, a.NodeID)
+	}
+
+	return nil
+}
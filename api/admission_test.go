@@ -0,0 +1,49 @@
+package api
+
+import "testing"
+
+func TestNewPeerAdmissionRequiresIdentity(t *testing.T) {
+	tests := []struct {
+		name    string
+		nodeID  string
+		allowed []string
+		ok      bool
+	}{
+		{"node id and address", "ha-b", []string{"192.168.100.99"}, true},
+		{"cidr", "ha-b", []string{"10.10.0.0/24"}, true},
+		// 兩個都要有 不然誰都可以連進來
+		{"no node id", "", []string{"192.168.100.99"}, false},
+		{"no address", "ha-b", nil, false},
+		{"invalid address", "ha-b", []string{"peer.local"}, false},
+	}
+	for _, tt := range tests {
+		if _, err := NewPeerAdmission(tt.nodeID, tt.allowed); (err == nil) != tt.ok {
+			t.Errorf("%s: err = %v, want ok = %v", tt.name, err, tt.ok)
+		}
+	}
+}
+
+func TestPeerAdmissionCheck(t *testing.T) {
+	admission, err := NewPeerAdmission("ha-b", []string{"192.168.100.99", "10.10.0.0/24"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		id   peerIdentity
+		ok   bool
+	}{
+		{"peer", peerIdentity{NodeID: "ha-b", Remote: "192.168.100.99:40000"}, true},
+		{"peer on the second network", peerIdentity{NodeID: "ha-b", Remote: "10.10.0.99:40000"}, true},
+		{"unknown address", peerIdentity{NodeID: "ha-b", Remote: "192.168.100.50:40000"}, false},
+		{"wrong node id", peerIdentity{NodeID: "ha-x", Remote: "192.168.100.99:40000"}, false},
+		// 沒有帶節點名稱 不能取代另外一台的 stream
+		{"no node id", peerIdentity{Remote: "192.168.100.99:40000"}, false},
+		{"no remote", peerIdentity{NodeID: "ha-b"}, false},
+	}
+	for _, tt := range tests {
+		if err := admission.check(tt.id); (err == nil) != tt.ok {
+			t.Errorf("%s: err = %v, want ok = %v", tt.name, err, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"kenmec/ha/jimmy/config"
+	"net"
+	"net/http"
+	"os/exec"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// AMQP 0-9-1 的 protocol header
+var amqpProtocolHeader = []byte("AMQP\x00\x00\x09\x01")
+
+// CheckDependency 依照 TYPE 檢查一次依賴的服務 ctx 決定超時
+func CheckDependency(ctx context.Context, d config.DependencyConfig) error {
+	switch d.TYPE {
+	case "tcp":
+		conn, err := dialDependency(ctx, d.ADDRESS)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	case "amqp":
+		return checkAMQP(ctx, d.ADDRESS)
+	case "mysql":
+		return checkMySQL(ctx, d.ADDRESS)
+	case "http":
+		return checkHTTP(ctx, d.URL)
+	case "exec":
+		return checkExec(ctx, d.COMMAND)
+	}
+	return fmt.Errorf("無效的類型 %q", d.TYPE)
+}
+
+func dialDependency(ctx context.Context, addr string) (net.Conn, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	return conn, nil
+}
+
+// 送出 protocol header 後 server 必須回 Connection.Start (class 10 method 10)
+// 不做登入 只確認 broker 有在處理連線
+func checkAMQP(ctx context.Context, addr string) error {
+	conn, err := dialDependency(ctx, addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write(amqpProtocolHeader); err != nil {
+		return err
+	}
+
+	// frame header: type(1) channel(2) size(4) 接著 method 的 class(2) method(2)
+	buf := make([]byte, 11)
+	if _, err := io.ReadFull(conn, buf[:8]); err != nil {
+		return fmt.Errorf("沒有收到 AMQP 回應: %w", err)
+	}
+	if bytes.HasPrefix(buf, []byte("AMQP")) {
+		return fmt.Errorf("broker 不支援 AMQP 0-9-1 (回應 %q)", buf[:8])
+	}
+	if _, err := io.ReadFull(conn, buf[8:]); err != nil {
+		return fmt.Errorf("AMQP 回應不完整: %w", err)
+	}
+	class := binary.BigEndian.Uint16(buf[7:9])
+	method := binary.BigEndian.Uint16(buf[9:11])
+	if buf[0] != 1 || class != 10 || method != 10 {
+		return fmt.Errorf("AMQP 回應不是 Connection.Start (type %d class %d method %d)", buf[0], class, method)
+	}
+	return nil
+}
+
+// 讀取 server 一連上就送出的 handshake 封包 protocol 10 代表正常
+// 錯誤封包 (0xff) 例如連線數太多、host 被擋 會回傳錯誤訊息
+// 不做登入 server 會記一次 aborted connect (loopback 不會被 max_connect_errors 擋)
+func checkMySQL(ctx context.Context, addr string) error {
+	conn, err := dialDependency(ctx, addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return fmt.Errorf("沒有收到 MySQL handshake: %w", err)
+	}
+	size := int(header[0]) | int(header[1])<<8 | int(header[2])<<16
+	if size == 0 || size > 1<<16 {
+		return fmt.Errorf("MySQL handshake 長度不正確 (%d)", size)
+	}
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(conn, payload); err != nil {
+		return fmt.Errorf("MySQL handshake 不完整: %w", err)
+	}
+
+	switch payload[0] {
+	case 10:
+		return nil
+	case 0xff:
+		msg := payload[min(len(payload), 3):]
+		if len(msg) > 0 && msg[0] == '#' {
+			msg = msg[min(len(msg), 6):] // SQL state
+		}
+		return fmt.Errorf("MySQL 拒絕連線: %s", msg)
+	}
+	return fmt.Errorf("不支援的 MySQL protocol %d", payload[0])
+}
+
+func checkHTTP(ctx context.Context, url string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("HTTP %s", resp.Status)
+	}
+	return nil
+}
+
+// 超時後等子程序關掉輸出的時間
+const execWaitDelay = time.Second
+
+func checkExec(ctx context.Context, command []string) error {
+	cmd := exec.CommandContext(ctx, command[0], command[1:]...)
+	// 腳本自己開的子程序也在同一個 process group 超時時一起砍掉
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+	// 還有程序拿著 stdout 時不會一直等下去
+	cmd.WaitDelay = execWaitDelay
+
+	out, err := cmd.CombinedOutput()
+	if err == nil {
+		return nil
+	}
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("執行超時: %w", ctx.Err())
+	}
+
+	msg := strings.TrimSpace(string(out))
+	if len(msg) > 200 {
+		msg = msg[:200]
+	}
+	if msg == "" {
+		return err
+	}
+	return fmt.Errorf("%w: %s", err, msg)
+}
@@ -0,0 +1,33 @@
+package api
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestCheckExec(t *testing.T) {
+	ctx := context.Background()
+	if err := checkExec(ctx, []string{"sh", "-c", "exit 0"}); err != nil {
+		t.Errorf("exit 0: %v", err)
+	}
+	err := checkExec(ctx, []string{"sh", "-c", "echo mysql down; exit 1"})
+	if err == nil || err.Error() != "exit status 1: mysql down" {
+		t.Errorf("exit 1: err = %v, want the exit status with the output", err)
+	}
+}
+
+func TestCheckExecKillsChildrenOnTimeout(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	// 背景的 sleep 繼承了 stdout 只砍掉 sh 的話 CombinedOutput 會等到 sleep 結束
+	start := time.Now()
+	err := checkExec(ctx, []string{"sh", "-c", "sleep 30 & sleep 30"})
+	if err == nil {
+		t.Fatal("timed out command returned no error")
+	}
+	if elapsed := time.Since(start); elapsed > execWaitDelay+time.Second {
+		t.Errorf("checkExec took %v after the timeout, want the process group killed", elapsed)
+	}
+}
@@ -2,194 +2,81 @@ package api
 
 import (
 	"context"
-	"io"
+	"kenmec/ha/jimmy/config"
 	pb "kenmec/ha/jimmy/protoGen"
 	"log"
-	"sync"
-	"time"
+	"strconv"
 
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials/insecure"
-	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
 )
 
-type GRPCHAClient struct {
-	address        string
-	conn           *grpc.ClientConn
-	client         pb.HASyncServiceClient
-	stream         pb.HASyncService_ExchangeStatusClient
-	mu             sync.RWMutex
-	ctx            context.Context
-	cancel         context.CancelFunc
-	reconnectDelay time.Duration
-	maxRetries     int
-	isConnected    bool
-}
-
-func NewGRPCClient(address string) *GRPCHAClient {
+// 在 stream metadata 帶上這條連線是第幾條網路路徑
+const PathMetadataKey = "x-ha-path"
 
-	ctx, cancel := context.WithCancel(context.Background())
-
-	return &GRPCHAClient{
-		address:        address,
-		ctx:            ctx,
-		cancel:         cancel,
-		reconnectDelay: 5 * time.Second,
-		maxRetries:     -1,
-	}
+// 連到另外一台HA 只負責送資料
+type GRPCHAClient struct {
+	stream *StreamClient[pb.StatusRequest, pb.StatusResponse]
+	path   int
 }
 
-func (g *GRPCHAClient) Conneect() error {
-	g.mu.Lock()
-	defer g.mu.Unlock()
-
-	if g.conn != nil {
-		g.conn.Close()
-	}
-
-	kacp := keepalive.ClientParameters{
-		Time:                10 * time.Second,
-		Timeout:             3 * time.Second,
-		PermitWithoutStream: true,
-	}
-
-	conn, err := grpc.NewClient(
-		g.address,
-		grpc.WithTransportCredentials(insecure.NewCredentials()),
-		grpc.WithKeepaliveParams(kacp),
-	)
-
-	if err != nil {
-		return err
+// nodeID 是本機的節點名稱 另外一台用來確認連線的對象
+func NewGRPCClient(address string, path int, nodeID string, creds credentials.TransportCredentials) *GRPCHAClient {
+	g := &GRPCHAClient{path: path}
+
+	g.stream = NewStreamClient(StreamClientOptions{
+		Name:    "HA " + address,
+		Address: address,
+		Creds:   creds,
+	}, func(ctx context.Context, conn *grpc.ClientConn) (grpc.BidiStreamingClient[pb.StatusRequest, pb.StatusResponse], error) {
+		ctx = metadata.AppendToOutgoingContext(ctx,
+			PathMetadataKey, strconv.Itoa(path),
+			NodeIDMetadataKey, nodeID,
+		)
+		return pb.NewHASyncServiceClient(conn).ExchangeStatus(ctx)
+	})
+
+	g.stream.OnReceive = func(msg *pb.StatusResponse) {
+		config.LogErrorf("📨  這裡不可以接收訊息❌ ❌ : %+v", msg)
 	}
-
-	g.conn = conn
-	g.client = pb.NewHASyncServiceClient(conn)
-	g.isConnected = true
-
-	stream, err := g.client.ExchangeStatus(g.ctx)
-	if err != nil {
-		g.conn.Close()
-		g.isConnected = false
-		return err
+	g.stream.OnStateChange = func(state ConnState, err error) {
+		switch state {
+		case StateReady:
+			log.Printf("✅ gRPC 連線成功 %s", address)
+		case StateConnecting:
+			log.Printf("🔄 HA %s 嘗試連線...", address)
+		}
 	}
-	g.stream = stream
 
-	log.Println("✅ gRPC 連線成功")
-	return nil
+	return g
 }
 
 func (g *GRPCHAClient) SendMessage(msg *pb.StatusRequest) error {
-	g.mu.RLock()
-	defer g.mu.RUnlock()
-
-	if !g.isConnected || g.stream == nil {
-		return io.EOF
-	}
-
 	return g.stream.Send(msg)
 }
 
-func (g *GRPCHAClient) ReceiveMessage() {
-	for {
-		g.mu.RLock()
-		stream := g.stream
-		connected := g.isConnected
-		g.mu.RUnlock()
-
-		if !connected || stream == nil {
-			time.Sleep(1 * time.Second)
-			continue
-		}
-
-		msg, err := stream.Recv()
-		if err != nil {
-			if err == io.EOF {
-				log.Println("❌ 伺服器關閉連線")
-			} else {
-				log.Printf("❌ 接收訊息錯誤: %v", err)
-			}
-			g.mu.Lock()
-			g.isConnected = false
-			g.mu.Unlock()
-			break
-		}
-
-		log.Printf("📨  這裡不可以接收訊息❌ ❌ : %+v", msg)
-	}
+// 維持連線 斷線會自動重連 會一直阻塞
+func (g *GRPCHAClient) MaintainConnection() {
+	g.stream.Run()
 }
 
-func (g *GRPCHAClient) StartHeartbeat(interval time.Duration) {
-	ticker := time.NewTicker(interval)
-	defer ticker.Stop()
-
-	for {
-		select {
-		case <-g.ctx.Done():
-			return
-		case <-ticker.C:
-			hbMsg := &pb.StatusRequest{
-
-				Payload: &pb.StatusRequest_Hb{Hb: int32(time.Now().Unix())},
-			}
-
-			if err := g.SendMessage(hbMsg); err != nil {
-				log.Printf("💓 心跳發送失敗: %v", err)
-			}
-		}
-	}
+func (g *GRPCHAClient) IsConnected() bool {
+	return g.stream.IsReady()
 }
 
-func (g *GRPCHAClient) MaintainConnection() {
-	retryCount := 0
-	for {
-		select {
-		case <-g.ctx.Done():
-			return
-		default:
-		}
-
-		if !g.isConnected {
-			log.Printf("🔄 HA 嘗試重新連線... (第 %d 次)", retryCount+1)
-
-			if err := g.Conneect(); err != nil {
-				log.Printf("❌ HA 重連失敗: %v，%v 秒後重試...", err, g.reconnectDelay.Seconds())
-				time.Sleep(g.reconnectDelay)
-				retryCount++
-				continue
-			}
-			retryCount = 0
-
-			go g.ReceiveMessage()
-		}
-
-		time.Sleep(1 * time.Second)
-	}
+func (g *GRPCHAClient) Stats() StreamClientStats {
+	return g.stream.Stats()
 }
 
-func (g *GRPCHAClient) LoggingConnectionStatus() {
-	for {
-		if !g.IsConnected() {
-			log.Println("⏳ 等待 HA gRPC 連線到另外一台HA...")
-			time.Sleep(1 * time.Second)
-		}
-
-	}
+func (g *GRPCHAClient) Address() string {
+	return g.stream.opts.Address
 }
 
-func (g *GRPCHAClient) IsConnected() bool {
-	g.mu.RLock()
-	defer g.mu.RUnlock()
-	return g.isConnected
+func (g *GRPCHAClient) Path() int {
+	return g.path
 }
 
 func (g *GRPCHAClient) Close() {
-	g.cancel()
-	g.mu.Lock()
-	defer g.mu.Unlock()
-
-	if g.conn != nil {
-		g.conn.Close()
-	}
-	g.isConnected = false
+	g.stream.Close()
 }
@@ -2,29 +2,18 @@ package api
 
 import (
 	"context"
-	"io"
 	"kenmec/ha/jimmy/config"
 	pb "kenmec/ha/jimmy/protoGen"
 	"log"
-	"sync"
 	"time"
 
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials/insecure"
-	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/credentials"
 )
 
+// 連到本機的交管
 type GRPCFleetClient struct {
-	address        string
-	conn           *grpc.ClientConn
-	client         pb.HAServiceClient
-	stream         pb.HAService_HAStreamingClient
-	mu             sync.RWMutex
-	ctx            context.Context
-	cancel         context.CancelFunc
-	reconnectDelay time.Duration
-	maxRetries     int
-	isConnected    bool
+	stream *StreamClient[pb.ClientMessage, pb.ServerMessage]
 
 	//用類似callback的方式 可以在其他地方呼叫用
 	OnReceiveMsg func(msg *pb.ServerMessage)
@@ -32,110 +21,50 @@ type GRPCFleetClient struct {
 	OnFleetConnected func()
 }
 
-func NewGRPCFleetClient(address string) *GRPCFleetClient {
+func NewGRPCFleetClient(address string, creds credentials.TransportCredentials) *GRPCFleetClient {
+	g := &GRPCFleetClient{}
 
-	ctx, cancel := context.WithCancel(context.Background())
+	g.stream = NewStreamClient(StreamClientOptions{
+		Name:    "FLEET " + address,
+		Address: address,
+		Creds:   creds,
+	}, func(ctx context.Context, conn *grpc.ClientConn) (grpc.BidiStreamingClient[pb.ClientMessage, pb.ServerMessage], error) {
+		return pb.NewHAServiceClient(conn).HAStreaming(ctx)
+	})
 
-	return &GRPCFleetClient{
-		address:        address,
-		ctx:            ctx,
-		cancel:         cancel,
-		reconnectDelay: 5 * time.Second,
-		maxRetries:     -1,
-	}
-}
-
-func (g *GRPCFleetClient) ConneectToFleet() error {
-	g.mu.Lock()
-	defer g.mu.Unlock()
-
-	if g.conn != nil {
-		g.conn.Close()
-	}
-
-	kacp := keepalive.ClientParameters{
-		Time:                10 * time.Second,
-		Timeout:             3 * time.Second,
-		PermitWithoutStream: true,
+	g.stream.OnReceive = func(msg *pb.ServerMessage) {
+		if g.OnReceiveMsg != nil {
+			g.OnReceiveMsg(msg)
+		}
 	}
-
-	conn, err := grpc.NewClient(
-		g.address,
-		grpc.WithTransportCredentials(insecure.NewCredentials()),
-		grpc.WithKeepaliveParams(kacp),
-	)
-
-	if err != nil {
-		return err
+	g.stream.OnStateChange = func(state ConnState, err error) {
+		switch state {
+		case StateReady:
+			log.Printf("✅ gRPC 連線成功 %s", address)
+			if g.OnFleetConnected != nil {
+				go g.OnFleetConnected()
+			}
+		case StateConnecting:
+			log.Printf("🔄 FLEET %s 嘗試連線...", address)
+		}
 	}
 
-	g.conn = conn
-	g.client = pb.NewHAServiceClient(conn)
-	g.isConnected = true
-
-	stream, err := g.client.HAStreaming(g.ctx)
-	if err != nil {
-		g.conn.Close()
-		g.isConnected = false
-		return err
-	}
-	g.stream = stream
-	if g.OnFleetConnected != nil {
-		go g.OnFleetConnected()
-	}
-	log.Println("✅ gRPC 連線成功")
-	return nil
+	return g
 }
 
 func (g *GRPCFleetClient) SendMessageToFleet(msg *pb.ClientMessage) error {
-	g.mu.RLock()
-	defer g.mu.RUnlock()
-
-	if !g.isConnected || g.stream == nil {
-		return io.EOF
-	}
-
 	return g.stream.Send(msg)
 }
 
-func (g *GRPCFleetClient) ReceiveMessageFromFleet() {
-	for {
-		g.mu.RLock()
-		stream := g.stream
-		connected := g.isConnected
-		g.mu.RUnlock()
-
-		if !connected || stream == nil {
-			time.Sleep(1 * time.Second)
-			continue
-		}
-
-		msg, err := stream.Recv()
-		if err != nil {
-			if err == io.EOF {
-				log.Println("❌ 伺服器關閉連線")
-			} else {
-				log.Printf("❌ 接收訊息錯誤: %v", err)
-			}
-			g.mu.Lock()
-			g.isConnected = false
-			g.mu.Unlock()
-			break
-		}
-
-		// log.Printf("📨 收到訊息來自交管: %+v", msg)
-		g.OnReceiveMsg(msg)
-	}
-}
-
 // 跟交管心跳用
 func (g *GRPCFleetClient) StartHeartbeatToFleet() {
-	ticker := time.NewTicker(time.Duration(config.Cfg.FLEET_HB_INTERVAL) * time.Second)
+	interval := config.Current().FLEET_HB_INTERVAL.Duration()
+	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 
 	for {
 		select {
-		case <-g.ctx.Done():
+		case <-g.stream.Context().Done():
 			return
 		case <-ticker.C:
 			hbMsg := &pb.ClientMessage{
@@ -146,65 +75,41 @@ func (g *GRPCFleetClient) StartHeartbeatToFleet() {
 			if err := g.SendMessageToFleet(hbMsg); err != nil {
 				log.Printf("💓 心跳到交管發送失敗: %v", err)
 			}
+
+			// 設定重新載入後間隔可能會變
+			if want := config.Current().FLEET_HB_INTERVAL.Duration(); want > 0 && want != interval {
+				interval = want
+				ticker.Reset(interval)
+			}
 		}
 	}
 }
 
+// 維持連線 斷線會自動重連 會一直阻塞
 func (g *GRPCFleetClient) MaintainConnectionWithFleet() {
-	retryCount := 0
-	for {
-		select {
-		case <-g.ctx.Done():
-			return
-		default:
-		}
-
-		if !g.isConnected {
-			log.Printf("🔄 FLEET 嘗試重新連線... (第 %d 次)", retryCount+1)
-
-			if err := g.ConneectToFleet(); err != nil {
-				log.Printf("❌ FLEET 重連失敗: %v，%v 秒後重試...", err, g.reconnectDelay.Seconds())
-				time.Sleep(g.reconnectDelay)
-				retryCount++
-				continue
-			}
-			retryCount = 0
-
-			go g.ReceiveMessageFromFleet()
-		}
+	g.stream.Run()
+}
 
-		time.Sleep(1 * time.Second)
-	}
+func (g *GRPCFleetClient) IsConnectedToFleet() bool {
+	return g.stream.IsReady()
 }
 
-func (g *GRPCFleetClient) LoggingConnectionStatus() {
-	for {
-		if !g.IsConnectedToFleet() {
-			log.Println("⏳ 等待 gRPC 連線到交管...")
-			time.Sleep(1 * time.Second)
-		}
+// 交管回報自己斷線時 重新建立 stream
+func (g *GRPCFleetClient) UpdateConnectStatus(isConnect bool) {
+	if !isConnect {
+		g.stream.Reconnect()
 	}
 }
 
-func (g *GRPCFleetClient) IsConnectedToFleet() bool {
-	g.mu.RLock()
-	defer g.mu.RUnlock()
-	return g.isConnected
+// 用 grpc.health.v1 檢查交管的 gRPC 服務
+func (g *GRPCFleetClient) HealthCheck(ctx context.Context, service string) (bool, error) {
+	return g.stream.HealthCheck(ctx, service)
 }
 
-func (g *GRPCFleetClient) UpdateConnectStatus(isConnect bool) {
-	g.mu.Lock()
-	defer g.mu.Unlock()
-	g.isConnected = isConnect
+func (g *GRPCFleetClient) Stats() StreamClientStats {
+	return g.stream.Stats()
 }
 
 func (g *GRPCFleetClient) CloseWithFleet() {
-	g.cancel()
-	g.mu.Lock()
-	defer g.mu.Unlock()
-
-	if g.conn != nil {
-		g.conn.Close()
-	}
-	g.isConnected = false
+	g.stream.Close()
 }
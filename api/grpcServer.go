@@ -2,49 +2,124 @@ package api
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"io"
+	"kenmec/ha/jimmy/config"
 	pb "kenmec/ha/jimmy/protoGen"
 	"log"
 	"net"
+	"sort"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"google.golang.org/grpc"
+	channelzsvc "google.golang.org/grpc/channelz/service"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
 )
 
 type HAToOtherServer struct {
 	pb.UnimplementedHASyncServiceServer
 
+	opts   HAServerOptions
+	health *health.Server
+
+	// 以 "節點名稱/路徑" 為 key 同一個對方同一條路徑只會有一個連線
 	clients     map[string]*ClientConnection
 	clientsLock sync.RWMutex
+	connSeq     atomic.Uint64
+	rejected    atomic.Uint64
 
 	//用類似callback的方式 可以在其他地方呼叫用
 	OnReceiveMsg func(msg *pb.StatusRequest)
 
+	// 收到心跳時通知是從第幾條網路路徑來的
+	OnPathHeartbeat func(path int)
+
 	// 當本機的grpc聯繫到另外一台時 如果是另外一台是backup 會通知交管傳送目前所以任務以及貨物資料
 	OnClientConnected func()
+
+	// 另外一台的連線建立或中斷時通知 connected 為 false 代表斷線
+	OnClientChange func(info ClientInfo, connected bool)
 }
 
 // ClientConnection represents a connected client
 type ClientConnection struct {
-	stream     pb.HASyncService_ExchangeStatusServer
-	ctx        context.Context
-	cancelFunc context.CancelFunc
-	lastHB     time.Time
-	mu         sync.RWMutex
+	id          string
+	identity    peerIdentity
+	stream      pb.HASyncService_ExchangeStatusServer
+	path        int
+	ctx         context.Context
+	cancelFunc  context.CancelCauseFunc
+	connectedAt time.Time
+	lastHB      time.Time
+	mu          sync.RWMutex
+}
+
+// 對外顯示用的連線資訊
+type ClientInfo struct {
+	ID          string    `json:"id"`
+	NodeID      string    `json:"node_id"`
+	Path        int       `json:"path"`
+	Remote      string    `json:"remote"`
+	CertNames   []string  `json:"cert_names,omitempty"`
+	ConnectedAt time.Time `json:"connected_at"`
+	LastHB      time.Time `json:"last_hb"`
+}
+
+type HAServerOptions struct {
+	Creds     credentials.TransportCredentials // nil 代表不使用 TLS
+	Admission PeerAdmission
+
+	// 除錯用 讓 grpcurl 之類的工具可以列出服務
+	Reflection bool
+	// 除錯用 提供 grpc channelz 查看連線狀態
+	Channelz bool
 }
 
-func NewHAToOtherServer() *HAToOtherServer {
+// grpc.health.v1 裡用的服務名稱 HASyncService 本身以外 另外提供角色以及準備狀態
+const (
+	HealthServiceSync   = "ha_sync_pb.HASyncService"
+	HealthServiceMaster = "kenmec.ha.Master" // 本機是 MASTER 時 SERVING
+	HealthServiceReady  = "kenmec.ha.Ready"  // 本機準備好時 SERVING
+)
+
+func NewHAToOtherServer(opts HAServerOptions) *HAToOtherServer {
+	h := health.NewServer()
+	h.SetServingStatus("", healthpb.HealthCheckResponse_NOT_SERVING)
+	h.SetServingStatus(HealthServiceSync, healthpb.HealthCheckResponse_SERVING)
+	h.SetServingStatus(HealthServiceMaster, healthpb.HealthCheckResponse_NOT_SERVING)
+	h.SetServingStatus(HealthServiceReady, healthpb.HealthCheckResponse_NOT_SERVING)
+
 	return &HAToOtherServer{
+		opts:    opts,
+		health:  h,
 		clients: make(map[string]*ClientConnection),
 	}
 }
 
+// SetServingStatus 更新 grpc.health.v1 某個服務的狀態
+func (s *HAToOtherServer) SetServingStatus(service string, serving bool) {
+	status := healthpb.HealthCheckResponse_NOT_SERVING
+	if serving {
+		status = healthpb.HealthCheckResponse_SERVING
+	}
+	s.health.SetServingStatus(service, status)
+}
+
 func (s *HAToOtherServer) ListenServer(port string) {
 	lis, err := net.Listen("tcp", ":"+port)
 	if err != nil {
-		log.Fatalf("❌ 監聽失敗: %v", err)
+		config.LogFatalf("❌ 監聽失敗: %v", err)
 	}
 
 	kaep := keepalive.EnforcementPolicy{
@@ -57,71 +132,160 @@ func (s *HAToOtherServer) ListenServer(port string) {
 		Timeout: 3 * time.Second,
 	}
 
-	grpcServer := grpc.NewServer(
+	opts := []grpc.ServerOption{
 		grpc.KeepaliveEnforcementPolicy(kaep),
 		grpc.KeepaliveParams(kasp),
-	)
+	}
+	if s.opts.Creds != nil {
+		opts = append(opts, grpc.Creds(s.opts.Creds))
+	}
+
+	grpcServer := grpc.NewServer(opts...)
 
 	pb.RegisterHASyncServiceServer(grpcServer, s)
+	healthpb.RegisterHealthServer(grpcServer, s.health)
+	if s.opts.Reflection {
+		reflection.Register(grpcServer)
+	}
+	if s.opts.Channelz {
+		channelzsvc.RegisterChannelzServiceToServer(grpcServer)
+	}
 
 	log.Printf("🚀 gRPC 伺服器啟動於 :%s", port)
 
 	if err := grpcServer.Serve(lis); err != nil {
-		log.Fatalf("❌ 服務啟動失敗: %v", err)
+		config.LogFatalf("❌ 服務啟動失敗: %v", err)
 	}
 }
 
+// 同一個對方同一條路徑重新連線時 舊的 stream 用這個原因結束
+var errStreamReplaced = errors.New("連線已被取代")
+
 // ✅ Implement the correct method name from proto
 func (s *HAToOtherServer) ExchangeStatus(stream pb.HASyncService_ExchangeStatusServer) error {
-	ctx, cancel := context.WithCancel(stream.Context())
-	defer cancel()
+	identity := identityFromContext(stream.Context())
+	if err := s.opts.Admission.check(identity); err != nil {
+		count := s.rejected.Add(1)
+		config.LogWarnf("🚫 拒絕來自 %s 的連線 (node: %q): %v (累計拒絕 %d 次)", identity.Remote, identity.NodeID, err, count)
+		return status.Error(codes.PermissionDenied, err.Error())
+	}
+
+	ctx, cancel := context.WithCancelCause(stream.Context())
+	defer cancel(nil)
 
-	clientID := generateClientID()
+	path := pathFromContext(stream.Context())
+	key := identity.NodeID + "/" + strconv.Itoa(path)
 
 	client := &ClientConnection{
-		stream:     stream,
-		ctx:        ctx,
-		cancelFunc: cancel,
-		lastHB:     time.Now(),
+		id:          fmt.Sprintf("%s#%d", key, s.connSeq.Add(1)),
+		identity:    identity,
+		stream:      stream,
+		path:        path,
+		ctx:         ctx,
+		cancelFunc:  cancel,
+		connectedAt: time.Now(),
+		lastHB:      time.Now(),
 	}
 
+	// 同一個對方同一條路徑重連時 把舊的 stream 關掉
 	s.clientsLock.Lock()
-	s.clients[clientID] = client
+	old, replaced := s.clients[key]
+	s.clients[key] = client
+	clientCount := len(s.clients)
 	s.clientsLock.Unlock()
 
+	if replaced {
+		log.Printf("🔁 客戶端 %s 重新連線 取代舊連線 %s", client.id, old.id)
+		old.cancelFunc(errStreamReplaced)
+	}
+
 	if s.OnClientConnected != nil {
 		go s.OnClientConnected()
 	}
+	if s.OnClientChange != nil {
+		s.OnClientChange(client.info(), true)
+	}
 
-	log.Printf("✅ 新客戶端連線: %s (總數: %d)", clientID, len(s.clients))
+	log.Printf("✅ 新客戶端連線: %s from %s (總數: %d)", client.id, identity.Remote, clientCount)
 
 	defer func() {
 		s.clientsLock.Lock()
-		delete(s.clients, clientID)
+		if s.clients[key] == client {
+			delete(s.clients, key)
+		}
 		clientCount := len(s.clients)
 		s.clientsLock.Unlock()
-		log.Printf("❌ 客戶端斷線: %s (剩餘: %d)", clientID, clientCount)
+		config.LogErrorf("❌ 客戶端斷線: %s (剩餘: %d)", client.id, clientCount)
+		if s.OnClientChange != nil {
+			s.OnClientChange(client.info(), false)
+		}
 	}()
 
-	// Receive messages loop
-	for {
-		msg, err := stream.Recv()
-		if err != nil {
-			if err == io.EOF {
-				log.Printf("📭 客戶端 %s 正常關閉連線", clientID)
-				return nil
+	// Recv 不會因為 ctx 被取消而返回 所以放在另外的 goroutine
+	// handler 返回後 stream 結束 Recv 也會跟著返回
+	errCh := make(chan error, 1)
+	go func() {
+		for {
+			msg, err := stream.Recv()
+			if err != nil {
+				errCh <- err
+				return
 			}
-			log.Printf("❌ 客戶端 %s 接收錯誤: %v", clientID, err)
-			return err
+
+			s.handleClientMessage(client, msg)
 		}
+	}()
 
-		s.handleClientMessage(msg)
+	select {
+	case <-ctx.Done():
+		if errors.Is(context.Cause(ctx), errStreamReplaced) {
+			log.Printf("📭 客戶端 %s 的連線已被取代", client.id)
+			return nil
+		}
+		log.Printf("📭 客戶端 %s 斷線: %v", client.id, context.Cause(ctx))
+		return nil
+	case err := <-errCh:
+		if err == io.EOF {
+			log.Printf("📭 客戶端 %s 正常關閉連線", client.id)
+			return nil
+		}
+		config.LogErrorf("❌ 客戶端 %s 接收錯誤: %v", client.id, err)
+		return err
 	}
 }
 
 // handleClientMessage processes messages from client
-func (s *HAToOtherServer) handleClientMessage(msg *pb.StatusRequest) {
-	s.OnReceiveMsg(msg)
+func (s *HAToOtherServer) handleClientMessage(client *ClientConnection, msg *pb.StatusRequest) {
+	if _, ok := msg.Payload.(*pb.StatusRequest_Hb); ok {
+		client.mu.Lock()
+		client.lastHB = time.Now()
+		client.mu.Unlock()
+
+		if s.OnPathHeartbeat != nil {
+			s.OnPathHeartbeat(client.path)
+		}
+	}
+
+	if s.OnReceiveMsg != nil {
+		s.OnReceiveMsg(msg)
+	}
+}
+
+// 舊版的另外一台不會帶路徑 視為第 0 條
+func pathFromContext(ctx context.Context) int {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return 0
+	}
+	values := md.Get(PathMetadataKey)
+	if len(values) == 0 {
+		return 0
+	}
+	path, err := strconv.Atoi(values[0])
+	if err != nil {
+		return 0
+	}
+	return path
 }
 
 func (s *HAToOtherServer) BroadcastMessage(msg *pb.StatusResponse) {
@@ -130,7 +294,7 @@ func (s *HAToOtherServer) BroadcastMessage(msg *pb.StatusResponse) {
 
 	for clientID, client := range s.clients {
 		if err := client.stream.Send(msg); err != nil {
-			log.Printf("❌ 廣播至客戶端 %s 失敗: %v", clientID, err)
+			config.LogErrorf("❌ 廣播至客戶端 %s 失敗: %v", clientID, err)
 		}
 	}
 }
@@ -147,6 +311,43 @@ func (s *HAToOtherServer) SendToClient(clientID string, msg *pb.StatusResponse)
 	return client.stream.Send(msg)
 }
 
-func generateClientID() string {
-	return time.Now().Format("20060102150405.000000")
+func (c *ClientConnection) info() ClientInfo {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return ClientInfo{
+		ID:          c.id,
+		NodeID:      c.identity.NodeID,
+		Path:        c.path,
+		Remote:      c.identity.Remote,
+		CertNames:   c.identity.CertNames,
+		ConnectedAt: c.connectedAt,
+		LastHB:      c.lastHB,
+	}
+}
+
+func (s *HAToOtherServer) Clients() []ClientInfo {
+	s.clientsLock.RLock()
+	defer s.clientsLock.RUnlock()
+
+	out := make([]ClientInfo, 0, len(s.clients))
+	for _, c := range s.clients {
+		out = append(out, c.info())
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].ID < out[j].ID
+	})
+	return out
+}
+
+func (s *HAToOtherServer) ClientCount() int {
+	s.clientsLock.RLock()
+	defer s.clientsLock.RUnlock()
+	return len(s.clients)
+}
+
+// 被拒絕的連線次數
+func (s *HAToOtherServer) RejectedCount() uint64 {
+	return s.rejected.Load()
 }
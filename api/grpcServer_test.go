@@ -0,0 +1,86 @@
+package api
+
+import (
+	"context"
+	"errors"
+	pb "kenmec/ha/jimmy/protoGen"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// 只提供 HAToOtherServer 的 grpc.health.v1 以及一個不會結束的 HASyncService
+func startHealthServer(t *testing.T, s *HAToOtherServer) string {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := grpc.NewServer()
+	healthpb.RegisterHealthServer(server, s.health)
+	pb.RegisterHASyncServiceServer(server, &fakeSyncServer{hold: time.Hour, streams: make(chan struct{}, 100)})
+	go server.Serve(lis)
+	t.Cleanup(server.Stop)
+	return lis.Addr().String()
+}
+
+func TestHAServerHealthTransitions(t *testing.T) {
+	s := NewHAToOtherServer(HAServerOptions{})
+	c := newTestStreamClient(t, startHealthServer(t, s), time.Hour)
+
+	ctx := context.Background()
+	if _, err := c.HealthCheck(ctx, ""); !errors.Is(err, ErrNotConnected) {
+		t.Fatalf("HealthCheck before Run: err = %v, want ErrNotConnected", err)
+	}
+	go c.Run()
+	deadline := time.Now().Add(5 * time.Second)
+	for !c.IsReady() && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+
+	check := func(service string) bool {
+		t.Helper()
+		serving, err := c.HealthCheck(ctx, service)
+		if err != nil {
+			t.Fatalf("HealthCheck(%q): %v", service, err)
+		}
+		return serving
+	}
+
+	// 啟動時只有 HASyncService 是 SERVING 健康狀態以及角色要等第一次計算
+	initial := map[string]bool{"": false, HealthServiceSync: true, HealthServiceMaster: false, HealthServiceReady: false}
+	for service, want := range initial {
+		if got := check(service); got != want {
+			t.Errorf("initial %q serving = %v, want %v", service, got, want)
+		}
+	}
+
+	steps := []struct {
+		name    string
+		service string
+		serving bool
+	}{
+		{"failover ok", "", true},
+		{"ready", HealthServiceReady, true},
+		{"became master", HealthServiceMaster, true},
+		{"failover failed", "", false},
+		{"became backup", HealthServiceMaster, false},
+	}
+	for _, step := range steps {
+		s.SetServingStatus(step.service, step.serving)
+		if got := check(step.service); got != step.serving {
+			t.Errorf("%s: %q serving = %v, want %v", step.name, step.service, got, step.serving)
+		}
+	}
+	// 其他服務不受影響
+	if !check(HealthServiceSync) || !check(HealthServiceReady) {
+		t.Error("unrelated services changed")
+	}
+
+	if _, err := c.HealthCheck(ctx, "unknown.Service"); err == nil {
+		t.Error("unknown service checked without error")
+	}
+}
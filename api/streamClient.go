@@ -0,0 +1,347 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"io"
+	"kenmec/ha/jimmy/config"
+	"math"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/keepalive"
+)
+
+// 連線狀態
+type ConnState int
+
+const (
+	StateIdle       ConnState = iota
+	StateConnecting           // 正在建立連線
+	StateReady                // stream 已建立 可以收送
+	StateLost                 // 連線中斷 等待重連
+	StateClosed               // 已關閉 不會再重連
+)
+
+func (s ConnState) String() string {
+	switch s {
+	case StateConnecting:
+		return "connecting"
+	case StateReady:
+		return "ready"
+	case StateLost:
+		return "lost"
+	case StateClosed:
+		return "closed"
+	default:
+		return "idle"
+	}
+}
+
+func (s ConnState) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// ErrNotConnected 是還沒有建立 stream 時 Send / HealthCheck 回傳的錯誤 跟 stream 本身的 io.EOF 分開
+var ErrNotConnected = errors.New("尚未連線")
+
+type StreamClientOptions struct {
+	Name    string // 日誌用的名稱
+	Address string
+	Creds   credentials.TransportCredentials
+
+	InitialBackoff time.Duration // 第一次重連前等待的時間 預設 500ms
+	MaxBackoff     time.Duration // 重連等待時間的上限 預設 30s
+	Jitter         float64       // 等待時間隨機增減的比例 預設 0.2
+	// stream 要維持多久才算連線穩定 穩定後重試次數才會歸零 預設 10s
+	// 避免對方一建立就關閉 stream (例如被拒絕) 時不斷快速重連
+	StableAfter time.Duration
+}
+
+// 對外顯示用的連線統計
+type StreamClientStats struct {
+	Address    string    `json:"address"`
+	State      ConnState `json:"state"`
+	Since      time.Time `json:"since"`      // 進入目前狀態的時間
+	Retries    int       `json:"retries"`    // 目前連續失敗的次數
+	Reconnects int       `json:"reconnects"` // 成功重連的總次數
+	LastError  string    `json:"last_error,omitempty"`
+}
+
+// StreamOpener 在連線上建立雙向 stream
+type StreamOpener[Req, Resp any] func(ctx context.Context, conn *grpc.ClientConn) (grpc.BidiStreamingClient[Req, Resp], error)
+
+// StreamClient 是會自動重連的雙向 stream client
+// 重連使用指數退避加上隨機抖動 Close 或 ctx 結束後停止
+type StreamClient[Req, Resp any] struct {
+	opts StreamClientOptions
+	open StreamOpener[Req, Resp]
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu           sync.RWMutex
+	conn         *grpc.ClientConn
+	stream       grpc.BidiStreamingClient[Req, Resp]
+	streamCancel context.CancelFunc
+	stats        StreamClientStats
+
+	// grpc stream 的 Send 不能同時被多個 goroutine 呼叫
+	sendMu sync.Mutex
+
+	//用類似callback的方式 可以在其他地方呼叫用
+	OnReceive     func(msg *Resp)
+	OnStateChange func(state ConnState, err error)
+}
+
+func NewStreamClient[Req, Resp any](opts StreamClientOptions, open StreamOpener[Req, Resp]) *StreamClient[Req, Resp] {
+	if opts.InitialBackoff <= 0 {
+		opts.InitialBackoff = 500 * time.Millisecond
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = 30 * time.Second
+	}
+	if opts.Jitter <= 0 {
+		opts.Jitter = 0.2
+	}
+	if opts.StableAfter <= 0 {
+		opts.StableAfter = 10 * time.Second
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &StreamClient[Req, Resp]{
+		opts:   opts,
+		open:   open,
+		ctx:    ctx,
+		cancel: cancel,
+		stats: StreamClientStats{
+			Address: opts.Address,
+			State:   StateIdle,
+			Since:   time.Now(),
+		},
+	}
+}
+
+func (c *StreamClient[Req, Resp]) setState(state ConnState, err error) {
+	c.mu.Lock()
+	changed := c.stats.State != state
+	c.stats.State = state
+	if changed {
+		c.stats.Since = time.Now()
+	}
+	if err != nil {
+		c.stats.LastError = err.Error()
+	}
+	c.mu.Unlock()
+
+	if changed && c.OnStateChange != nil {
+		c.OnStateChange(state, err)
+	}
+}
+
+func (c *StreamClient[Req, Resp]) connect() error {
+	c.setState(StateConnecting, nil)
+
+	conn, err := grpc.NewClient(
+		c.opts.Address,
+		grpc.WithTransportCredentials(c.opts.Creds),
+		grpc.WithKeepaliveParams(keepalive.ClientParameters{
+			Time:                10 * time.Second,
+			Timeout:             3 * time.Second,
+			PermitWithoutStream: true,
+		}),
+	)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(c.ctx)
+	stream, err := c.open(ctx, conn)
+	if err != nil {
+		cancel()
+		conn.Close()
+		return err
+	}
+
+	c.mu.Lock()
+	c.conn = conn
+	c.stream = stream
+	c.streamCancel = cancel
+	c.mu.Unlock()
+	return nil
+}
+
+func (c *StreamClient[Req, Resp]) disconnect() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.streamCancel != nil {
+		c.streamCancel()
+	}
+	if c.conn != nil {
+		c.conn.Close()
+	}
+	c.conn = nil
+	c.stream = nil
+	c.streamCancel = nil
+}
+
+// 第 n 次重試前要等多久
+func (c *StreamClient[Req, Resp]) backoff(retries int) time.Duration {
+	d := float64(c.opts.InitialBackoff) * math.Pow(2, float64(retries-1))
+	d = math.Min(d, float64(c.opts.MaxBackoff))
+	d *= 1 + c.opts.Jitter*(2*rand.Float64()-1)
+	return time.Duration(d)
+}
+
+func (c *StreamClient[Req, Resp]) wait(d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-c.ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// Run 維持連線直到 Close 會一直阻塞
+func (c *StreamClient[Req, Resp]) Run() {
+	connectedBefore := false
+
+	for {
+		if c.ctx.Err() != nil {
+			c.setState(StateClosed, nil)
+			return
+		}
+
+		err := c.connect()
+		if err == nil {
+			c.mu.Lock()
+			if connectedBefore {
+				c.stats.Reconnects++
+			}
+			c.mu.Unlock()
+			connectedBefore = true
+
+			readyAt := time.Now()
+			c.setState(StateReady, nil)
+			err = c.receiveLoop()
+			c.disconnect()
+
+			if time.Since(readyAt) >= c.opts.StableAfter {
+				c.mu.Lock()
+				c.stats.Retries = 0
+				c.mu.Unlock()
+			}
+		}
+
+		if c.ctx.Err() != nil {
+			c.setState(StateClosed, nil)
+			return
+		}
+
+		c.mu.Lock()
+		c.stats.Retries++
+		retries := c.stats.Retries
+		c.mu.Unlock()
+
+		delay := c.backoff(retries)
+		c.setState(StateLost, err)
+		config.LogErrorf("❌ %s 連線失敗: %v，%v 後重試 (第 %d 次)", c.opts.Name, err, delay.Round(time.Millisecond), retries)
+
+		if !c.wait(delay) {
+			c.setState(StateClosed, nil)
+			return
+		}
+	}
+}
+
+func (c *StreamClient[Req, Resp]) receiveLoop() error {
+	c.mu.RLock()
+	stream := c.stream
+	c.mu.RUnlock()
+
+	for {
+		msg, err := stream.Recv()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return errors.New("伺服器關閉連線")
+			}
+			return err
+		}
+
+		if c.OnReceive != nil {
+			c.OnReceive(msg)
+		}
+	}
+}
+
+func (c *StreamClient[Req, Resp]) Send(msg *Req) error {
+	c.mu.RLock()
+	stream := c.stream
+	ready := c.stats.State == StateReady
+	c.mu.RUnlock()
+
+	if !ready || stream == nil {
+		return ErrNotConnected
+	}
+
+	c.sendMu.Lock()
+	defer c.sendMu.Unlock()
+	return stream.Send(msg)
+}
+
+// Reconnect 中斷目前的 stream Run 會依照退避重新連線
+func (c *StreamClient[Req, Resp]) Reconnect() {
+	c.mu.RLock()
+	cancel := c.streamCancel
+	c.mu.RUnlock()
+
+	if cancel != nil {
+		cancel()
+	}
+}
+
+// HealthCheck 透過目前的連線呼叫對方的 grpc.health.v1 沒有連線時回傳 ErrNotConnected
+func (c *StreamClient[Req, Resp]) HealthCheck(ctx context.Context, service string) (bool, error) {
+	c.mu.RLock()
+	conn := c.conn
+	c.mu.RUnlock()
+
+	if conn == nil {
+		return false, ErrNotConnected
+	}
+
+	resp, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{Service: service})
+	if err != nil {
+		return false, err
+	}
+	return resp.GetStatus() == healthpb.HealthCheckResponse_SERVING, nil
+}
+
+func (c *StreamClient[Req, Resp]) IsReady() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.stats.State == StateReady
+}
+
+func (c *StreamClient[Req, Resp]) Stats() StreamClientStats {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.stats
+}
+
+func (c *StreamClient[Req, Resp]) Context() context.Context {
+	return c.ctx
+}
+
+func (c *StreamClient[Req, Resp]) Close() {
+	c.cancel()
+	c.disconnect()
+}
@@ -0,0 +1,162 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"io"
+	pb "kenmec/ha/jimmy/protoGen"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// 測試用的 HA server hold 是每個 stream 維持多久才關掉
+type fakeSyncServer struct {
+	pb.UnimplementedHASyncServiceServer
+	hold    time.Duration
+	streams chan struct{}
+}
+
+func (s *fakeSyncServer) ExchangeStatus(stream grpc.BidiStreamingServer[pb.StatusRequest, pb.StatusResponse]) error {
+	s.streams <- struct{}{}
+	select {
+	case <-time.After(s.hold):
+	case <-stream.Context().Done():
+	}
+	return nil
+}
+
+func startFakeSyncServer(t *testing.T, hold time.Duration) (string, *fakeSyncServer) {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake := &fakeSyncServer{hold: hold, streams: make(chan struct{}, 100)}
+	server := grpc.NewServer()
+	pb.RegisterHASyncServiceServer(server, fake)
+	go server.Serve(lis)
+	t.Cleanup(server.Stop)
+	return lis.Addr().String(), fake
+}
+
+func newTestStreamClient(t *testing.T, addr string, stableAfter time.Duration) *StreamClient[pb.StatusRequest, pb.StatusResponse] {
+	t.Helper()
+	c := NewStreamClient(StreamClientOptions{
+		Name:           "test",
+		Address:        addr,
+		Creds:          insecure.NewCredentials(),
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     5 * time.Millisecond,
+		StableAfter:    stableAfter,
+	}, func(ctx context.Context, conn *grpc.ClientConn) (grpc.BidiStreamingClient[pb.StatusRequest, pb.StatusResponse], error) {
+		return pb.NewHASyncServiceClient(conn).ExchangeStatus(ctx)
+	})
+	t.Cleanup(c.Close)
+	return c
+}
+
+// 等 server 收到 n 個 stream
+func waitStreams(t *testing.T, fake *fakeSyncServer, n int) {
+	t.Helper()
+	for range n {
+		select {
+		case <-fake.streams:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("server did not get %d streams", n)
+		}
+	}
+}
+
+func TestStreamClientBackoff(t *testing.T) {
+	c := NewStreamClient[pb.StatusRequest, pb.StatusResponse](StreamClientOptions{
+		InitialBackoff: 100 * time.Millisecond,
+		MaxBackoff:     time.Second,
+	}, nil)
+	tests := []struct {
+		retries int
+		want    time.Duration
+	}{
+		{1, 100 * time.Millisecond},
+		{2, 200 * time.Millisecond},
+		{4, 800 * time.Millisecond},
+		// 超過上限就用上限
+		{5, time.Second},
+		{30, time.Second},
+	}
+	for _, tt := range tests {
+		for range 20 {
+			got := c.backoff(tt.retries)
+			lo, hi := time.Duration(float64(tt.want)*0.8), time.Duration(float64(tt.want)*1.2)
+			if got < lo || got > hi {
+				t.Errorf("backoff(%d) = %v, want %v ± 20%%", tt.retries, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestStreamClientRetriesNotResetByShortStreams(t *testing.T) {
+	// server 一建立 stream 就關掉 (例如被拒絕) 每次都算失敗 不能歸零
+	addr, fake := startFakeSyncServer(t, 0)
+	c := newTestStreamClient(t, addr, time.Hour)
+	go c.Run()
+
+	waitStreams(t, fake, 4)
+	if stats := c.Stats(); stats.Retries < 3 {
+		t.Errorf("retries = %d after 4 short streams, want them to keep counting", stats.Retries)
+	}
+}
+
+func TestStreamClientRetriesResetAfterStable(t *testing.T) {
+	addr, fake := startFakeSyncServer(t, 50*time.Millisecond)
+	c := newTestStreamClient(t, addr, 10*time.Millisecond)
+	go c.Run()
+
+	waitStreams(t, fake, 4)
+	stats := c.Stats()
+	// 每個 stream 都維持超過 StableAfter 斷線後只算第一次重試
+	if stats.Retries > 1 {
+		t.Errorf("retries = %d, want reset after each stable stream", stats.Retries)
+	}
+	if stats.Reconnects < 3 {
+		t.Errorf("reconnects = %d, want at least 3", stats.Reconnects)
+	}
+}
+
+func TestStreamClientReconnect(t *testing.T) {
+	addr, fake := startFakeSyncServer(t, time.Hour)
+	c := newTestStreamClient(t, addr, time.Hour)
+
+	err := c.Send(&pb.StatusRequest{})
+	if !errors.Is(err, ErrNotConnected) || errors.Is(err, io.EOF) {
+		t.Fatalf("Send before Run: err = %v, want ErrNotConnected and not io.EOF", err)
+	}
+
+	go c.Run()
+	waitStreams(t, fake, 1)
+	deadline := time.Now().Add(5 * time.Second)
+	for !c.IsReady() && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if err := c.Send(&pb.StatusRequest{}); err != nil {
+		t.Fatalf("Send when ready: %v", err)
+	}
+
+	c.Reconnect()
+	waitStreams(t, fake, 1)
+	if stats := c.Stats(); stats.Reconnects != 1 {
+		t.Errorf("reconnects = %d, want 1", stats.Reconnects)
+	}
+
+	c.Close()
+	for c.Stats().State != StateClosed && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if state := c.Stats().State; state != StateClosed {
+		t.Errorf("state after Close = %v, want closed", state)
+	}
+}
@@ -0,0 +1,290 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"kenmec/ha/jimmy/config"
+	"log"
+	"net"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// 憑證檔案的載入器 每次 handshake 都會檢查檔案有沒有被換掉
+// 換掉就重新載入 載入失敗則繼續用舊的憑證
+type certReloader struct {
+	cfg config.TLSConfig
+
+	mu       sync.Mutex
+	cert     *tls.Certificate
+	pool     *x509.CertPool
+	modTimes map[string]time.Time
+}
+
+func newCertReloader(cfg config.TLSConfig) (*certReloader, error) {
+	r := &certReloader{cfg: cfg}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *certReloader) files() []string {
+	var files []string
+	for _, f := range []string{r.cfg.CA_FILE, r.cfg.CERT_FILE, r.cfg.KEY_FILE} {
+		if f != "" {
+			files = append(files, f)
+		}
+	}
+	return files
+}
+
+func (r *certReloader) load() error {
+	modTimes := map[string]time.Time{}
+	for _, f := range r.files() {
+		info, err := os.Stat(f)
+		if err != nil {
+			return err
+		}
+		modTimes[f] = info.ModTime()
+	}
+
+	var cert *tls.Certificate
+	if r.cfg.CERT_FILE != "" || r.cfg.KEY_FILE != "" {
+		c, err := tls.LoadX509KeyPair(r.cfg.CERT_FILE, r.cfg.KEY_FILE)
+		if err != nil {
+			return fmt.Errorf("載入憑證失敗: %w", err)
+		}
+		cert = &c
+	}
+
+	var pool *x509.CertPool
+	if r.cfg.CA_FILE != "" {
+		pem, err := os.ReadFile(r.cfg.CA_FILE)
+		if err != nil {
+			return err
+		}
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("CA 檔案 %s 裡沒有可用的憑證", r.cfg.CA_FILE)
+		}
+	}
+
+	r.mu.Lock()
+	r.cert = cert
+	r.pool = pool
+	r.modTimes = modTimes
+	r.mu.Unlock()
+	return nil
+}
+
+func (r *certReloader) changed() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, f := range r.files() {
+		info, err := os.Stat(f)
+		if err != nil {
+			return false
+		}
+		if !info.ModTime().Equal(r.modTimes[f]) {
+			return true
+		}
+	}
+	return false
+}
+
+// 取得目前的憑證以及 CA
+func (r *certReloader) current() (*tls.Certificate, *x509.CertPool) {
+	if r.changed() {
+		if err := r.load(); err != nil {
+			config.LogErrorf("❌ 重新載入 TLS 憑證失敗 繼續使用舊憑證: %v", err)
+		} else {
+			log.Printf("🔐 TLS 憑證已重新載入")
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.cert, r.pool
+}
+
+// 檢查對方憑證是否為 PEER_NAMES / PEER_SHA256 指定的
+func verifyPinnedPeer(cfg config.TLSConfig, leaf *x509.Certificate) error {
+	if len(cfg.PEER_SHA256) > 0 {
+		sum := sha256.Sum256(leaf.Raw)
+		fingerprint := hex.EncodeToString(sum[:])
+
+		if !slices.ContainsFunc(cfg.PEER_SHA256, func(pin string) bool {
+			return strings.EqualFold(strings.ReplaceAll(pin, ":", ""), fingerprint)
+		}) {
+			return fmt.Errorf("對方憑證指紋 %s 不在允許清單中", fingerprint)
+		}
+	}
+
+	if len(cfg.PEER_NAMES) > 0 {
+		names := CertificateNames(leaf)
+		if !slices.ContainsFunc(names, func(name string) bool {
+			return slices.Contains(cfg.PEER_NAMES, name)
+		}) {
+			return fmt.Errorf("對方憑證名稱 %v 不在允許清單中", names)
+		}
+	}
+
+	return nil
+}
+
+// CertificateNames 回傳憑證上的 CN 以及所有 SAN
+func CertificateNames(cert *x509.Certificate) []string {
+	var names []string
+	if cert.Subject.CommonName != "" {
+		names = append(names, cert.Subject.CommonName)
+	}
+	names = append(names, cert.DNSNames...)
+	for _, ip := range cert.IPAddresses {
+		names = append(names, ip.String())
+	}
+	return names
+}
+
+// ServerCredentials 建立 gRPC server 用的憑證 沒開 TLS 時回傳 nil
+func ServerCredentials(cfg config.TLSConfig) (credentials.TransportCredentials, error) {
+	if !cfg.ENABLED {
+		return nil, nil
+	}
+	if cfg.CERT_FILE == "" || cfg.KEY_FILE == "" {
+		return nil, errors.New("server 端 TLS 需要 CERT_FILE 以及 KEY_FILE")
+	}
+
+	reloader, err := newCertReloader(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	base := &tls.Config{MinVersion: tls.VersionTLS12}
+	base.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		cert, pool := reloader.current()
+
+		c := base.Clone()
+		c.GetConfigForClient = nil
+		c.Certificates = []tls.Certificate{*cert}
+		if pool != nil {
+			c.ClientCAs = pool
+			c.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+		c.VerifyConnection = func(cs tls.ConnectionState) error {
+			if len(cs.PeerCertificates) == 0 {
+				if len(cfg.PEER_NAMES) > 0 || len(cfg.PEER_SHA256) > 0 {
+					return errors.New("對方沒有出示憑證")
+				}
+				return nil
+			}
+			return verifyPinnedPeer(cfg, cs.PeerCertificates[0])
+		}
+		return c, nil
+	}
+
+	return credentials.NewTLS(base), nil
+}
+
+// ClientCredentials 建立 gRPC client 用的憑證 沒開 TLS 時回傳 insecure
+func ClientCredentials(cfg config.TLSConfig) (credentials.TransportCredentials, error) {
+	if !cfg.ENABLED {
+		return insecure.NewCredentials(), nil
+	}
+
+	reloader, err := newCertReloader(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	// CA 會被換掉 所以不用 tls 內建的驗證 改在 VerifyConnection 用目前的 CA 驗證
+	base := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: true,
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			cert, _ := reloader.current()
+			if cert == nil {
+				return &tls.Certificate{}, nil
+			}
+			return cert, nil
+		},
+	}
+	return &clientCredentials{
+		TransportCredentials: credentials.NewTLS(base),
+		cfg:                  cfg,
+		base:                 base,
+		reloader:             reloader,
+	}, nil
+}
+
+// gRPC client 的憑證 每次連線都用 SERVER_NAME (空白時用連線位址的 host 或 IP) 驗證 server 憑證
+// 連 IP 時不會送 SNI ConnectionState 的 ServerName 是空白 所以要驗證的名稱在連線前就決定
+type clientCredentials struct {
+	credentials.TransportCredentials
+	cfg      config.TLSConfig
+	base     *tls.Config
+	reloader *certReloader
+}
+
+func (c *clientCredentials) ClientHandshake(ctx context.Context, authority string, conn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	name := c.cfg.SERVER_NAME
+	if name == "" {
+		host, _, err := net.SplitHostPort(authority)
+		if err != nil {
+			host = authority
+		}
+		name = host
+	}
+	if name == "" {
+		return nil, nil, errors.New("沒有 SERVER_NAME 也無法從連線位址取得 server 名稱")
+	}
+
+	tc := c.base.Clone()
+	tc.ServerName = name
+	tc.VerifyConnection = func(cs tls.ConnectionState) error {
+		return c.verifyServer(cs, name)
+	}
+	return credentials.NewTLS(tc).ClientHandshake(ctx, authority, conn)
+}
+
+// 用目前的 CA 驗證 server 憑證 name 可以是 DNS 名稱或 IP (比對 IP SAN)
+func (c *clientCredentials) verifyServer(cs tls.ConnectionState, name string) error {
+	if len(cs.PeerCertificates) == 0 {
+		return errors.New("server 沒有出示憑證")
+	}
+
+	_, pool := c.reloader.current()
+	intermediates := x509.NewCertPool()
+	for _, cert := range cs.PeerCertificates[1:] {
+		intermediates.AddCert(cert)
+	}
+
+	leaf := cs.PeerCertificates[0]
+	if _, err := leaf.Verify(x509.VerifyOptions{
+		Roots:         pool,
+		Intermediates: intermediates,
+		DNSName:       name,
+	}); err != nil {
+		return err
+	}
+
+	return verifyPinnedPeer(c.cfg, leaf)
+}
+
+func (c *clientCredentials) Clone() credentials.TransportCredentials {
+	clone := *c
+	clone.TransportCredentials = c.TransportCredentials.Clone()
+	return &clone
+}
@@ -0,0 +1,170 @@
+package api
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"kenmec/ha/jimmy/config"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	file string
+}
+
+func newTestCA(t *testing.T, dir string) testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	file := filepath.Join(dir, "ca.pem")
+	writePEM(t, file, "CERTIFICATE", der)
+	return testCA{cert: cert, key: key, file: file}
+}
+
+// 用 CA 簽一張 server 憑證
+func (ca testCA) issue(t *testing.T, serial int64, dnsNames []string, ips []net.IP) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "server"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		DNSNames:     dnsNames,
+		IPAddresses:  ips,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func writePEM(t *testing.T, file, typ string, der []byte) {
+	t.Helper()
+	if err := os.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// 用 creds 跟出示 serverCert 的 server 做一次 handshake
+func handshake(t *testing.T, cfg config.TLSConfig, serverCert tls.Certificate, authority string) error {
+	t.Helper()
+	creds, err := ClientCredentials(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		server := tls.Server(conn, &tls.Config{
+			Certificates: []tls.Certificate{serverCert},
+			NextProtos:   []string{"h2"},
+		})
+		server.Handshake()
+		server.Close()
+	}()
+
+	// authority 是要驗證的位址 實際上連到測試的 listener
+	clientConn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer clientConn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, _, err := creds.ClientHandshake(ctx, authority, clientConn)
+	if conn != nil {
+		conn.Close()
+	}
+	return err
+}
+
+func TestClientCredentialsVerifiesServerName(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t, dir)
+	good := ca.issue(t, 2, []string{"node-b"}, []net.IP{net.ParseIP("127.0.0.1")})
+	// 同一個 CA 簽的 但是名稱不對
+	wrong := ca.issue(t, 3, []string{"node-x"}, []net.IP{net.ParseIP("127.0.0.9")})
+
+	byAddr := config.TLSConfig{ENABLED: true, CA_FILE: ca.file}
+	byName := config.TLSConfig{ENABLED: true, CA_FILE: ca.file, SERVER_NAME: "node-b"}
+
+	tests := []struct {
+		name      string
+		cfg       config.TLSConfig
+		cert      tls.Certificate
+		authority string
+		ok        bool
+	}{
+		{"IP SAN matches dialed IP", byAddr, good, "127.0.0.1:50052", true},
+		{"wrong SAN for dialed IP", byAddr, wrong, "127.0.0.1:50052", false},
+		{"DNS SAN matches dialed host", byAddr, good, "node-b:50052", true},
+		{"wrong SAN for dialed host", byAddr, wrong, "node-b:50052", false},
+		{"SERVER_NAME matches", byName, good, "127.0.0.9:50052", true},
+		{"SERVER_NAME overrides dialed IP", byName, wrong, "127.0.0.9:50052", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := handshake(t, tt.cfg, tt.cert, tt.authority)
+			if tt.ok && err != nil {
+				t.Fatalf("handshake failed: %v", err)
+			}
+			if !tt.ok && err == nil {
+				t.Fatal("handshake succeeded with a certificate for the wrong name")
+			}
+		})
+	}
+}
+
+func TestClientCredentialsRejectsOtherCA(t *testing.T) {
+	ca := newTestCA(t, t.TempDir())
+	other := newTestCA(t, t.TempDir())
+	cert := other.issue(t, 2, []string{"node-b"}, nil)
+
+	err := handshake(t, config.TLSConfig{ENABLED: true, CA_FILE: ca.file}, cert, "node-b:50052")
+	if err == nil {
+		t.Fatal("handshake succeeded with a certificate from another CA")
+	}
+}
@@ -0,0 +1,278 @@
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"kenmec/ha/jimmy/config"
+	"log"
+	"net"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// UDP 心跳封包格式 (big endian) HMAC 包含送出的節點名稱
+//
+//	magic "HAHB" | version | flags | seq uint64 | epoch uint64 | boot id uint64 | sent at (unix nano) |
+//	node id 長度 uint8 | node id | HMAC-SHA256
+const (
+	udpHbMagic     = "HAHB"
+	udpHbVersion   = 2
+	udpHbHeaderLen = 4 + 1 + 1 + 8 + 8 + 8 + 8 + 1
+
+	// 另外一台重開後第一個封包的時間 與本機時間最多可以差多少
+	udpHbMaxSkew = 30 * time.Second
+	// 時間相差太多的警告 最多多久寫一次
+	udpHbSkewWarnInterval = time.Minute
+	// 記住幾個另外一台以前的 boot id 重開之後不再接受這些 boot id 的封包
+	udpHbRetiredBoots = 16
+)
+
+const (
+	udpFlagMaster = 1 << iota
+	udpFlagECS
+	udpFlagFleet
+	udpFlagMaintenance
+)
+
+// UDPHeartbeat 是透過 UDP 送的輕量心跳 跟 gRPC stream 分開
+// 用來分辨「程式還活著但 stream 卡住」以及「整台不見」
+type UDPHeartbeat struct {
+	Seq         uint64    `json:"seq"`
+	Epoch       uint64    `json:"epoch"` // 角色變更的次數
+	BootID      uint64    `json:"boot_id"`
+	NodeID      string    `json:"node_id"`
+	SentAt      time.Time `json:"sent_at"`
+	IsMaster    bool      `json:"is_master"`
+	ECS         bool      `json:"ecs"`
+	Fleet       bool      `json:"fleet"`
+	Maintenance bool      `json:"maintenance"`
+}
+
+func (h UDPHeartbeat) encode(key []byte) []byte {
+	nodeID := h.NodeID[:min(len(h.NodeID), 255)]
+	buf := make([]byte, udpHbHeaderLen, udpHbHeaderLen+len(nodeID)+sha256.Size)
+	copy(buf, udpHbMagic)
+	buf[4] = udpHbVersion
+
+	var flags byte
+	if h.IsMaster {
+		flags |= udpFlagMaster
+	}
+	if h.ECS {
+		flags |= udpFlagECS
+	}
+	if h.Fleet {
+		flags |= udpFlagFleet
+	}
+	if h.Maintenance {
+		flags |= udpFlagMaintenance
+	}
+	buf[5] = flags
+
+	binary.BigEndian.PutUint64(buf[6:], h.Seq)
+	binary.BigEndian.PutUint64(buf[14:], h.Epoch)
+	binary.BigEndian.PutUint64(buf[22:], h.BootID)
+	binary.BigEndian.PutUint64(buf[30:], uint64(h.SentAt.UnixNano()))
+	buf[38] = byte(len(nodeID))
+	buf = append(buf, nodeID...)
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write(buf)
+	return mac.Sum(buf)
+}
+
+func decodeUDPHeartbeat(buf []byte, key []byte) (UDPHeartbeat, error) {
+	if len(buf) < udpHbHeaderLen || string(buf[:4]) != udpHbMagic {
+		return UDPHeartbeat{}, errors.New("不是心跳封包")
+	}
+	if buf[4] != udpHbVersion {
+		return UDPHeartbeat{}, errors.New("心跳封包版本不符")
+	}
+	bodyLen := udpHbHeaderLen + int(buf[38])
+	if len(buf) != bodyLen+sha256.Size {
+		return UDPHeartbeat{}, errors.New("心跳封包長度不符")
+	}
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write(buf[:bodyLen])
+	if !hmac.Equal(mac.Sum(nil), buf[bodyLen:]) {
+		return UDPHeartbeat{}, errors.New("心跳封包驗證失敗")
+	}
+
+	flags := buf[5]
+	return UDPHeartbeat{
+		Seq:         binary.BigEndian.Uint64(buf[6:]),
+		Epoch:       binary.BigEndian.Uint64(buf[14:]),
+		BootID:      binary.BigEndian.Uint64(buf[22:]),
+		SentAt:      time.Unix(0, int64(binary.BigEndian.Uint64(buf[30:]))),
+		NodeID:      string(buf[udpHbHeaderLen:bodyLen]),
+		IsMaster:    flags&udpFlagMaster != 0,
+		ECS:         flags&udpFlagECS != 0,
+		Fleet:       flags&udpFlagFleet != 0,
+		Maintenance: flags&udpFlagMaintenance != 0,
+	}, nil
+}
+
+type UDPHeartbeatChannel struct {
+	port       string
+	targets    []string
+	key        []byte
+	nodeID     string
+	peerNodeID string
+	bootID     uint64
+	seq        atomic.Uint64
+
+	mu         sync.Mutex
+	conn       *net.UDPConn
+	lastBootID uint64
+	lastSeq    uint64   // lastBootID 收過最大的 seq
+	retired    []uint64 // 另外一台以前的 boot id
+	skewWarnAt time.Time
+	skewDrops  int // 上次警告之後因為時間相差丟掉的封包
+
+	//用類似callback的方式 可以在其他地方呼叫用
+	OnReceive func(hb UDPHeartbeat)
+}
+
+// peerIPs 是另外一台在每條網路上的 IP 心跳會送到每一個
+// 只接受 peerNodeID 送出的封包
+func NewUDPHeartbeatChannel(port string, peerIPs []string, key, nodeID, peerNodeID string) *UDPHeartbeatChannel {
+	var bootID [8]byte
+	rand.Read(bootID[:])
+
+	targets := make([]string, 0, len(peerIPs))
+	for _, ip := range peerIPs {
+		targets = append(targets, net.JoinHostPort(ip, port))
+	}
+
+	return &UDPHeartbeatChannel{
+		port:       port,
+		targets:    targets,
+		key:        []byte(key),
+		nodeID:     nodeID,
+		peerNodeID: peerNodeID,
+		bootID:     binary.BigEndian.Uint64(bootID[:]),
+	}
+}
+
+func (u *UDPHeartbeatChannel) Listen() {
+	addr, err := net.ResolveUDPAddr("udp", ":"+u.port)
+	if err != nil {
+		config.LogErrorf("❌ UDP 心跳位址錯誤: %v", err)
+		return
+	}
+	conn, err := net.ListenUDP("udp", addr)
+	if err != nil {
+		config.LogErrorf("❌ UDP 心跳監聽失敗: %v", err)
+		return
+	}
+	u.mu.Lock()
+	u.conn = conn
+	u.mu.Unlock()
+	log.Printf("🚀 UDP 心跳啟動於 :%s", u.port)
+
+	buf := make([]byte, 512)
+	for {
+		n, from, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			config.LogErrorf("❌ UDP 心跳接收錯誤: %v", err)
+			return
+		}
+
+		hb, err := decodeUDPHeartbeat(buf[:n], u.key)
+		if err != nil {
+			config.LogWarnf("⚠️  丟棄來自 %s 的 UDP 封包: %v", from, err)
+			continue
+		}
+		if err := u.accept(hb, time.Now()); err != nil {
+			continue
+		}
+
+		if u.OnReceive != nil {
+			u.OnReceive(hb)
+		}
+	}
+}
+
+// 防止重送舊封包以及自己的封包被送回來
+// 同一個 boot id 的 seq 必須遞增 另外一台重開 (boot id 變了) 之後不再接受以前的 boot id
+// 新的 boot id 封包時間必須跟本機差不多
+func (u *UDPHeartbeatChannel) accept(hb UDPHeartbeat, now time.Time) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if hb.BootID == u.bootID {
+		return errors.New("本機送出的封包")
+	}
+	if hb.NodeID != u.peerNodeID {
+		return fmt.Errorf("節點名稱 %q 不是設定的 %q", hb.NodeID, u.peerNodeID)
+	}
+
+	if hb.BootID == u.lastBootID {
+		if hb.Seq <= u.lastSeq {
+			return fmt.Errorf("seq %d 不大於 %d", hb.Seq, u.lastSeq)
+		}
+		u.lastSeq = hb.Seq
+		return nil
+	}
+
+	if slices.Contains(u.retired, hb.BootID) {
+		return fmt.Errorf("boot id %x 已經重開過", hb.BootID)
+	}
+	skew := now.Sub(hb.SentAt)
+	if skew > udpHbMaxSkew || skew < -udpHbMaxSkew {
+		// 另外一台時鐘不準時每個封包都會被丟掉 警告不要每次都寫
+		u.skewDrops++
+		if now.Sub(u.skewWarnAt) >= udpHbSkewWarnInterval {
+			config.LogWarnf("⚠️  丟棄 UDP 心跳: 時間相差 %v (%s 內共 %d 個)", skew.Round(time.Second), udpHbSkewWarnInterval, u.skewDrops)
+			u.skewWarnAt = now
+			u.skewDrops = 0
+		}
+		return fmt.Errorf("時間相差 %v", skew.Round(time.Second))
+	}
+
+	if u.lastBootID != 0 {
+		u.retired = append(u.retired, u.lastBootID)
+		if len(u.retired) > udpHbRetiredBoots {
+			u.retired = u.retired[1:]
+		}
+	}
+	u.lastBootID = hb.BootID
+	u.lastSeq = hb.Seq
+	return nil
+}
+
+// 送出心跳到另外一台的每個位址 seq、boot id、時間會在這裡填
+func (u *UDPHeartbeatChannel) Send(hb UDPHeartbeat) error {
+	u.mu.Lock()
+	conn := u.conn
+	u.mu.Unlock()
+	if conn == nil {
+		return errors.New("UDP 心跳尚未啟動")
+	}
+
+	hb.Seq = u.seq.Add(1)
+	hb.BootID = u.bootID
+	hb.NodeID = u.nodeID
+	hb.SentAt = time.Now()
+	packet := hb.encode(u.key)
+
+	var lastErr error
+	for _, target := range u.targets {
+		addr, err := net.ResolveUDPAddr("udp", target)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if _, err := conn.WriteToUDP(packet, addr); err != nil {
+			lastErr = err
+		}
+	}
+	return lastErr
+}
@@ -0,0 +1,128 @@
+package api
+
+import (
+	"testing"
+	"time"
+)
+
+func TestUDPHeartbeatEncodeDecode(t *testing.T) {
+	key := []byte("key")
+	hb := UDPHeartbeat{
+		Seq:         7,
+		Epoch:       3,
+		BootID:      0xdeadbeef,
+		NodeID:      "ha-b",
+		SentAt:      time.Unix(1700000000, 123),
+		IsMaster:    true,
+		Fleet:       true,
+		Maintenance: true,
+	}
+	packet := hb.encode(key)
+
+	got, err := decodeUDPHeartbeat(packet, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != hb {
+		t.Errorf("decoded %+v, want %+v", got, hb)
+	}
+
+	tamper := func(i int) []byte {
+		p := append([]byte{}, packet...)
+		p[i] ^= 1
+		return p
+	}
+	tests := []struct {
+		name   string
+		packet []byte
+		key    []byte
+	}{
+		{"wrong key", packet, []byte("other")},
+		{"flags changed", tamper(5), key},
+		{"seq changed", tamper(13), key},
+		// 節點名稱也在 HMAC 裡 改名稱會驗證失敗
+		{"node id changed", tamper(udpHbHeaderLen), key},
+		{"mac changed", tamper(len(packet) - 1), key},
+		{"truncated", packet[:len(packet)-1], key},
+		{"node id length too long", tamper(38), key},
+		{"old version", tamper(4), key},
+		{"not a heartbeat", []byte("hello"), key},
+	}
+	for _, tt := range tests {
+		if _, err := decodeUDPHeartbeat(tt.packet, tt.key); err == nil {
+			t.Errorf("%s: decoded without error", tt.name)
+		}
+	}
+}
+
+func TestUDPHeartbeatAccept(t *testing.T) {
+	now := time.Now()
+	const self, peerBoot, peerReboot = 1, 2, 3
+	hb := func(boot, seq uint64, node string, sentAt time.Time) UDPHeartbeat {
+		return UDPHeartbeat{BootID: boot, Seq: seq, NodeID: node, SentAt: sentAt}
+	}
+
+	tests := []struct {
+		name    string
+		packets []UDPHeartbeat
+		want    []bool
+	}{
+		{"seq increases", []UDPHeartbeat{hb(peerBoot, 1, "ha-b", now), hb(peerBoot, 2, "ha-b", now), hb(peerBoot, 5, "ha-b", now)}, []bool{true, true, true}},
+		{"replayed seq", []UDPHeartbeat{hb(peerBoot, 5, "ha-b", now), hb(peerBoot, 5, "ha-b", now), hb(peerBoot, 4, "ha-b", now)}, []bool{true, false, false}},
+		// 自己送出的封包被送回來 boot id 不一樣也不接受
+		{"own packet reflected", []UDPHeartbeat{hb(self, 1, "ha-a", now)}, []bool{false}},
+		{"own node id with another boot", []UDPHeartbeat{hb(peerBoot, 1, "ha-a", now)}, []bool{false}},
+		{"unknown node", []UDPHeartbeat{hb(peerBoot, 1, "ha-x", now)}, []bool{false}},
+		{"peer reboot", []UDPHeartbeat{hb(peerBoot, 100, "ha-b", now), hb(peerReboot, 1, "ha-b", now)}, []bool{true, true}},
+		// 重開之後 以前的 boot id 跟新的交替重送 都不能重設 seq
+		{"alternating boot ids", []UDPHeartbeat{
+			hb(peerBoot, 100, "ha-b", now),
+			hb(peerReboot, 1, "ha-b", now),
+			hb(peerBoot, 101, "ha-b", now),
+			hb(peerReboot, 1, "ha-b", now),
+			hb(peerReboot, 2, "ha-b", now),
+		}, []bool{true, true, false, false, true}},
+		{"new boot with skewed clock", []UDPHeartbeat{hb(peerBoot, 1, "ha-b", now.Add(-udpHbMaxSkew-time.Second))}, []bool{false}},
+		{"new boot from the future", []UDPHeartbeat{hb(peerBoot, 1, "ha-b", now.Add(udpHbMaxSkew+time.Second))}, []bool{false}},
+		// 同一個 boot id 只看 seq 不看時間
+		{"same boot old timestamp", []UDPHeartbeat{hb(peerBoot, 1, "ha-b", now), hb(peerBoot, 2, "ha-b", now.Add(-time.Hour))}, []bool{true, true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := NewUDPHeartbeatChannel("0", nil, "key", "ha-a", "ha-b")
+			u.bootID = self
+			for i, p := range tt.packets {
+				if err := u.accept(p, now); (err == nil) != tt.want[i] {
+					t.Errorf("packet %d (boot %d seq %d node %s): err = %v, want accepted = %v", i, p.BootID, p.Seq, p.NodeID, err, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestUDPHeartbeatSkewWarningRateLimited(t *testing.T) {
+	u := NewUDPHeartbeatChannel("0", nil, "key", "ha-a", "ha-b")
+	now := time.Now()
+	skewed := func(boot uint64, at time.Time) UDPHeartbeat {
+		return UDPHeartbeat{BootID: boot, Seq: 1, NodeID: "ha-b", SentAt: at.Add(-time.Hour)}
+	}
+
+	u.accept(skewed(2, now), now)
+	warnedAt := u.skewWarnAt
+	if !warnedAt.Equal(now) {
+		t.Fatalf("first skewed packet: warned at %v, want %v", warnedAt, now)
+	}
+	for i := range 10 {
+		at := now.Add(time.Duration(i+1) * time.Second)
+		u.accept(skewed(2, at), at)
+	}
+	if !u.skewWarnAt.Equal(warnedAt) || u.skewDrops != 10 {
+		t.Errorf("warned at %v with %d drops pending, want no new warning within %v", u.skewWarnAt, u.skewDrops, udpHbSkewWarnInterval)
+	}
+
+	later := now.Add(udpHbSkewWarnInterval)
+	u.accept(skewed(2, later), later)
+	if !u.skewWarnAt.Equal(later) || u.skewDrops != 0 {
+		t.Errorf("warned at %v with %d drops pending, want a new warning after %v", u.skewWarnAt, u.skewDrops, udpHbSkewWarnInterval)
+	}
+}
@@ -1,38 +1,201 @@
 package config
 
 import (
-	"log"
-	"os"
-
-	"github.com/goccy/go-yaml"
+	"net"
+	"sync/atomic"
 )
 
+// peer tag 是兩台HA互相比對設定時用的規則 (見 peer.go)
+// peer:"same" 代表兩台必須一樣, peer:"<KEY>" 代表必須等於另外一台的 <KEY>
+// peer:"in:<KEY>" / peer:"has:<KEY>" 比對位址列表 (見 ComparePeer)
+// secret:"true" 的欄位送到另外一台前會被遮蔽
+// reload:"live" 的欄位可以在執行中重新載入 (見 reload.go) 其他的要重開程式
 type Config struct {
-	FLEET_HB_INTERVAL int32 `yaml:"FLEET_HB_INTERVAL"`
-	FLEET_HB_TIMEOUT  int32 `yaml:"FLEET_HB_TIMEOUT"`
+	FLEET_HB_INTERVAL Duration `yaml:"FLEET_HB_INTERVAL" peer:"same" reload:"live"`
+	FLEET_HB_TIMEOUT  Duration `yaml:"FLEET_HB_TIMEOUT" peer:"same" reload:"live"`
+
+	OTHER_HA_HB_INTERVAL Duration `yaml:"OTHER_HA_HB_INTERVAL" peer:"same" reload:"live"`
+	OTHER_HA_HB_TIMEOUT  Duration `yaml:"OTHER_HA_HB_TIMEOUT" peer:"same" reload:"live"`
+
+	// phi accrual 偵測的門檻 超過就判定心跳中斷 沒有設定時是 8
+	// 不管 phi 多少 超過上面的 TIMEOUT 一定判定中斷 設成負數就只看 TIMEOUT
+	FLEET_PHI_THRESHOLD    float64 `yaml:"FLEET_PHI_THRESHOLD" peer:"same" reload:"live"`
+	OTHER_HA_PHI_THRESHOLD float64 `yaml:"OTHER_HA_PHI_THRESHOLD" peer:"same" reload:"live"`
+	// 用最近幾次心跳間隔計算分佈 預設 100
+	PHI_WINDOW int `yaml:"PHI_WINDOW"`
+	// 標準差的下限 (毫秒) 避免很穩定的網路一點延遲就誤判 預設 100
+	PHI_MIN_STD_MS int `yaml:"PHI_MIN_STD_MS"`
+
+	VIP string `yaml:"VIP" peer:"same"`
+
+	// 本機以及另外一台的節點名稱 另外一台連進來時必須帶 PEER_NODE_ID 才接受
+	NODE_ID      string `yaml:"NODE_ID" peer:"PEER_NODE_ID"`
+	PEER_NODE_ID string `yaml:"PEER_NODE_ID" peer:"NODE_ID"`
+	// 只接受這些來源位址 (IP 或 CIDR) 的HA連線 空白代表只接受另外一台的 CLIENT_IP / CLIENT_IPS
+	PEER_ALLOWED_ADDRS []string `yaml:"PEER_ALLOWED_ADDRS"`
+
+	// 本機的 IP 必須是另外一台的 CLIENT_IP / CLIENT_IPS 其中一個 空白代表不比對
+	SERVER_IP   string `yaml:"SERVER_IP" peer:"in:CLIENT_IP,CLIENT_IPS"`
+	SERVER_PORT string `yaml:"SERVER_PORT" peer:"CLIENT_PORT"`
+	// 另外一台的 IP 必須等於另外一台的 SERVER_IP
+	CLIENT_IP   string `yaml:"CLIENT_IP" peer:"has:SERVER_IP"`
+	CLIENT_PORT string `yaml:"CLIENT_PORT" peer:"SERVER_PORT"`
+	// 另外一台在每條網路上的 IP 一條網路一個 有設定時取代 CLIENT_IP (這時 CLIENT_IP 可以留空)
+	// 兩台的順序要一樣 (第 N 個都是同一條網路) 必須包含另外一台的 SERVER_IP
+	CLIENT_IPS []string `yaml:"CLIENT_IPS" peer:"has:SERVER_IP"`
+
+	// 另外一條走 UDP 的心跳 空白代表不啟用 兩台必須一樣
+	UDP_HB_PORT string `yaml:"UDP_HB_PORT" peer:"same"`
+	// UDP 心跳 HMAC 用的共用金鑰
+	UDP_HB_KEY string `yaml:"UDP_HB_KEY" secret:"true"`
+
+	// HA gRPC port 上除錯用的服務
+	GRPC_REFLECTION bool `yaml:"GRPC_REFLECTION"`
+	GRPC_CHANNELZ   bool `yaml:"GRPC_CHANNELZ"`
+
+	// 本機的交管 一個交管一個連線 預設只有 localhost:50051 一個
+	FLEETS []FleetConfig `yaml:"FLEETS"`
+	// 從另外一台同步過來的資料 依照這個欄位 (例如 area_type) 送到對應的交管
+	// 空白或資料裡沒有這個欄位時 送給所有交管
+	FLEET_ROUTE_KEY string `yaml:"FLEET_ROUTE_KEY" peer:"same" reload:"live"`
+	// 有多個交管時 幾個正常才算交管正常: all、any、majority 或數字 預設 all
+	FLEET_HEALTH_RULE string `yaml:"FLEET_HEALTH_RULE" peer:"same" reload:"live"`
 
-	OTHER_HA_HB_INTERVAL int32 `yaml:"OTHER_HA_HB_INTERVAL"`
-	OTHER_HA_HB_TIMEOUT  int32 `yaml:"OTHER_HA_HB_TIMEOUT"`
+	// 除了心跳以外 也用 grpc.health.v1 檢查交管 不是 SERVING 就算交管斷線
+	FLEET_HEALTH_CHECK   bool   `yaml:"FLEET_HEALTH_CHECK" reload:"live"`
+	FLEET_HEALTH_SERVICE string `yaml:"FLEET_HEALTH_SERVICE" reload:"live"` // 空白代表整個 server
 
-	VIP string `yaml:"VIP"`
+	// 定時送 probe 給交管 交管要經過訊息處理流程送回 預設 0 不啟用 (交管沒有實作 probe_echo 時不能打開)
+	FLEET_PROBE_INTERVAL Duration `yaml:"FLEET_PROBE_INTERVAL" reload:"live"`
+	// 超過多久沒有收到 echo 判定交管沒有在處理訊息 預設三次 probe
+	FLEET_PROBE_TIMEOUT Duration `yaml:"FLEET_PROBE_TIMEOUT" reload:"live"`
 
-	SERVER_IP   string `yaml:"SERVER_IP"`
-	SERVER_PORT string `yaml:"SERVER_PORT"`
-	CLIENT_IP   string `yaml:"CLIENT_IP"`
-	CLIENT_PORT string `yaml:"CLIENT_PORT"`
+	// 本機依賴的服務 (RabbitMQ、MySQL 等) 各自定時檢查 結果在 /health/<NAME>
+	DEPENDENCIES []DependencyConfig `yaml:"DEPENDENCIES"`
+	// /health/live、/health/ready、/health/failover 的判斷規則 (見 health.go)
+	HEALTH HealthConfig `yaml:"HEALTH"`
+
+	// 日誌等級 debug (預設 全部)、info、warn、error
+	LOG_LEVEL string `yaml:"LOG_LEVEL" reload:"live"`
 
 	WEB_API_PORT string `yaml:"WEB_API_PORT"`
+	// 另外一台的 REST API port dashboard 用來顯示另外一台 空白代表跟 WEB_API_PORT 一樣
+	PEER_WEB_API_PORT string        `yaml:"PEER_WEB_API_PORT"`
+	API_AUTH          APIAuthConfig `yaml:"API_AUTH"`
+
+	HA_TLS    TLSConfig `yaml:"HA_TLS"`    // 兩台HA之間的 gRPC
+	FLEET_TLS TLSConfig `yaml:"FLEET_TLS"` // 連到本機交管的 gRPC
+
+	// 產生 keepalived.conf 用 (見 keepalived.go)
+	KEEPALIVED KeepalivedConfig `yaml:"KEEPALIVED"`
+}
+
+// REST API 的權限設定
+// 沒有設定任何 token 時 查詢不用驗證 變更狀態只接受本機 (loopback 或 unix socket) 的請求
+type APIAuthConfig struct {
+	// 只能呼叫查詢類 API 的 token
+	READ_TOKENS []string `yaml:"READ_TOKENS" secret:"true"`
+	// 可以切換角色 / 維修模式的 token 也可以呼叫查詢類 API
+	OPERATOR_TOKENS []string `yaml:"OPERATOR_TOKENS" secret:"true"`
+	// dashboard 向另外一台查 /status (GET /peer/status) 用的 token 只有查詢權限 兩台要設一樣
+	// 不會轉送使用者自己的 token 另外一台有設定 token 時沒有這個就查不到
+	PEER_TOKEN string `yaml:"PEER_TOKEN" secret:"true"`
+
+	// 變更狀態的 API 只接受 loopback 或 unix socket 來的請求 預設 false (沒寫就接受遠端的請求)
+	LOCAL_ONLY_MUTATIONS bool `yaml:"LOCAL_ONLY_MUTATIONS"`
+	// 額外監聽的 unix socket 給 keepalived notify 腳本用 從這裡來的請求視為 operator
+	UNIX_SOCKET string `yaml:"UNIX_SOCKET"`
+
+	// 允許跨域的來源 空白代表不開放跨域
+	CORS_ORIGINS []string `yaml:"CORS_ORIGINS"`
+}
+
+// 本機的一個交管
+type FleetConfig struct {
+	NAME    string `yaml:"NAME"`
+	ADDRESS string `yaml:"ADDRESS"`
+	// FLEET_ROUTE_KEY 等於這些值的資料送到這個交管
+	// 空白代表沒有其他交管要收的資料都送到這裡
+	ROUTES []string `yaml:"ROUTES"`
+}
+
+// 一個依賴的服務 TYPE 決定怎麼檢查
+//
+//	tcp   連得上 ADDRESS
+//	amqp  ADDRESS 回應 AMQP 0-9-1 的 Connection.Start
+//	mysql ADDRESS 送出 MySQL 的 handshake
+//	http  GET URL 回應 2xx
+//	exec  執行 COMMAND 結束碼為 0
+type DependencyConfig struct {
+	NAME    string   `yaml:"NAME"`
+	TYPE    string   `yaml:"TYPE"`
+	ADDRESS string   `yaml:"ADDRESS"`
+	URL     string   `yaml:"URL"`
+	COMMAND []string `yaml:"COMMAND"`
+
+	INTERVAL Duration `yaml:"INTERVAL"` // 預設 2s
+	TIMEOUT  Duration `yaml:"TIMEOUT"`  // 預設 1s
+	RISE     int      `yaml:"RISE"`     // 連續成功幾次才算恢復 預設 2
+	FALL     int      `yaml:"FALL"`     // 連續失敗幾次才算異常 預設 2
+
+	// 異常時 /health 也算異常 (Connectivity.Deps)
+	REQUIRED bool `yaml:"REQUIRED"`
 }
 
-var Cfg Config
+// gRPC 的 TLS 設定 有設定 CA_FILE 時 server 端會要求對方出示憑證 (mTLS)
+// 憑證檔案被換掉時會自動重新載入 不用重開程式
+type TLSConfig struct {
+	ENABLED   bool   `yaml:"ENABLED" peer:"same"`
+	CA_FILE   string `yaml:"CA_FILE"`
+	CERT_FILE string `yaml:"CERT_FILE"`
+	KEY_FILE  string `yaml:"KEY_FILE"`
 
-func init() {
-	data, err := os.ReadFile("config/config.yaml")
-	if err != nil {
-		log.Fatal("Cannot read config.yaml 自己去建立一個config.yaml:", err)
+	// client 驗證 server 憑證時用的名稱 空白就用連線位址的 host
+	SERVER_NAME string `yaml:"SERVER_NAME"`
+	// 只接受這些名稱 (CN 或 SAN) 的對方憑證 空白代表不限制
+	PEER_NAMES []string `yaml:"PEER_NAMES"`
+	// 只接受這些 SHA-256 指紋 (hex) 的對方憑證 空白代表不限制
+	PEER_SHA256 []string `yaml:"PEER_SHA256"`
+}
+
+// 目前使用中的設定 main 啟動時用 Load 載入 重新載入時整份換掉
+var current atomic.Pointer[Config]
+
+// Current 回傳目前使用中的設定 不要修改回傳的內容
+// 重新載入後會換成新的一份 需要同一份設定時先存到變數裡
+func Current() *Config {
+	if c := current.Load(); c != nil {
+		return c
 	}
+	return &Config{}
+}
+
+func Set(c *Config) {
+	current.Store(c)
+}
+
+// PeerIPs 回傳另外一台HA在每條網路路徑上的 IP
+func (c Config) PeerIPs() []string {
+	if len(c.CLIENT_IPS) == 0 {
+		return []string{c.CLIENT_IP}
+	}
+	return c.CLIENT_IPS
+}
+
+// PeerAllowedAddrs 回傳可以連進來的HA來源位址 沒有設定 PEER_ALLOWED_ADDRS 時是另外一台的 IP
+func (c Config) PeerAllowedAddrs() []string {
+	if len(c.PEER_ALLOWED_ADDRS) == 0 {
+		return c.PeerIPs()
+	}
+	return c.PEER_ALLOWED_ADDRS
+}
 
-	if err := yaml.Unmarshal(data, &Cfg); err != nil {
-		log.Fatal("YAML parse error:", err)
+// PeerAddresses 回傳連到另外一台HA的所有位址 一條網路路徑一個
+func (c Config) PeerAddresses() []string {
+	ips := c.PeerIPs()
+	addrs := make([]string, 0, len(ips))
+	for _, ip := range ips {
+		addrs = append(addrs, net.JoinHostPort(ip, c.CLIENT_PORT))
 	}
+	return addrs
 }
@@ -0,0 +1,54 @@
+package config
+
+import "time"
+
+// 健康檢查可以用的項目 dep:<NAME> 代表單一個 DEPENDENCIES
+//
+//	maintenance 不在維修模式
+//	ecs / fleet 本機的 ECS 以及交管 (FLEET_HEALTH_RULE)
+//	deps        REQUIRED 的依賴都正常
+//	peer        另外一台是 alive
+//	replication 資料同步的延遲不超過 MAX_REPLICATION_LAG
+//	startup     啟動超過 STARTUP_GRACE
+//	config      跟另外一台的設定一致
+//	vip         每個 VIP 在不在本機都跟角色一致
+var HealthCheckNames = []string{"maintenance", "ecs", "fleet", "deps", "peer", "replication", "startup", "config", "vip"}
+
+// /health/live、/health/ready、/health/failover 的判斷規則 可以在執行中重新載入
+type HealthConfig struct {
+	// 啟動後多久內 startup 算失敗 預設 10s
+	STARTUP_GRACE Duration `yaml:"STARTUP_GRACE" reload:"live"`
+	// replication 的延遲上限 預設 5s 延遲是單向的 兩台的時鐘差會算進去 要用 NTP 同步
+	MAX_REPLICATION_LAG Duration `yaml:"MAX_REPLICATION_LAG" reload:"live"`
+
+	// 程式是不是還活著 預設不檢查任何項目
+	LIVE HealthPolicy `yaml:"LIVE"`
+	// 可以開始服務 預設 startup、config
+	READY HealthPolicy `yaml:"READY"`
+	// 可以當 MASTER 失敗時 keepalived 會切到另外一台 (/health 也是這個) 預設 maintenance、ecs、fleet、deps
+	FAILOVER HealthPolicy `yaml:"FAILOVER"`
+}
+
+// 一個結果的規則 REQUIRED 全部正常 而且 OPTIONAL 至少 MIN_OPTIONAL 個正常才算正常
+// OPTIONAL 一定會列在結果裡 MIN_OPTIONAL 是 0 時只是顯示
+type HealthPolicy struct {
+	REQUIRED     []string `yaml:"REQUIRED" reload:"live"`
+	OPTIONAL     []string `yaml:"OPTIONAL" reload:"live"`
+	MIN_OPTIONAL int      `yaml:"MIN_OPTIONAL" reload:"live"`
+}
+
+// 跟以前 /health 以及 /health/ready 一樣的預設值
+func (h *HealthConfig) applyDefaults() {
+	if h.STARTUP_GRACE == 0 {
+		h.STARTUP_GRACE = Duration(10 * time.Second)
+	}
+	if h.MAX_REPLICATION_LAG == 0 {
+		h.MAX_REPLICATION_LAG = Duration(5 * time.Second)
+	}
+	if h.READY.REQUIRED == nil && h.READY.OPTIONAL == nil {
+		h.READY.REQUIRED = []string{"startup", "config"}
+	}
+	if h.FAILOVER.REQUIRED == nil && h.FAILOVER.OPTIONAL == nil {
+		h.FAILOVER.REQUIRED = []string{"maintenance", "ecs", "fleet", "deps"}
+	}
+}
@@ -0,0 +1,186 @@
+package config
+
+import (
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// keepalived.conf 的內容 用 `ha_arbiter keepalived render` 產生
+// 仲裁程式啟動時用 INSTANCES 建立每個 VIP 的角色 用 INTERFACE、ADDR_SOURCE 監看網卡上的 VIP
+// NOTIFY_FIFO 啟動時開始讀 這幾個改了要重開程式 RECONCILE_* 每次校正時讀 其他的執行中不會用到
+type KeepalivedConfig struct {
+	// VRRP 封包以及 VIP 綁定的網卡 仲裁程式也在這張網卡上監看 VIP 改了要重開程式
+	INTERFACE string `yaml:"INTERFACE"`
+	// 本機以及另外一台的 priority 高的平常是 MASTER 一樣時看 IP
+	PRIORITY      int `yaml:"PRIORITY" peer:"PEER_PRIORITY" reload:"live"`
+	PEER_PRIORITY int `yaml:"PEER_PRIORITY" peer:"PRIORITY" reload:"live"`
+	// VRRP 廣播間隔 預設 1s
+	ADVERT_INT Duration `yaml:"ADVERT_INT" peer:"same" reload:"live"`
+	// VRRP 密碼 keepalived 只會用前 8 個字
+	AUTH_PASS string `yaml:"AUTH_PASS" secret:"true" reload:"live"`
+
+	// 腳本放的目錄 預設 /etc/keepalived 下面的相對路徑都以這裡為準
+	SCRIPT_DIR string `yaml:"SCRIPT_DIR" reload:"live"`
+	// 切換角色時呼叫的腳本 keepalived 會帶 TYPE NAME STATE PRIORITY 預設 notify_role.sh
+	// 有設定 NOTIFY_FIFO 時不會用到
+	NOTIFY string `yaml:"NOTIFY" reload:"live"`
+	// keepalived 的 notify_fifo 仲裁程式直接讀 不用經過腳本 空白代表用 NOTIFY 腳本
+	// 兩個只會用一個 同一個通知不會收到兩次
+	NOTIFY_FIFO string `yaml:"NOTIFY_FIFO"`
+	// 多久用本機網卡上的 VIP 校正一次角色 補上漏掉的通知 預設 5s
+	RECONCILE_INTERVAL Duration `yaml:"RECONCILE_INTERVAL" reload:"live"`
+	// VIP 跟角色不一致持續多久才校正 避免跟切換中的通知搶 預設 3s
+	RECONCILE_GRACE Duration `yaml:"RECONCILE_GRACE" reload:"live"`
+	// 怎麼知道 INTERFACE 上有哪些位址 netlink (預設 即時收到變動 不支援時改用定時檢查) / poll (只定時檢查)
+	// 改了要重開程式
+	ADDR_SOURCE string `yaml:"ADDR_SOURCE"`
+
+	// 健康檢查腳本 (vrrp_script) 預設是 check_server_alive.sh 以及 chk_server_health.sh
+	SCRIPTS []KeepalivedScript `yaml:"SCRIPTS" peer:"same" reload:"live"`
+	// VRRP instance 一個 VIP 一個 預設只有一個 VI_1 綁 VIP
+	// 仲裁程式會分別記錄每個 instance 的角色
+	INSTANCES []KeepalivedInstance `yaml:"INSTANCES" peer:"same"`
+}
+
+// 一個 vrrp_script
+type KeepalivedScript struct {
+	NAME   string   `yaml:"NAME"`
+	SCRIPT string   `yaml:"SCRIPT"` // 相對路徑以 SCRIPT_DIR 為準
+	ARGS   []string `yaml:"ARGS"`   // 腳本的參數 例如 chk_server_health.sh 帶服務名稱
+
+	INTERVAL Duration `yaml:"INTERVAL"` // 預設 2s
+	TIMEOUT  Duration `yaml:"TIMEOUT"`  // 預設 2s
+	// 失敗時 priority 加減多少 0 代表失敗就進入 FAULT (一定會切換)
+	WEIGHT int `yaml:"WEIGHT"`
+	FALL   int `yaml:"FALL"` // 連續失敗幾次才算失敗 預設 2
+	RISE   int `yaml:"RISE"` // 連續成功幾次才算恢復 預設 2
+}
+
+// 一個 vrrp_instance
+type KeepalivedInstance struct {
+	NAME      string `yaml:"NAME"`
+	ROUTER_ID int    `yaml:"ROUTER_ID"` // virtual_router_id 同一個網段不能重複
+	// VIP 沒有寫 prefix 時用 /24
+	VIP string `yaml:"VIP"`
+	// 要追蹤的 SCRIPTS 名稱
+	TRACK []string `yaml:"TRACK"`
+	// 這個 instance 本機以及另外一台的 priority 沒有設定時用 KEEPALIVED.PRIORITY / PEER_PRIORITY
+	// 兩台各自當不同 VIP 的 MASTER 時用
+	PRIORITY      int `yaml:"PRIORITY" peer:"PEER_PRIORITY"`
+	PEER_PRIORITY int `yaml:"PEER_PRIORITY" peer:"PRIORITY"`
+
+	// 這個 VIP 提供的服務 例如 tc、rabbitmq、mysql 空白代表跟 NAME 一樣
+	SERVICE string `yaml:"SERVICE"`
+	// 服務的 TCP 位址 /health/service/<SERVICE> 會檢查連不連得上 空白代表不檢查
+	CHECK_ADDR string `yaml:"CHECK_ADDR"`
+	// 這個服務用到的 DEPENDENCIES 任何一個異常 /health/service/<SERVICE> 就算異常
+	DEPENDS []string `yaml:"DEPENDS"`
+	// 交管的 is_master 跟著這個 instance 的角色 沒有設定時用第一個 instance
+	FLEET bool `yaml:"FLEET"`
+}
+
+// ScriptPath 回傳腳本的絕對路徑
+func (k KeepalivedConfig) ScriptPath(script string) string {
+	if filepath.IsAbs(script) {
+		return script
+	}
+	return filepath.Join(k.SCRIPT_DIR, script)
+}
+
+// FleetInstance 回傳交管角色跟著的 instance 的位置
+func (k KeepalivedConfig) FleetInstance() int {
+	for i, inst := range k.INSTANCES {
+		if inst.FLEET {
+			return i
+		}
+	}
+	return 0
+}
+
+// IP 回傳不含 prefix 的 VIP
+func (i KeepalivedInstance) IP() string {
+	ip, _, _ := strings.Cut(i.VIP, "/")
+	return ip
+}
+
+// VIPCIDR 回傳 virtual_ipaddress 用的 VIP 沒有 prefix 時補上 /24
+func (i KeepalivedInstance) VIPCIDR() string {
+	if strings.Contains(i.VIP, "/") {
+		return i.VIP
+	}
+	return i.VIP + "/24"
+}
+
+// 跟原本 VIP/keepalived.conf 一樣的預設值
+func (k *KeepalivedConfig) applyDefaults(vip string) {
+	if k.PRIORITY == 0 {
+		k.PRIORITY = 100
+	}
+	if k.PEER_PRIORITY == 0 {
+		k.PEER_PRIORITY = k.PRIORITY
+	}
+	if k.ADVERT_INT == 0 {
+		k.ADVERT_INT = Duration(time.Second)
+	}
+	if k.AUTH_PASS == "" {
+		k.AUTH_PASS = "1111"
+	}
+	if k.SCRIPT_DIR == "" {
+		k.SCRIPT_DIR = "/etc/keepalived"
+	}
+	if k.NOTIFY == "" {
+		k.NOTIFY = "notify_role.sh"
+	}
+	if k.RECONCILE_INTERVAL == 0 {
+		k.RECONCILE_INTERVAL = Duration(5 * time.Second)
+	}
+	if k.RECONCILE_GRACE == 0 {
+		k.RECONCILE_GRACE = Duration(3 * time.Second)
+	}
+	if k.ADDR_SOURCE == "" {
+		k.ADDR_SOURCE = "netlink"
+	}
+
+	if len(k.SCRIPTS) == 0 {
+		k.SCRIPTS = []KeepalivedScript{
+			{NAME: "chk_traffic_alive", SCRIPT: "check_server_alive.sh", WEIGHT: -30},
+			{NAME: "chk_server_health", SCRIPT: "chk_server_health.sh", WEIGHT: -60},
+		}
+	}
+	for i := range k.SCRIPTS {
+		s := &k.SCRIPTS[i]
+		if s.INTERVAL == 0 {
+			s.INTERVAL = Duration(2 * time.Second)
+		}
+		if s.TIMEOUT == 0 {
+			s.TIMEOUT = Duration(2 * time.Second)
+		}
+		if s.FALL == 0 {
+			s.FALL = 2
+		}
+		if s.RISE == 0 {
+			s.RISE = 2
+		}
+	}
+
+	if len(k.INSTANCES) == 0 {
+		instance := KeepalivedInstance{NAME: "VI_1", ROUTER_ID: 51, VIP: vip}
+		for _, s := range k.SCRIPTS {
+			instance.TRACK = append(instance.TRACK, s.NAME)
+		}
+		k.INSTANCES = []KeepalivedInstance{instance}
+	}
+	for i := range k.INSTANCES {
+		inst := &k.INSTANCES[i]
+		if inst.SERVICE == "" {
+			inst.SERVICE = inst.NAME
+		}
+		if inst.PRIORITY == 0 {
+			inst.PRIORITY = k.PRIORITY
+		}
+		if inst.PEER_PRIORITY == 0 {
+			inst.PEER_PRIORITY = k.PEER_PRIORITY
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package config
+
+import "testing"
+
+func TestKeepalivedInstancePriorityDefaults(t *testing.T) {
+	k := KeepalivedConfig{
+		PRIORITY:      100,
+		PEER_PRIORITY: 90,
+		INSTANCES: []KeepalivedInstance{
+			{NAME: "TC_VI"},
+			{NAME: "DB_VI", PRIORITY: 90, PEER_PRIORITY: 100},
+		},
+	}
+	k.applyDefaults("")
+
+	if got := k.INSTANCES[0]; got.PRIORITY != 100 || got.PEER_PRIORITY != 90 {
+		t.Errorf("TC_VI priority = %d/%d, want the global 100/90", got.PRIORITY, got.PEER_PRIORITY)
+	}
+	if got := k.INSTANCES[1]; got.PRIORITY != 90 || got.PEER_PRIORITY != 100 {
+		t.Errorf("DB_VI priority = %d/%d, want its own 90/100", got.PRIORITY, got.PEER_PRIORITY)
+	}
+}
+
+func TestComparePeerMirrorsInstancePriority(t *testing.T) {
+	a := Config{KEEPALIVED: KeepalivedConfig{INSTANCES: []KeepalivedInstance{
+		{NAME: "TC_VI", ROUTER_ID: 51, PRIORITY: 100, PEER_PRIORITY: 90},
+	}}}
+	b := Config{KEEPALIVED: KeepalivedConfig{INSTANCES: []KeepalivedInstance{
+		{NAME: "TC_VI", ROUTER_ID: 51, PRIORITY: 90, PEER_PRIORITY: 100},
+	}}}
+	if m := a.ComparePeer(b.Masked()); len(m) != 0 {
+		t.Fatalf("mirrored instance priorities: got mismatches %+v", m)
+	}
+
+	// 其他欄位兩台要一樣
+	b.KEEPALIVED.INSTANCES[0].ROUTER_ID = 52
+	m := a.ComparePeer(b.Masked())
+	if len(m) != 1 || m[0].Key != "KEEPALIVED.INSTANCES[0].ROUTER_ID" {
+		t.Errorf("got mismatches %+v, want only ROUTER_ID", m)
+	}
+
+	// instance 數量不一樣
+	b.KEEPALIVED.INSTANCES = nil
+	found := false
+	for _, m := range a.ComparePeer(b.Masked()) {
+		if m.Key == "KEEPALIVED.INSTANCES" && m.Self == "1" && m.Peer == "0" {
+			found = true
+		}
+	}
+	if !found {
+		t.Error("a different number of instances is not reported")
+	}
+}
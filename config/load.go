@@ -0,0 +1,217 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/goccy/go-yaml"
+)
+
+// 沒有 --config 也沒有 HA_CONFIG 時用的設定檔 (相對於工作目錄)
+const defaultPath = "config/config.yaml"
+
+// 環境變數覆蓋設定時的前綴 例如 HA_FLEET_HB_INTERVAL、HA_API_AUTH_UNIX_SOCKET
+const EnvPrefix = "HA_"
+
+// phi 8 大約是誤判機率 1e-8
+const defaultPhiThreshold = 8
+
+// DefaultPath 回傳預設的設定檔路徑 有設定 HA_CONFIG 時用它
+func DefaultPath() string {
+	if path := os.Getenv(EnvPrefix + "CONFIG"); path != "" {
+		return path
+	}
+	return defaultPath
+}
+
+// Load 讀取設定檔 套用環境變數覆蓋以及預設值 最後檢查整份設定
+// 所有錯誤會一次回傳 (errors.Join)
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("無法讀取設定檔: %w", err)
+	}
+
+	return Parse(data)
+}
+
+// Parse 跟 Load 一樣 只是內容已經讀進來了
+func Parse(data []byte) (*Config, error) {
+	var cfg Config
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("YAML 格式錯誤: %w", err)
+	}
+
+	var errs []error
+	applyEnv(reflect.ValueOf(&cfg).Elem(), "", &errs)
+	cfg.applyDefaults()
+	errs = append(errs, cfg.Validate()...)
+
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return &cfg, nil
+}
+
+// 依照 yaml key 找對應的環境變數 巢狀的 key 用 "_" 接起來
+// 支援字串、布林、數字、時間以及逗號分隔的字串列表
+func applyEnv(v reflect.Value, prefix string, errs *[]error) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		key := field.Tag.Get("yaml")
+		if key == "" || key == "-" {
+			continue
+		}
+		key = prefix + key
+
+		if field.Type.Kind() == reflect.Struct {
+			applyEnv(v.Field(i), key+"_", errs)
+			continue
+		}
+
+		name := EnvPrefix + key
+		raw, ok := os.LookupEnv(name)
+		if !ok {
+			continue
+		}
+		if err := setFromString(v.Field(i), raw); err != nil {
+			*errs = append(*errs, fmt.Errorf("%s: %w", name, err))
+		}
+	}
+}
+
+func setFromString(f reflect.Value, raw string) error {
+	if f.Type() == reflect.TypeOf(Duration(0)) {
+		d, err := ParseDuration(raw)
+		if err != nil {
+			return err
+		}
+		f.Set(reflect.ValueOf(d))
+		return nil
+	}
+
+	switch f.Kind() {
+	case reflect.String:
+		f.SetString(raw)
+
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("無效的布林值 %q", raw)
+		}
+		f.SetBool(b)
+
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(raw, 10, f.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("無效的整數 %q", raw)
+		}
+		f.SetInt(n)
+
+	case reflect.Float64:
+		n, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return fmt.Errorf("無效的數字 %q", raw)
+		}
+		f.SetFloat(n)
+
+	case reflect.Slice:
+		if f.Type().Elem().Kind() != reflect.String {
+			return errors.New("這個設定不能用環境變數覆蓋")
+		}
+		var items []string
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		f.Set(reflect.ValueOf(items))
+
+	default:
+		return errors.New("這個設定不能用環境變數覆蓋")
+	}
+	return nil
+}
+
+// 沒有設定的欄位填上預設值
+func (c *Config) applyDefaults() {
+	if c.FLEET_HB_INTERVAL == 0 {
+		c.FLEET_HB_INTERVAL = Duration(time.Second)
+	}
+	if c.FLEET_HB_TIMEOUT == 0 {
+		c.FLEET_HB_TIMEOUT = 3 * c.FLEET_HB_INTERVAL
+	}
+	if c.OTHER_HA_HB_INTERVAL == 0 {
+		c.OTHER_HA_HB_INTERVAL = Duration(time.Second)
+	}
+	if c.OTHER_HA_HB_TIMEOUT == 0 {
+		c.OTHER_HA_HB_TIMEOUT = 3 * c.OTHER_HA_HB_INTERVAL
+	}
+
+	// 沒有設定時用 phi 8 設成負數才只用固定的 TIMEOUT
+	if c.FLEET_PHI_THRESHOLD == 0 {
+		c.FLEET_PHI_THRESHOLD = defaultPhiThreshold
+	}
+	if c.OTHER_HA_PHI_THRESHOLD == 0 {
+		c.OTHER_HA_PHI_THRESHOLD = defaultPhiThreshold
+	}
+	if c.PHI_WINDOW == 0 {
+		c.PHI_WINDOW = 100
+	}
+	if c.PHI_MIN_STD_MS == 0 {
+		c.PHI_MIN_STD_MS = 100
+	}
+
+	// 沒有設定時等三次 probe
+	if c.FLEET_PROBE_INTERVAL > 0 && c.FLEET_PROBE_TIMEOUT == 0 {
+		c.FLEET_PROBE_TIMEOUT = 3 * c.FLEET_PROBE_INTERVAL
+	}
+
+	if len(c.FLEETS) == 0 {
+		c.FLEETS = []FleetConfig{{NAME: "fleet", ADDRESS: "localhost:50051"}}
+	}
+	for i := range c.FLEETS {
+		if c.FLEETS[i].NAME == "" {
+			c.FLEETS[i].NAME = c.FLEETS[i].ADDRESS
+		}
+	}
+	if c.FLEET_HEALTH_RULE == "" {
+		c.FLEET_HEALTH_RULE = "all"
+	}
+
+	for i := range c.DEPENDENCIES {
+		d := &c.DEPENDENCIES[i]
+		if d.INTERVAL == 0 {
+			d.INTERVAL = Duration(2 * time.Second)
+		}
+		if d.TIMEOUT == 0 {
+			d.TIMEOUT = Duration(time.Second)
+		}
+		if d.RISE == 0 {
+			d.RISE = 2
+		}
+		if d.FALL == 0 {
+			d.FALL = 2
+		}
+	}
+
+	if c.LOG_LEVEL == "" {
+		c.LOG_LEVEL = "debug"
+	}
+
+	if c.WEB_API_PORT == "" {
+		c.WEB_API_PORT = "50000"
+	}
+	if c.PEER_WEB_API_PORT == "" {
+		c.PEER_WEB_API_PORT = c.WEB_API_PORT
+	}
+
+	c.KEEPALIVED.applyDefaults(c.VIP)
+	c.HEALTH.applyDefaults()
+}
@@ -0,0 +1,23 @@
+package config
+
+import "testing"
+
+func TestPhiThresholdDefaults(t *testing.T) {
+	tests := []struct {
+		name string
+		set  float64
+		want float64
+	}{
+		{"unset", 0, defaultPhiThreshold},
+		{"custom", 12, 12},
+		// 負數代表只用固定的 TIMEOUT 不能被預設值蓋掉
+		{"disabled", -1, -1},
+	}
+	for _, tt := range tests {
+		c := &Config{FLEET_PHI_THRESHOLD: tt.set, OTHER_HA_PHI_THRESHOLD: tt.set}
+		c.applyDefaults()
+		if c.FLEET_PHI_THRESHOLD != tt.want || c.OTHER_HA_PHI_THRESHOLD != tt.want {
+			t.Errorf("%s: thresholds = %v / %v, want %v", tt.name, c.FLEET_PHI_THRESHOLD, c.OTHER_HA_PHI_THRESHOLD, tt.want)
+		}
+	}
+}
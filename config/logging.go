@@ -0,0 +1,77 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync/atomic"
+)
+
+// LogLevel 日誌等級 依照 LOG_LEVEL 過濾
+type LogLevel int32
+
+const (
+	LogDebug LogLevel = iota
+	LogInfo
+	LogWarn
+	LogError
+)
+
+func parseLogLevel(s string) LogLevel {
+	switch s {
+	case "info":
+		return LogInfo
+	case "warn":
+		return LogWarn
+	case "error":
+		return LogError
+	default:
+		return LogDebug
+	}
+}
+
+var minLogLevel atomic.Int32
+
+// SetLogLevel 設定要輸出的最低等級 重新載入設定時也會呼叫
+func SetLogLevel(level string) {
+	minLogLevel.Store(int32(parseLogLevel(level)))
+}
+
+type levelWriter struct {
+	out   io.Writer
+	level LogLevel
+}
+
+func (w levelWriter) Write(p []byte) (int, error) {
+	if w.level < LogLevel(minLogLevel.Load()) {
+		return len(p), nil
+	}
+	return w.out.Write(p)
+}
+
+// LogWriter 寫進去的內容都算 level 等級 低於 LOG_LEVEL 時直接丟掉
+func LogWriter(out io.Writer, level LogLevel) io.Writer {
+	return levelWriter{out: out, level: level}
+}
+
+var (
+	warnLog  = log.New(LogWriter(os.Stderr, LogWarn), "", log.LstdFlags)
+	errorLog = log.New(LogWriter(os.Stderr, LogError), "", log.LstdFlags)
+)
+
+// LogWarnf 警告 一般的 log.Printf 算 info
+func LogWarnf(format string, args ...any) {
+	warnLog.Output(2, fmt.Sprintf(format, args...))
+}
+
+// LogErrorf 錯誤
+func LogErrorf(format string, args ...any) {
+	errorLog.Output(2, fmt.Sprintf(format, args...))
+}
+
+// LogFatalf 錯誤 不管 LOG_LEVEL 都會輸出 然後結束程式
+func LogFatalf(format string, args ...any) {
+	errorLog.Output(2, fmt.Sprintf(format, args...))
+	os.Exit(1)
+}
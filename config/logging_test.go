@@ -0,0 +1,32 @@
+package config
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestLogWriterFiltersByLevel(t *testing.T) {
+	defer SetLogLevel("debug")
+
+	var buf bytes.Buffer
+	info := LogWriter(&buf, LogInfo)
+	warn := LogWriter(&buf, LogWarn)
+
+	SetLogLevel("warn")
+	// 等級是寫進來的 writer 決定的 跟內容無關
+	info.Write([]byte("❌ 寫在 info 的內容\n"))
+	if buf.Len() != 0 {
+		t.Errorf("info line written at LOG_LEVEL=warn: %q", buf.String())
+	}
+	warn.Write([]byte("一般的文字\n"))
+	if buf.String() != "一般的文字\n" {
+		t.Errorf("warn line = %q, want it written", buf.String())
+	}
+
+	buf.Reset()
+	SetLogLevel("info")
+	info.Write([]byte("info\n"))
+	if buf.String() != "info\n" {
+		t.Errorf("info line = %q, want it written at LOG_LEVEL=info", buf.String())
+	}
+}
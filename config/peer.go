@@ -0,0 +1,183 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const maskedValue = "******"
+
+// Mismatch 是與另外一台HA比對後不一致的設定
+type Mismatch struct {
+	Key     string `json:"key"`
+	PeerKey string `json:"peer_key"`
+	Self    string `json:"self"`
+	Peer    string `json:"peer"`
+}
+
+type configField struct {
+	key    string
+	value  string
+	rule   string
+	secret bool
+	live   bool
+}
+
+// 把設定攤平成 yaml key 的列表 巢狀的 struct 用 "A.B" 表示
+// struct 的 slice 展開成 "A[0].B" 每個欄位沒有 peer / reload tag 時沿用 slice 的 "A" 本身是數量
+func walkFields(v reflect.Value, prefix string, parent configField, out *[]configField) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		key := field.Tag.Get("yaml")
+		if key == "" || key == "-" {
+			continue
+		}
+		key = prefix + key
+
+		rule := prefixRule(field.Tag.Get("peer"), prefix)
+		if rule == "" {
+			rule = parent.rule
+		}
+		f := configField{
+			key:    key,
+			rule:   rule,
+			secret: field.Tag.Get("secret") == "true",
+			live:   parent.live || field.Tag.Get("reload") == "live",
+		}
+
+		value := v.Field(i)
+		switch {
+		case field.Type.Kind() == reflect.Struct:
+			walkFields(value, key+".", f, out)
+		case field.Type.Kind() == reflect.Slice && field.Type.Elem().Kind() == reflect.Struct:
+			f.value = strconv.Itoa(value.Len())
+			*out = append(*out, f)
+			for j := 0; j < value.Len(); j++ {
+				walkFields(value.Index(j), fmt.Sprintf("%s[%d].", key, j), f, out)
+			}
+		default:
+			f.value = fmt.Sprint(value.Interface())
+			*out = append(*out, f)
+		}
+	}
+}
+
+// 巢狀 struct 裡的 peer tag 指的是同一層的 key
+func prefixRule(rule, prefix string) string {
+	if rule == "" || rule == "same" || prefix == "" {
+		return rule
+	}
+	op, keys, ok := strings.Cut(rule, ":")
+	if !ok {
+		return prefix + rule
+	}
+	parts := strings.Split(keys, ",")
+	for i := range parts {
+		parts[i] = prefix + parts[i]
+	}
+	return op + ":" + strings.Join(parts, ",")
+}
+
+// 設定值裡的列表 ([]string 攤平後是 "[a b]")
+func listValues(v string) []string {
+	if inner, ok := strings.CutPrefix(v, "["); ok {
+		return strings.Fields(strings.TrimSuffix(inner, "]"))
+	}
+	if v == "" {
+		return nil
+	}
+	return []string{v}
+}
+
+func (c Config) fields() []configField {
+	var out []configField
+	walkFields(reflect.ValueOf(c), "", configField{}, &out)
+	return out
+}
+
+// Masked 回傳以 yaml key 為索引的設定內容 secret 欄位會被遮蔽
+// 這份資料會透過HA連線送到另外一台做比對
+func (c Config) Masked() map[string]string {
+	out := map[string]string{}
+	for _, f := range c.fields() {
+		if f.secret {
+			out[f.key] = maskedValue
+			continue
+		}
+		out[f.key] = f.value
+	}
+	return out
+}
+
+// ComparePeer 依照 peer tag 比對本機與另外一台的設定
+// peer 是另外一台透過 Masked 送過來的內容
+//
+//	same          兩台一樣
+//	<KEY>         等於另外一台的 <KEY>
+//	in:<KEY>,...  是另外一台 <KEY> 裡的其中一個 (例如本機的 SERVER_IP 在另外一台的 CLIENT_IPS 裡)
+//	has:<KEY>     本機的列表包含另外一台的 <KEY>
+//
+// in / has 任何一邊空白 (沒有設定) 時不比對
+func (c Config) ComparePeer(peer map[string]string) []Mismatch {
+	self := c.Masked()
+	var mismatches []Mismatch
+
+	for _, f := range c.fields() {
+		if f.rule == "" {
+			continue
+		}
+
+		if op, keys, ok := strings.Cut(f.rule, ":"); ok {
+			var peerValues []string
+			for _, k := range strings.Split(keys, ",") {
+				peerValues = append(peerValues, listValues(peer[k])...)
+			}
+			selfValues := listValues(self[f.key])
+			if len(selfValues) == 0 || len(peerValues) == 0 {
+				continue
+			}
+
+			match := false
+			switch op {
+			case "in":
+				match = len(selfValues) == 1 && slices.Contains(peerValues, selfValues[0])
+			case "has":
+				match = len(peerValues) == 1 && slices.Contains(selfValues, peerValues[0])
+			}
+			if !match {
+				mismatches = append(mismatches, Mismatch{
+					Key:     f.key,
+					PeerKey: keys,
+					Self:    self[f.key],
+					Peer:    strings.Join(peerValues, " "),
+				})
+			}
+			continue
+		}
+
+		peerKey := f.rule
+		if f.rule == "same" {
+			peerKey = f.key
+		}
+
+		peerValue, ok := peer[peerKey]
+		if !ok || self[f.key] != peerValue {
+			mismatches = append(mismatches, Mismatch{
+				Key:     f.key,
+				PeerKey: peerKey,
+				Self:    self[f.key],
+				Peer:    peerValue,
+			})
+		}
+	}
+
+	sort.Slice(mismatches, func(i, j int) bool {
+		return mismatches[i].Key < mismatches[j].Key
+	})
+	return mismatches
+}
@@ -0,0 +1,158 @@
+package config
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestMaskedHidesSecrets(t *testing.T) {
+	c := Config{UDP_HB_KEY: "topsecret", NODE_ID: "ha-a"}
+	masked := c.Masked()
+	if masked["UDP_HB_KEY"] != maskedValue {
+		t.Errorf("UDP_HB_KEY = %q, want masked", masked["UDP_HB_KEY"])
+	}
+	if masked["NODE_ID"] != "ha-a" {
+		t.Errorf("NODE_ID = %q, want ha-a", masked["NODE_ID"])
+	}
+}
+
+func TestComparePeer(t *testing.T) {
+	a := Config{
+		NODE_ID:           "ha-a",
+		PEER_NODE_ID:      "ha-b",
+		SERVER_PORT:       "50052",
+		CLIENT_PORT:       "50053",
+		FLEET_HB_INTERVAL: Duration(time.Second),
+		UDP_HB_KEY:        "key-a",
+	}
+	b := a
+	b.NODE_ID, b.PEER_NODE_ID = "ha-b", "ha-a"
+	b.SERVER_PORT, b.CLIENT_PORT = "50053", "50052"
+	// secret 遮蔽後一樣 不會不一致
+	b.UDP_HB_KEY = "key-b"
+
+	if m := a.ComparePeer(b.Masked()); len(m) != 0 {
+		t.Fatalf("mirrored configs: got mismatches %+v", m)
+	}
+
+	b.FLEET_HB_INTERVAL = Duration(2 * time.Second)
+	b.PEER_NODE_ID = "ha-x"
+	m := a.ComparePeer(b.Masked())
+	if len(m) != 2 {
+		t.Fatalf("got %d mismatches %+v, want 2", len(m), m)
+	}
+	// 依照 key 排序
+	if m[0].Key != "FLEET_HB_INTERVAL" || m[0].PeerKey != "FLEET_HB_INTERVAL" || m[0].Self != "1s" || m[0].Peer != "2s" {
+		t.Errorf("mismatch[0] = %+v", m[0])
+	}
+	if m[1].Key != "NODE_ID" || m[1].PeerKey != "PEER_NODE_ID" || m[1].Peer != "ha-x" {
+		t.Errorf("mismatch[1] = %+v", m[1])
+	}
+}
+
+func TestComparePeerMissingKey(t *testing.T) {
+	a := Config{VIP: "192.168.0.200"}
+	peer := a.Masked()
+	delete(peer, "VIP")
+	found := false
+	for _, m := range a.ComparePeer(peer) {
+		if m.Key == "VIP" {
+			found = true
+			if m.Peer != "" {
+				t.Errorf("missing key: Peer = %q, want empty", m.Peer)
+			}
+		}
+	}
+	if !found {
+		t.Error("a key missing on the peer is not reported")
+	}
+}
+
+func TestPeerAllowedAddrs(t *testing.T) {
+	c := Config{CLIENT_IP: "192.168.100.99"}
+	if got := c.PeerAllowedAddrs(); len(got) != 1 || got[0] != "192.168.100.99" {
+		t.Errorf("default = %v, want CLIENT_IP", got)
+	}
+	c.CLIENT_IPS = []string{"192.168.100.99", "10.10.0.99"}
+	if got := c.PeerAllowedAddrs(); len(got) != 2 {
+		t.Errorf("default = %v, want CLIENT_IPS", got)
+	}
+	c.PEER_ALLOWED_ADDRS = []string{"10.10.0.0/24"}
+	if got := c.PeerAllowedAddrs(); len(got) != 1 || got[0] != "10.10.0.0/24" {
+		t.Errorf("configured = %v, want PEER_ALLOWED_ADDRS", got)
+	}
+}
+
+func TestComparePeerAddresses(t *testing.T) {
+	tests := []struct {
+		name     string
+		self     Config
+		peer     Config
+		mismatch []string
+	}{
+		{
+			"matching single network",
+			Config{SERVER_IP: "192.168.100.98", CLIENT_IP: "192.168.100.99"},
+			Config{SERVER_IP: "192.168.100.99", CLIENT_IP: "192.168.100.98"},
+			nil,
+		},
+		{
+			"matching multiple networks",
+			Config{SERVER_IP: "192.168.100.98", CLIENT_IPS: []string{"192.168.100.99", "10.10.0.99"}},
+			Config{SERVER_IP: "192.168.100.99", CLIENT_IPS: []string{"192.168.100.98", "10.10.0.98"}},
+			nil,
+		},
+		{
+			"peer points at another host",
+			Config{SERVER_IP: "192.168.100.98", CLIENT_IP: "192.168.100.99"},
+			Config{SERVER_IP: "192.168.100.99", CLIENT_IP: "192.168.100.97"},
+			[]string{"SERVER_IP"},
+		},
+		{
+			"self points at another host",
+			Config{SERVER_IP: "192.168.100.98", CLIENT_IP: "192.168.100.97"},
+			Config{SERVER_IP: "192.168.100.99", CLIENT_IP: "192.168.100.98"},
+			[]string{"CLIENT_IP"},
+		},
+		{
+			"peer address missing from CLIENT_IPS",
+			Config{SERVER_IP: "192.168.100.98", CLIENT_IPS: []string{"10.10.0.99"}},
+			Config{SERVER_IP: "192.168.100.99", CLIENT_IPS: []string{"192.168.100.98", "10.10.0.98"}},
+			[]string{"CLIENT_IPS"},
+		},
+		// 沒有設定 SERVER_IP 時沒辦法比對
+		{
+			"no SERVER_IP",
+			Config{CLIENT_IP: "192.168.100.99"},
+			Config{CLIENT_IP: "192.168.100.97"},
+			nil,
+		},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, m := range tt.self.ComparePeer(tt.peer.Masked()) {
+			if m.Key == "SERVER_IP" || m.Key == "CLIENT_IP" || m.Key == "CLIENT_IPS" {
+				got = append(got, m.Key)
+			}
+		}
+		if !slices.Equal(got, tt.mismatch) {
+			t.Errorf("%s: mismatches %v, want %v", tt.name, got, tt.mismatch)
+		}
+	}
+}
+
+func TestComparePeerAddressMismatchDetail(t *testing.T) {
+	self := Config{SERVER_IP: "192.168.100.98", CLIENT_IP: "192.168.100.99"}
+	peer := Config{SERVER_IP: "192.168.100.99", CLIENT_IPS: []string{"192.168.100.97", "10.10.0.97"}}
+	m := self.ComparePeer(peer.Masked())
+	for _, m := range m {
+		if m.Key == "SERVER_IP" {
+			if m.PeerKey != "CLIENT_IP,CLIENT_IPS" || m.Self != "192.168.100.98" || m.Peer != "192.168.100.97 10.10.0.97" {
+				t.Errorf("SERVER_IP mismatch = %+v", m)
+			}
+			return
+		}
+	}
+	t.Errorf("SERVER_IP mismatch not reported: %+v", m)
+}
@@ -0,0 +1,73 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// Change 是重新載入時有變動的設定
+type Change struct {
+	Key  string `json:"key"`
+	Old  string `json:"old"`
+	New  string `json:"new"`
+	Live bool   `json:"live"` // 可以在執行中套用
+}
+
+func (c Change) String() string {
+	return fmt.Sprintf("%s: %s → %s", c.Key, c.Old, c.New)
+}
+
+// Diff 列出兩份設定不一樣的欄位 secret 欄位只會顯示有變動
+// slice 變長或變短時 多出來或少掉的欄位另外一邊是空白
+func Diff(old, new *Config) []Change {
+	oldFields := map[string]configField{}
+	for _, f := range old.fields() {
+		oldFields[f.key] = f
+	}
+
+	var changes []Change
+	seen := map[string]bool{}
+	add := func(f configField, oldValue, newValue string) {
+		change := Change{Key: f.key, Old: oldValue, New: newValue, Live: f.live}
+		if f.secret {
+			change.Old, change.New = maskedValue, maskedValue
+		}
+		changes = append(changes, change)
+	}
+	for _, n := range new.fields() {
+		seen[n.key] = true
+		f, ok := oldFields[n.key]
+		if !ok {
+			add(n, "", n.value)
+		} else if f.value != n.value {
+			add(f, f.value, n.value)
+		}
+	}
+	for _, f := range old.fields() {
+		if !seen[f.key] {
+			add(f, f.value, "")
+		}
+	}
+	return changes
+}
+
+// MergeLive 回傳 old 的複本 只有 reload:"live" 的欄位換成 new 的值
+func MergeLive(old, new *Config) *Config {
+	merged := *old
+	mergeLive(reflect.ValueOf(&merged).Elem(), reflect.ValueOf(new).Elem())
+	return &merged
+}
+
+func mergeLive(dst, src reflect.Value) {
+	t := dst.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Type.Kind() == reflect.Struct {
+			mergeLive(dst.Field(i), src.Field(i))
+			continue
+		}
+		if field.Tag.Get("reload") == "live" {
+			dst.Field(i).Set(src.Field(i))
+		}
+	}
+}
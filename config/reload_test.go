@@ -0,0 +1,110 @@
+package config
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestMergeLive(t *testing.T) {
+	old := &Config{
+		SERVER_PORT:       "50052",
+		LOG_LEVEL:         "debug",
+		FLEET_HB_INTERVAL: Duration(time.Second),
+		KEEPALIVED:        KeepalivedConfig{PRIORITY: 100, NOTIFY_FIFO: "/run/ha/notify.fifo"},
+		HEALTH:            HealthConfig{FAILOVER: HealthPolicy{REQUIRED: []string{"fleet"}}},
+	}
+	new := &Config{
+		SERVER_PORT:       "60052",
+		LOG_LEVEL:         "warn",
+		FLEET_HB_INTERVAL: Duration(2 * time.Second),
+		KEEPALIVED:        KeepalivedConfig{PRIORITY: 90, NOTIFY_FIFO: "/tmp/notify.fifo"},
+		HEALTH:            HealthConfig{FAILOVER: HealthPolicy{REQUIRED: []string{"fleet", "deps"}, MIN_OPTIONAL: 1}},
+	}
+
+	merged := MergeLive(old, new)
+
+	// reload:"live" 的欄位 包含巢狀的 struct 換成新的值
+	if merged.LOG_LEVEL != "warn" || merged.FLEET_HB_INTERVAL != Duration(2*time.Second) {
+		t.Errorf("top-level live fields not merged: LOG_LEVEL=%q FLEET_HB_INTERVAL=%v", merged.LOG_LEVEL, merged.FLEET_HB_INTERVAL)
+	}
+	if merged.KEEPALIVED.PRIORITY != 90 {
+		t.Errorf("KEEPALIVED.PRIORITY = %d, want 90", merged.KEEPALIVED.PRIORITY)
+	}
+	if !slices.Equal(merged.HEALTH.FAILOVER.REQUIRED, []string{"fleet", "deps"}) || merged.HEALTH.FAILOVER.MIN_OPTIONAL != 1 {
+		t.Errorf("HEALTH.FAILOVER = %+v, want the new policy", merged.HEALTH.FAILOVER)
+	}
+
+	// 要重開程式的欄位維持原本的值
+	if merged.SERVER_PORT != "50052" {
+		t.Errorf("SERVER_PORT = %q, want the old value", merged.SERVER_PORT)
+	}
+	if merged.KEEPALIVED.NOTIFY_FIFO != "/run/ha/notify.fifo" {
+		t.Errorf("KEEPALIVED.NOTIFY_FIFO = %q, want the old value", merged.KEEPALIVED.NOTIFY_FIFO)
+	}
+
+	// 原本的設定不能被改到
+	if old.LOG_LEVEL != "debug" || old.KEEPALIVED.PRIORITY != 100 {
+		t.Errorf("old config was modified: %+v", old)
+	}
+}
+
+func TestDiffMarksLiveAndMasksSecrets(t *testing.T) {
+	old := &Config{SERVER_PORT: "50052", LOG_LEVEL: "debug", UDP_HB_KEY: "key-a"}
+	new := &Config{SERVER_PORT: "60052", LOG_LEVEL: "warn", UDP_HB_KEY: "key-b"}
+
+	changes := map[string]Change{}
+	for _, c := range Diff(old, new) {
+		changes[c.Key] = c
+	}
+	if len(changes) != 3 {
+		t.Fatalf("got %d changes %+v, want 3", len(changes), changes)
+	}
+	if c := changes["LOG_LEVEL"]; !c.Live || c.Old != "debug" || c.New != "warn" {
+		t.Errorf("LOG_LEVEL change = %+v", c)
+	}
+	if c := changes["SERVER_PORT"]; c.Live {
+		t.Errorf("SERVER_PORT change = %+v, want not live", c)
+	}
+	if c := changes["UDP_HB_KEY"]; c.Old != maskedValue || c.New != maskedValue {
+		t.Errorf("UDP_HB_KEY change = %+v, want masked", c)
+	}
+}
+
+func TestDiffSliceLength(t *testing.T) {
+	old := &Config{KEEPALIVED: KeepalivedConfig{INSTANCES: []KeepalivedInstance{{NAME: "VI_1"}}}}
+	new := &Config{KEEPALIVED: KeepalivedConfig{INSTANCES: []KeepalivedInstance{{NAME: "VI_1"}, {NAME: "DB_VI"}}}}
+
+	changes := map[string]Change{}
+	for _, c := range Diff(old, new) {
+		changes[c.Key] = c
+	}
+	if c := changes["KEEPALIVED.INSTANCES"]; c.Old != "1" || c.New != "2" {
+		t.Errorf("INSTANCES change = %+v, want 1 → 2", c)
+	}
+	if c := changes["KEEPALIVED.INSTANCES[1].NAME"]; c.Old != "" || c.New != "DB_VI" || c.Live {
+		t.Errorf("INSTANCES[1].NAME change = %+v, want a new non-live field", c)
+	}
+
+	for _, c := range Diff(new, old) {
+		if c.Key == "KEEPALIVED.INSTANCES[1].NAME" && (c.Old != "DB_VI" || c.New != "") {
+			t.Errorf("removed field change = %+v", c)
+		}
+	}
+}
+
+func TestDiffVipWatchNeedsRestart(t *testing.T) {
+	old := &Config{KEEPALIVED: KeepalivedConfig{INTERFACE: "eno2", ADDR_SOURCE: "netlink", RECONCILE_GRACE: Duration(3 * time.Second)}}
+	new := &Config{KEEPALIVED: KeepalivedConfig{INTERFACE: "eno3", ADDR_SOURCE: "poll", RECONCILE_GRACE: Duration(5 * time.Second)}}
+
+	// VIP 監看啟動時就決定了網卡以及來源 不能算成已經套用
+	for _, c := range Diff(old, new) {
+		want := c.Key == "KEEPALIVED.RECONCILE_GRACE"
+		if c.Live != want {
+			t.Errorf("%s live = %v, want %v", c.Key, c.Live, want)
+		}
+	}
+	if merged := MergeLive(old, new); merged.KEEPALIVED.INTERFACE != "eno2" || merged.KEEPALIVED.ADDR_SOURCE != "netlink" {
+		t.Errorf("merged KEEPALIVED = %+v, want the old interface and source", merged.KEEPALIVED)
+	}
+}
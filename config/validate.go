@@ -0,0 +1,316 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// FleetHealthRequired 依照 FLEET_HEALTH_RULE 回傳幾個交管正常才算交管正常
+// 規則可以是 all、any、majority 或數字 空白代表 all
+func FleetHealthRequired(rule string, fleets int) (int, error) {
+	switch rule {
+	case "", "all":
+		return fleets, nil
+	case "any":
+		return 1, nil
+	case "majority":
+		return fleets/2 + 1, nil
+	}
+
+	n, err := strconv.Atoi(rule)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("無效的規則 %q (all、any、majority 或數字)", rule)
+	}
+	if n > fleets {
+		return 0, fmt.Errorf("規則要求 %d 個交管 但只設定了 %d 個", n, fleets)
+	}
+	return n, nil
+}
+
+// 收集設定錯誤用
+type problems []error
+
+func (p *problems) add(key string, format string, args ...any) {
+	*p = append(*p, fmt.Errorf("%s: %s", key, fmt.Sprintf(format, args...)))
+}
+
+func (p *problems) port(key, value string, required bool) {
+	if value == "" {
+		if required {
+			p.add(key, "必須設定")
+		}
+		return
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 || n > 65535 {
+		p.add(key, "無效的 port %q", value)
+	}
+}
+
+func (p *problems) ip(key, value string) {
+	if net.ParseIP(value) == nil {
+		p.add(key, "無效的 IP %q", value)
+	}
+}
+
+func (p *problems) heartbeat(prefix string, interval, timeout Duration) {
+	if interval <= 0 {
+		p.add(prefix+"_INTERVAL", "必須大於 0")
+		return
+	}
+	if timeout <= interval {
+		p.add(prefix+"_TIMEOUT", "(%v) 必須大於 %s_INTERVAL (%v)", timeout, prefix, interval)
+	}
+}
+
+func (p *problems) tls(key string, cfg TLSConfig) {
+	if !cfg.ENABLED {
+		return
+	}
+	if cfg.CERT_FILE == "" || cfg.KEY_FILE == "" {
+		p.add(key, "啟用 TLS 時必須設定 CERT_FILE 以及 KEY_FILE")
+	}
+}
+
+// Validate 檢查整份設定 回傳所有找到的錯誤
+func (c Config) Validate() []error {
+	var p problems
+
+	p.heartbeat("FLEET_HB", c.FLEET_HB_INTERVAL, c.FLEET_HB_TIMEOUT)
+	p.heartbeat("OTHER_HA_HB", c.OTHER_HA_HB_INTERVAL, c.OTHER_HA_HB_TIMEOUT)
+	if c.FLEET_PROBE_INTERVAL < 0 {
+		p.add("FLEET_PROBE_INTERVAL", "不能小於 0")
+	} else if c.FLEET_PROBE_INTERVAL > 0 {
+		p.heartbeat("FLEET_PROBE", c.FLEET_PROBE_INTERVAL, c.FLEET_PROBE_TIMEOUT)
+	}
+
+	if c.PHI_WINDOW < 2 {
+		p.add("PHI_WINDOW", "至少要 2")
+	}
+	if c.PHI_MIN_STD_MS < 0 {
+		p.add("PHI_MIN_STD_MS", "不能小於 0")
+	}
+
+	if ip := net.ParseIP(c.VIP); ip == nil || ip.To4() == nil {
+		p.add("VIP", "必須是 IPv4 位址 %q", c.VIP)
+	}
+
+	// 另外一台的連線以及 UDP 心跳都靠節點名稱辨識 沒有設定時不接受任何連線
+	switch {
+	case c.NODE_ID == "":
+		p.add("NODE_ID", "必須設定")
+	case c.PEER_NODE_ID == "":
+		p.add("PEER_NODE_ID", "必須設定")
+	case c.NODE_ID == c.PEER_NODE_ID:
+		p.add("PEER_NODE_ID", "不能跟 NODE_ID 一樣")
+	}
+	for i, a := range c.PEER_ALLOWED_ADDRS {
+		if _, _, err := net.ParseCIDR(a); err != nil && net.ParseIP(a) == nil {
+			p.add(fmt.Sprintf("PEER_ALLOWED_ADDRS[%d]", i), "必須是 IP 或 CIDR %q", a)
+		}
+	}
+
+	p.port("SERVER_PORT", c.SERVER_PORT, true)
+	p.port("CLIENT_PORT", c.CLIENT_PORT, true)
+	p.port("WEB_API_PORT", c.WEB_API_PORT, true)
+	p.port("PEER_WEB_API_PORT", c.PEER_WEB_API_PORT, true)
+	p.port("UDP_HB_PORT", c.UDP_HB_PORT, false)
+	if c.UDP_HB_PORT != "" && c.UDP_HB_KEY == "" {
+		p.add("UDP_HB_KEY", "啟用 UDP 心跳時必須設定")
+	}
+
+	if len(c.CLIENT_IPS) == 0 {
+		p.ip("CLIENT_IP", c.CLIENT_IP)
+	}
+	for i, ip := range c.CLIENT_IPS {
+		p.ip(fmt.Sprintf("CLIENT_IPS[%d]", i), ip)
+	}
+
+	names := map[string]bool{}
+	for i, f := range c.FLEETS {
+		key := fmt.Sprintf("FLEETS[%d]", i)
+		if _, port, err := net.SplitHostPort(f.ADDRESS); err != nil {
+			p.add(key+".ADDRESS", "必須是 host:port %q", f.ADDRESS)
+		} else {
+			p.port(key+".ADDRESS", port, true)
+		}
+		if names[f.NAME] {
+			p.add(key+".NAME", "名稱 %q 重複", f.NAME)
+		}
+		names[f.NAME] = true
+	}
+	if _, err := FleetHealthRequired(c.FLEET_HEALTH_RULE, len(c.FLEETS)); err != nil {
+		p.add("FLEET_HEALTH_RULE", "%v", err)
+	}
+
+	c.validateInstances(&p)
+	c.validateDependencies(&p)
+	c.validateHealth(&p)
+
+	switch c.LOG_LEVEL {
+	case "debug", "info", "warn", "error":
+	default:
+		p.add("LOG_LEVEL", "無效的等級 %q (debug、info、warn、error)", c.LOG_LEVEL)
+	}
+
+	if s := c.API_AUTH.UNIX_SOCKET; s != "" && !filepath.IsAbs(s) {
+		p.add("API_AUTH.UNIX_SOCKET", "必須是絕對路徑 %q", s)
+	}
+	p.tls("HA_TLS", c.HA_TLS)
+	p.tls("FLEET_TLS", c.FLEET_TLS)
+
+	return p
+}
+
+// /health 底下已經用掉的路徑 依賴的名稱不能用
+var reservedHealthNames = []string{"live", "ready", "failover", "service"}
+
+func (c Config) validateDependencies(p *problems) {
+	names := map[string]bool{}
+	for i, d := range c.DEPENDENCIES {
+		key := fmt.Sprintf("DEPENDENCIES[%d]", i)
+		switch {
+		case d.NAME == "":
+			p.add(key+".NAME", "必須設定")
+		case names[d.NAME]:
+			p.add(key+".NAME", "名稱 %q 重複", d.NAME)
+		case slices.Contains(reservedHealthNames, d.NAME) || strings.Contains(d.NAME, "/"):
+			p.add(key+".NAME", "不能用 %q (會跟 /health 底下的 API 衝突)", d.NAME)
+		}
+		names[d.NAME] = true
+
+		switch d.TYPE {
+		case "tcp", "amqp", "mysql":
+			if _, port, err := net.SplitHostPort(d.ADDRESS); err != nil {
+				p.add(key+".ADDRESS", "必須是 host:port %q", d.ADDRESS)
+			} else {
+				p.port(key+".ADDRESS", port, true)
+			}
+		case "http":
+			if u, err := url.Parse(d.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				p.add(key+".URL", "必須是 http:// 或 https:// 網址 %q", d.URL)
+			}
+		case "exec":
+			if len(d.COMMAND) == 0 {
+				p.add(key+".COMMAND", "必須設定")
+			}
+		default:
+			p.add(key+".TYPE", "無效的類型 %q (tcp、amqp、mysql、http、exec)", d.TYPE)
+		}
+
+		if d.INTERVAL <= 0 || d.TIMEOUT <= 0 {
+			p.add(key, "INTERVAL 以及 TIMEOUT 必須大於 0")
+		} else if d.TIMEOUT > d.INTERVAL {
+			p.add(key+".TIMEOUT", "(%v) 不能大於 INTERVAL (%v)", d.TIMEOUT, d.INTERVAL)
+		}
+		if d.RISE < 1 || d.FALL < 1 {
+			p.add(key, "RISE 以及 FALL 至少要 1")
+		}
+	}
+}
+
+// 每個規則只能用 HealthCheckNames 或 dep:<DEPENDENCIES 的 NAME>
+func (c Config) validateHealth(p *problems) {
+	if c.HEALTH.STARTUP_GRACE < 0 {
+		p.add("HEALTH.STARTUP_GRACE", "不能小於 0")
+	}
+	if c.HEALTH.MAX_REPLICATION_LAG < 0 {
+		p.add("HEALTH.MAX_REPLICATION_LAG", "不能小於 0")
+	}
+
+	for _, policy := range []struct {
+		key    string
+		policy HealthPolicy
+	}{{"HEALTH.LIVE", c.HEALTH.LIVE}, {"HEALTH.READY", c.HEALTH.READY}, {"HEALTH.FAILOVER", c.HEALTH.FAILOVER}} {
+		seen := map[string]bool{}
+		for _, list := range []struct {
+			key   string
+			names []string
+		}{{policy.key + ".REQUIRED", policy.policy.REQUIRED}, {policy.key + ".OPTIONAL", policy.policy.OPTIONAL}} {
+			for _, name := range list.names {
+				dep, isDep := strings.CutPrefix(name, "dep:")
+				switch {
+				case seen[name]:
+					p.add(list.key, "%q 重複", name)
+				case isDep && !slices.ContainsFunc(c.DEPENDENCIES, func(d DependencyConfig) bool { return d.NAME == dep }):
+					p.add(list.key, "找不到 DEPENDENCIES %q", dep)
+				case !isDep && !slices.Contains(HealthCheckNames, name):
+					p.add(list.key, "無效的項目 %q (%s 或 dep:<NAME>)", name, strings.Join(HealthCheckNames, "、"))
+				}
+				seen[name] = true
+			}
+		}
+		if n := policy.policy.MIN_OPTIONAL; n < 0 || n > len(policy.policy.OPTIONAL) {
+			p.add(policy.key+".MIN_OPTIONAL", "必須在 0 ~ %d (OPTIONAL 的數量) 之間", len(policy.policy.OPTIONAL))
+		}
+	}
+}
+
+// 仲裁程式依照 KEEPALIVED.INSTANCES 記錄每個 VIP 的角色 名稱以及 VIP 不能重複
+// 其他 keepalived 本身的問題由 keepalived lint 檢查
+func (c Config) validateInstances(p *problems) {
+	names := map[string]bool{}
+	services := map[string]bool{}
+	vips := map[string]bool{}
+	fleet := 0
+	for i, inst := range c.KEEPALIVED.INSTANCES {
+		key := fmt.Sprintf("KEEPALIVED.INSTANCES[%d]", i)
+		if inst.NAME == "" {
+			p.add(key+".NAME", "必須設定")
+		} else if names[inst.NAME] {
+			p.add(key+".NAME", "名稱 %q 重複", inst.NAME)
+		}
+		names[inst.NAME] = true
+		if services[inst.SERVICE] {
+			p.add(key+".SERVICE", "服務 %q 重複", inst.SERVICE)
+		}
+		services[inst.SERVICE] = true
+
+		if ip, _, err := net.ParseCIDR(inst.VIPCIDR()); err != nil || ip.To4() == nil {
+			p.add(key+".VIP", "必須是 IPv4 位址 %q", inst.VIP)
+		} else if vips[ip.String()] {
+			p.add(key+".VIP", "VIP %s 重複", ip)
+		} else {
+			vips[ip.String()] = true
+		}
+
+		if inst.CHECK_ADDR != "" {
+			if _, port, err := net.SplitHostPort(inst.CHECK_ADDR); err != nil {
+				p.add(key+".CHECK_ADDR", "必須是 host:port %q", inst.CHECK_ADDR)
+			} else {
+				p.port(key+".CHECK_ADDR", port, true)
+			}
+		}
+		for _, dep := range inst.DEPENDS {
+			if !slices.ContainsFunc(c.DEPENDENCIES, func(d DependencyConfig) bool { return d.NAME == dep }) {
+				p.add(key+".DEPENDS", "找不到 DEPENDENCIES %q", dep)
+			}
+		}
+		if inst.FLEET {
+			fleet++
+		}
+	}
+	if fleet > 1 {
+		p.add("KEEPALIVED.INSTANCES", "只能有一個 instance 設定 FLEET")
+	}
+
+	if f := c.KEEPALIVED.NOTIFY_FIFO; f != "" && !filepath.IsAbs(f) {
+		p.add("KEEPALIVED.NOTIFY_FIFO", "必須是絕對路徑 %q", f)
+	}
+	if c.KEEPALIVED.RECONCILE_INTERVAL < 0 {
+		p.add("KEEPALIVED.RECONCILE_INTERVAL", "不能小於 0")
+	}
+	if c.KEEPALIVED.RECONCILE_GRACE < 0 {
+		p.add("KEEPALIVED.RECONCILE_GRACE", "不能小於 0")
+	}
+	switch c.KEEPALIVED.ADDR_SOURCE {
+	case "netlink", "poll":
+	default:
+		p.add("KEEPALIVED.ADDR_SOURCE", "無效的來源 %q (netlink、poll)", c.KEEPALIVED.ADDR_SOURCE)
+	}
+}
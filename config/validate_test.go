@@ -0,0 +1,37 @@
+package config
+
+import "testing"
+
+func TestFleetHealthRequired(t *testing.T) {
+	tests := []struct {
+		rule   string
+		fleets int
+		want   int
+		ok     bool
+	}{
+		{"", 3, 3, true},
+		{"all", 3, 3, true},
+		{"any", 3, 1, true},
+		{"majority", 1, 1, true},
+		{"majority", 2, 2, true},
+		{"majority", 3, 2, true},
+		{"majority", 4, 3, true},
+		{"2", 3, 2, true},
+		{"3", 3, 3, true},
+		// 要求的數量比設定的交管多
+		{"4", 3, 0, false},
+		{"0", 3, 0, false},
+		{"-1", 3, 0, false},
+		{"most", 3, 0, false},
+	}
+	for _, tt := range tests {
+		got, err := FleetHealthRequired(tt.rule, tt.fleets)
+		if tt.ok != (err == nil) {
+			t.Errorf("FleetHealthRequired(%q, %d) err = %v, want ok=%v", tt.rule, tt.fleets, err, tt.ok)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("FleetHealthRequired(%q, %d) = %d, want %d", tt.rule, tt.fleets, got, tt.want)
+		}
+	}
+}
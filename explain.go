@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"kenmec/ha/jimmy/config"
+	"kenmec/ha/jimmy/internal"
+	"maps"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+const explainUsage = `用法:
+  ha_arbiter explain [--instance VI_1] [--all] [--json] [--config 設定檔] [--url http://localhost:50000] [--token TOKEN]`
+
+// ha_arbiter explain 向執行中的仲裁程式查詢 GET /explain 並顯示決策過程 回傳 exit code
+func runExplain(args []string) int {
+	fs := flag.NewFlagSet("explain", flag.ExitOnError)
+	fs.Usage = func() { fmt.Fprintln(os.Stderr, explainUsage) }
+	configPath := fs.String("config", config.DefaultPath(), "設定檔路徑 用來找 API_AUTH.UNIX_SOCKET 以及 WEB_API_PORT")
+	apiURL := fs.String("url", "", "仲裁程式的 REST API 空白代表本機 (有 UNIX_SOCKET 時用 socket)")
+	token := fs.String("token", os.Getenv("HA_API_TOKEN"), "API token (也可以用環境變數 HA_API_TOKEN)")
+	instance := fs.String("instance", "", "instance 或服務名稱 空白代表交管跟著的 instance")
+	all := fs.Bool("all", false, "顯示保留的全部決策")
+	raw := fs.Bool("json", false, "直接輸出 JSON")
+	fs.Parse(args)
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	base := *apiURL
+	if base == "" {
+		cfg, err := config.Load(*configPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "❌ 設定檔 %s 有錯誤 (或用 --url 指定):\n%v\n", *configPath, err)
+			return 1
+		}
+		base = "http://localhost:" + cfg.WEB_API_PORT
+		// 從 socket 來的請求不用 token
+		if socket := cfg.API_AUTH.UNIX_SOCKET; socket != "" {
+			if info, err := os.Stat(socket); err == nil && info.Mode()&os.ModeSocket != 0 {
+				base = "http://localhost"
+				client.Transport = &http.Transport{
+					DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+						var d net.Dialer
+						return d.DialContext(ctx, "unix", socket)
+					},
+				}
+			}
+		}
+	}
+
+	query := url.Values{}
+	if *instance != "" {
+		query.Set("instance", *instance)
+	}
+	if *all {
+		query.Set("all", "true")
+	}
+	req, err := http.NewRequest(http.MethodGet, strings.TrimSuffix(base, "/")+"/explain?"+query.Encode(), nil)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 1
+	}
+	if *token != "" {
+		req.Header.Set("Authorization", "Bearer "+*token)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ 無法連到仲裁程式: %v\n", err)
+		return 1
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ 讀取回應失敗: %v\n", err)
+		return 1
+	}
+	if resp.StatusCode != http.StatusOK {
+		fmt.Fprintf(os.Stderr, "❌ %s: %s\n", resp.Status, strings.TrimSpace(string(body)))
+		return 1
+	}
+	if *raw {
+		os.Stdout.Write(body)
+		fmt.Println()
+		return 0
+	}
+
+	var e internal.Explanation
+	if err := json.Unmarshal(body, &e); err != nil {
+		fmt.Fprintf(os.Stderr, "❌ 無法解析回應: %v\n", err)
+		return 1
+	}
+	printExplanation(os.Stdout, e)
+	return 0
+}
+
+func printExplanation(w io.Writer, e internal.Explanation) {
+	fmt.Fprintf(w, "%s (%s) 是 %s 從 %s 開始 (已經 %v)\n", e.Instance, e.Service, e.Role,
+		e.Since.Local().Format(time.DateTime), time.Since(e.Since).Round(time.Second))
+	if e.Decision != nil {
+		fmt.Fprintf(w, "原因: %s\n", e.Decision.Cause)
+	} else {
+		fmt.Fprintln(w, "原因: 決定這個角色的紀錄已經不在了")
+	}
+	if len(e.Chain) == 0 {
+		return
+	}
+
+	fmt.Fprintln(w, "\n決策過程:")
+	for _, d := range e.Chain {
+		mark := " "
+		if e.Decision != nil && d.Seq == e.Decision.Seq {
+			mark = "👑"
+		}
+		fmt.Fprintf(w, "%s #%d %s [%s] %s", mark, d.Seq, d.At.Local().Format("01-02 15:04:05.000"), d.Kind, d.Summary)
+		if d.Kind != internal.DecisionRole {
+			fmt.Fprintf(w, " (%s → %s)", d.From, d.To)
+		}
+		fmt.Fprintln(w)
+		fmt.Fprintf(w, "     原因: %s\n", d.Cause)
+		printDecisionInputs(w, d.Inputs)
+	}
+}
+
+func printDecisionInputs(w io.Writer, in internal.DecisionInputs) {
+	failover := "還沒檢查"
+	if in.Failover != nil {
+		failover = "ok"
+		if !in.Failover.OK {
+			failover = "not ok " + strings.Join(in.Failover.Failed, ", ")
+		}
+	}
+	fmt.Fprintf(w, "     當下: 角色 %s · 維修 %s · failover %s\n", in.Role, yesNo(in.Maintenance), failover)
+	fmt.Fprintf(w, "           本機 %s · 另外一台 %s %s\n", connectivityText(in.Self), in.PeerLiveness, connectivityText(in.Other))
+
+	hb := []string{}
+	for _, name := range slices.Sorted(maps.Keys(in.Heartbeats.Fleets)) {
+		hb = append(hb, fmt.Sprintf("交管 %s %s", name, msText(in.Heartbeats.Fleets[name])))
+	}
+	hb = append(hb, "另外一台 "+msText(in.Heartbeats.Peer))
+	if in.Heartbeats.PeerUDP != 0 {
+		hb = append(hb, "UDP "+msText(in.Heartbeats.PeerUDP))
+	}
+	fmt.Fprintf(w, "           心跳 %s\n", strings.Join(hb, " · "))
+
+	vips := []string{}
+	for _, inst := range in.Instances {
+		text := fmt.Sprintf("%s %s", inst.Name, inst.Role)
+		if inst.HoldsVIP {
+			text += " VIP在本機"
+		}
+		if inst.PeerMaster {
+			text += " 另外一台MASTER"
+		}
+		if inst.State != "" {
+			text += " keepalived " + inst.State
+		}
+		vips = append(vips, text)
+	}
+	fmt.Fprintf(w, "           VIP %s\n", strings.Join(vips, " · "))
+}
+
+func connectivityText(c internal.Connectivity) string {
+	return fmt.Sprintf("ecs%s fleet%s ha%s deps%s", check(c.ECS), check(c.Fleet), check(c.Ha), check(c.Deps))
+}
+
+func check(ok bool) string {
+	if ok {
+		return "✓"
+	}
+	return "✗"
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "是"
+	}
+	return "否"
+}
+
+func msText(ms int64) string {
+	return (time.Duration(ms) * time.Millisecond).Round(time.Millisecond).String()
+}
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"bytes"
+	"embed"
+	"flag"
+	"fmt"
+	"io/fs"
+	"kenmec/ha/jimmy/config"
+	"kenmec/ha/jimmy/internal"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// 內建的 keepalived 腳本 依照設定的 KEEPALIVED.SCRIPTS / NOTIFY 安裝
+//
+//go:embed VIP/check_server_alive.sh VIP/chk_server_health.sh VIP/notify_role.sh
+var bundledScripts embed.FS
+
+const systemdUnit = `[Unit]
+Description=HA arbiter
+After=network-online.target
+Wants=network-online.target
+Before=keepalived.service
+
+[Service]
+ExecStart=%s --config %s
+Restart=always
+RestartSec=2
+RuntimeDirectory=ha_arbiter
+# 重開仲裁程式時保留 notify_fifo keepalived 還開著同一個 FIFO
+RuntimeDirectoryPreserve=yes
+
+[Install]
+WantedBy=multi-user.target
+`
+
+const installUsage = `用法:
+  ha_arbiter install [--config 設定檔] [--root /] [--dry-run]`
+
+// 要安裝的一個檔案 path 是實際機器上的路徑 (不含 --root)
+type installFile struct {
+	path string
+	data []byte
+	mode fs.FileMode
+}
+
+// ha_arbiter install 安裝 keepalived.conf、腳本以及 systemd unit 回傳 exit code
+func runInstall(args []string) int {
+	flags := flag.NewFlagSet("install", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, installUsage)
+		flags.PrintDefaults()
+	}
+	configPath := flags.String("config", config.DefaultPath(), "設定檔路徑 (也可以用環境變數 HA_CONFIG)")
+	root := flags.String("root", "/", "安裝的根目錄 測試時可以指定暫存目錄")
+	dryRun := flags.Bool("dry-run", false, "只顯示差異 不寫入")
+	keepalivedConf := flags.String("keepalived-conf", "/etc/keepalived/keepalived.conf", "keepalived 設定檔的位置")
+	unitPath := flags.String("unit", "/etc/systemd/system/ha_arbiter.service", "systemd unit 的位置")
+	binPath := flags.String("bin", "/usr/local/bin/ha_arbiter", "systemd 啟動的程式位置")
+	flags.Parse(args)
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ 設定檔 %s 有錯誤:\n%v\n", *configPath, err)
+		return 1
+	}
+	absConfig, err := filepath.Abs(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 1
+	}
+
+	failed := false
+	for _, issue := range internal.LintKeepalived(cfg.KEEPALIVED, "") {
+		fmt.Fprintln(os.Stderr, issue)
+		failed = failed || issue.Error
+	}
+	if failed {
+		return 1
+	}
+
+	files, err := installFiles(cfg, *keepalivedConf, *unitPath, *binPath, absConfig, *root)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 1
+	}
+
+	changed := 0
+	for _, f := range files {
+		target := filepath.Join(*root, f.path)
+		diff, err := diffInstalled(target, f)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+			return 1
+		}
+		if diff == "" {
+			fmt.Printf("✅ %s 沒有變動\n", f.path)
+			continue
+		}
+		changed++
+		fmt.Print(diff)
+
+		if *dryRun {
+			continue
+		}
+		if err := writeInstalled(target, f); err != nil {
+			fmt.Fprintf(os.Stderr, "❌ 寫入 %s 失敗: %v\n", target, err)
+			return 1
+		}
+		fmt.Printf("📄 已安裝 %s\n", f.path)
+	}
+
+	switch {
+	case *dryRun:
+		fmt.Printf("🔍 dry-run: %d 個檔案會被修改 沒有寫入任何檔案\n", changed)
+	case changed > 0:
+		fmt.Println("🔧 完成 請執行 systemctl daemon-reload && systemctl restart ha_arbiter keepalived")
+	}
+	return 0
+}
+
+// 依照設定決定要安裝哪些檔案
+func installFiles(cfg *config.Config, keepalivedConf, unitPath, binPath, configPath, root string) ([]installFile, error) {
+	conf, err := internal.RenderKeepalived(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("產生 keepalived.conf 失敗: %w", err)
+	}
+
+	files := []installFile{
+		// 有 VRRP 密碼 不給其他人讀
+		{path: keepalivedConf, data: conf, mode: 0o640},
+		{path: unitPath, data: fmt.Appendf(nil, systemdUnit, binPath, configPath), mode: 0o644},
+	}
+
+	k := cfg.KEEPALIVED
+	var scripts []string
+	if k.NOTIFY_FIFO == "" {
+		scripts = append(scripts, k.ScriptPath(k.NOTIFY))
+	}
+	for _, s := range k.SCRIPTS {
+		scripts = append(scripts, k.ScriptPath(s.SCRIPT))
+	}
+
+	seen := map[string]bool{}
+	for _, script := range scripts {
+		if seen[script] {
+			continue
+		}
+		seen[script] = true
+
+		name := filepath.Base(script)
+		data, err := bundledScripts.ReadFile(path.Join("VIP", name))
+		if err != nil {
+			// 不是內建的腳本 要自己放
+			if _, err := os.Stat(filepath.Join(root, script)); err != nil {
+				fmt.Fprintf(os.Stderr, "⚠️  %s 不是內建的腳本 請自行安裝\n", script)
+			}
+			continue
+		}
+		files = append(files, installFile{path: script, data: scriptVars(cfg, name, data), mode: 0o755})
+	}
+	return files, nil
+}
+
+// 把腳本開頭的 PORT、SOCKET 換成設定的值
+func scriptVars(cfg *config.Config, name string, data []byte) []byte {
+	vars := map[string]string{
+		"PORT":   cfg.WEB_API_PORT,
+		"SOCKET": cfg.API_AUTH.UNIX_SOCKET,
+	}
+	// check_server_alive.sh 的 PORT 是交管的 port 不是 API
+	if name == "check_server_alive.sh" {
+		delete(vars, "PORT")
+	}
+
+	for key, value := range vars {
+		re := regexp.MustCompile(`(?m)^` + key + `=.*$`)
+		data = re.ReplaceAllLiteral(data, fmt.Appendf(nil, "%s=%q", key, value))
+	}
+	return data
+}
+
+// 跟已經安裝的檔案比較 沒有差異時回傳空字串
+func diffInstalled(target string, f installFile) (string, error) {
+	old, err := os.ReadFile(target)
+	if os.IsNotExist(err) {
+		return unifiedDiff("/dev/null", f.path, nil, f.data) + fmt.Sprintf("   新檔案 權限 %04o\n", f.mode), nil
+	}
+	if err != nil {
+		return "", err
+	}
+	info, err := os.Stat(target)
+	if err != nil {
+		return "", err
+	}
+
+	var out strings.Builder
+	if !bytes.Equal(old, f.data) {
+		out.WriteString(unifiedDiff(f.path, f.path, old, f.data))
+	}
+	if info.Mode().Perm() != f.mode {
+		fmt.Fprintf(&out, "   %s 權限 %04o → %04o\n", f.path, info.Mode().Perm(), f.mode)
+	}
+	return out.String(), nil
+}
+
+// 先寫到暫存檔再換名字 避免 keepalived 讀到寫一半的檔案
+func writeInstalled(target string, f installFile) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(target), "."+filepath.Base(target)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(f.data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(f.mode); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), target)
+}
+
+// 簡單的 unified diff 前後各留 3 行
+func unifiedDiff(oldName, newName string, old, new []byte) string {
+	a, b := splitLines(old), splitLines(new)
+
+	// LCS 表 檔案都很小 直接用 O(n*m)
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	type line struct {
+		op   byte
+		text string
+	}
+	var lines []line
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			lines = append(lines, line{' ', a[i]})
+			i++
+			j++
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			lines = append(lines, line{'-', a[i]})
+			i++
+		default:
+			lines = append(lines, line{'+', b[j]})
+			j++
+		}
+	}
+
+	const context = 3
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", oldName, newName)
+	lastPrinted := -1
+	for n, l := range lines {
+		near := false
+		for k := max(0, n-context); k <= min(len(lines)-1, n+context); k++ {
+			if lines[k].op != ' ' {
+				near = true
+				break
+			}
+		}
+		if !near {
+			continue
+		}
+		if lastPrinted >= 0 && n > lastPrinted+1 || lastPrinted < 0 && n > 0 {
+			out.WriteString("@@\n")
+		}
+		fmt.Fprintf(&out, "%c%s\n", l.op, l.text)
+		lastPrinted = n
+	}
+	return out.String()
+}
+
+func splitLines(data []byte) []string {
+	if len(data) == 0 {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+}
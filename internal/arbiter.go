@@ -13,9 +13,10 @@ import (
 )
 
 type Connectivity struct {
-	ECS   bool
-	Fleet bool
-	Ha    bool
+	ECS   bool `json:"ecs"`
+	Fleet bool `json:"fleet"`
+	Ha    bool `json:"ha"`
+	Deps  bool `json:"deps"` // REQUIRED 的依賴服務都正常 另外一台的由 PeerArbiter 帶過來
 }
 
 type Arbiter struct {
@@ -25,44 +26,80 @@ type Arbiter struct {
 
 	IsMaster    bool
 	Maintenance bool
+	epoch       uint64 // 角色變更的次數 放在 UDP 心跳裡
+	startedAt   time.Time
 
-	lastFleetHb    time.Time
 	hbFleetTimeout time.Duration
 
 	lastOtherHaHb  time.Time
 	hbOtherTimeout time.Duration
 
+	fleetPhiThreshold float64 // 小於等於 0 代表只用 hbFleetTimeout
+	otherPhiThreshold float64 // 小於等於 0 代表只用 hbOtherTimeout
+
+	udpHb        *api.UDPHeartbeatChannel // nil 代表沒有啟用 UDP 心跳
+	lastUDPHb    time.Time
+	peerUDP      *api.UDPHeartbeat // 最後一次收到另外一台的 UDP 心跳
+	peerLiveness PeerLiveness
+
 	Self  Connectivity // 自己機器的連線狀態
 	Other Connectivity // 另外一台的連線狀態
 
-	fleetClient   *api.GRPCFleetClient
-	otherHaClient *api.GRPCHAClient
+	configCheck ConfigConsistency // 與另外一台HA設定比對的結果
+	reloader    configReloader
+	events      *EventLog
+
+	instances     []*vipInstance // 每個 VRRP instance (VIP) 的角色 IsMaster 是交管跟著的那個
+	addrs         addrSource     // 本機持有的位址 用來確認 VIP 在不在本機
+	addrErr       string         // 上次取得位址的錯誤 一樣的錯誤只寫一次日誌
+	health        healthState    // 每個健康檢查項目的結果從什麼時候開始
+	decisions     decisionLog    // 影響角色的決策以及當下看到的狀態 (GET /explain)
+	vipSplit      bool           // VIP 分散在兩台上
+	deps          []*dependency  // 依賴的服務 (RabbitMQ、MySQL 等)
+	replication   replicationStats
+	metrics       *arbiterMetrics
+	peerLostAt    time.Time       // 另外一台從 alive 變成不見的時間 用來計算接手花了多久
+	fleets        []*fleetLink    // 本機的每一個交管
+	fleetRule     FleetHealthRule // 幾個交管正常才算 Self.Fleet
+	peerPaths     []*peerPath     // 連到另外一台HA的每一條網路路徑
 	otherHaServer *api.HAToOtherServer
 }
 
 func NewArbiter(
-	fleetClient *api.GRPCFleetClient,
-	otherHaClient *api.GRPCHAClient,
+	fleets []FleetEndpoint,
+	otherHaClients []*api.GRPCHAClient,
 	otherHaServer *api.HAToOtherServer,
+	udpHb *api.UDPHeartbeatChannel,
 ) *Arbiter {
 	ctx, cancel := context.WithCancel(context.Background())
+	cfg := config.Current()
+	fleetInterval := cfg.FLEET_HB_INTERVAL.Duration()
+	otherInterval := cfg.OTHER_HA_HB_INTERVAL.Duration()
+
 	return &Arbiter{
 		ctx:    ctx,
 		cancel: cancel,
 
 		IsMaster:    false,
 		Maintenance: false,
+		startedAt:   time.Now(),
 
-		lastFleetHb:    time.Now(),
-		hbFleetTimeout: time.Duration(config.Cfg.FLEET_HB_TIMEOUT) * time.Second,
+		hbFleetTimeout: cfg.FLEET_HB_TIMEOUT.Duration(),
 
 		lastOtherHaHb:  time.Now(),
-		hbOtherTimeout: time.Duration(config.Cfg.OTHER_HA_HB_TIMEOUT) * time.Second,
+		hbOtherTimeout: cfg.OTHER_HA_HB_TIMEOUT.Duration(),
+
+		fleetPhiThreshold: cfg.FLEET_PHI_THRESHOLD,
+		otherPhiThreshold: cfg.OTHER_HA_PHI_THRESHOLD,
+
+		udpHb:        udpHb,
+		peerLiveness: PeerGone,
 
 		Self: Connectivity{
 			ECS:   false,
 			Fleet: false,
 			Ha:    true,
+			Deps:  true,
 		},
 		Other: Connectivity{
 			ECS:   false,
@@ -70,25 +107,41 @@ func NewArbiter(
 			Ha:    false,
 		},
 
-		fleetClient:   fleetClient,
-		otherHaClient: otherHaClient,
+		instances: newVipInstances(cfg.KEEPALIVED),
+		addrs:     newAddrSource(cfg.KEEPALIVED),
+		health: healthState{
+			checks:   map[string]healthSince{},
+			policies: map[string]healthSince{},
+			results:  map[string]HealthResult{},
+		},
+		deps:          newDependencies(cfg.DEPENDENCIES),
+		fleets:        newFleetLinks(fleets, fleetInterval),
+		fleetRule:     newFleetHealthRule(len(fleets)),
+		peerPaths:     newPeerPaths(otherHaClients, otherInterval),
 		otherHaServer: otherHaServer,
+		events:        NewEventLog(),
+		metrics:       newArbiterMetrics(),
 	}
 }
 
 // 每秒傳送本機的連線資訊到另外一台HA
-func (a *Arbiter) StartSyncArbiter(ctx context.Context) {
+func (a *Arbiter) StartSyncArbiter() {
 	ticker := time.NewTicker(1 * time.Second)
+	defer ticker.Stop()
 	for {
 		select {
-		case <-ctx.Done():
+		case <-a.ctx.Done():
 			return
 		case <-ticker.C:
-			a.otherHaClient.SendMessage(&gen.StatusRequest{
+			a.mu.RLock()
+			self := a.Self
+			a.mu.RUnlock()
+			a.sendToPeer(&gen.StatusRequest{
 				Payload: &gen.StatusRequest_PeerArbiter{
 					PeerArbiter: &gen.PeerArbiter{
-						Ecs:   a.Self.ECS,
-						Fleet: a.Self.Fleet,
+						Ecs:   self.ECS,
+						Fleet: self.Fleet,
+						Deps:  self.Deps,
 					},
 				},
 			})
@@ -97,27 +150,123 @@ func (a *Arbiter) StartSyncArbiter(ctx context.Context) {
 
 }
 
-func (a *Arbiter) UpdateMaster(master bool) {
+func onOff(on bool) string {
+	if on {
+		return "on"
+	}
+	return "off"
+}
+
+// 更新另外一台回報的連線狀態
+func (a *Arbiter) updateOther(update func(c *Connectivity)) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	before := a.Other
+	update(&a.Other)
+	a.recordConnectivityLocked("other", before, a.Other)
+}
+
+// SetMaintenance 開關維修模式 by 是誰改的 (記錄用)
+func (a *Arbiter) SetMaintenance(enable bool, by string) {
+	message := "維修模式關閉"
+	if enable {
+		message = "維修模式開啟"
+	}
+
 	a.mu.Lock()
-	a.IsMaster = master
+	changed := a.Maintenance != enable
+	if changed {
+		a.decideLocked(Decision{
+			Kind:    DecisionMaintenance,
+			From:    onOff(a.Maintenance),
+			To:      onOff(enable),
+			Summary: message,
+			Cause:   DecisionCause{Source: CauseAPI, Detail: by},
+		})
+	}
+	a.Maintenance = enable
 	a.mu.Unlock()
-	a.fleetClient.SendMessageToFleet(&gen.ClientMessage{
-		Payload: &gen.ClientMessage_IsMaster{
-			IsMaster: master,
-		},
+
+	if !changed {
+		return
+	}
+	log.Printf("🔧 [維修] %s (%s)", message, by)
+	a.events.Record(EventMaintenance, message, map[string]any{
+		"enable": enable,
+		"by":     by,
 	})
 }
 
+// Switchover 把 VIP 切到另外一台 做法是讓本機進入維修模式 keepalived 的 track_script 失敗後 VIP 就會移到另外一台
+// 本機必須是 MASTER 另外一台必須活著 force 可以跳過另外一台的檢查
+func (a *Arbiter) Switchover(by string, force bool) error {
+	a.mu.RLock()
+	master, maintenance, liveness := a.IsMaster, a.Maintenance, a.peerLiveness
+	a.mu.RUnlock()
+
+	switch {
+	case !master:
+		return fmt.Errorf("這台不是 MASTER 請在 MASTER 那台執行")
+	case maintenance:
+		return fmt.Errorf("這台已經在維修模式")
+	case liveness != PeerAlive && !force:
+		return fmt.Errorf("另外一台的狀態是 %s 切過去可能沒有人接手 (確定要切換請帶 force=true)", liveness)
+	}
+
+	log.Printf("🔀 [切換] %s 要求把 VIP 切到另外一台", by)
+	detail := by
+	if force {
+		detail += " (force)"
+	}
+	a.decide(Decision{
+		Kind:    DecisionSwitchover,
+		From:    "MASTER",
+		To:      "BACKUP",
+		Summary: "手動切換到另外一台 進入維修模式",
+		Cause:   DecisionCause{Source: CauseAPI, Detail: detail},
+	})
+	a.events.Record(EventSwitchover, "手動切換到另外一台", map[string]any{
+		"by":    by,
+		"force": force,
+		"peer":  liveness,
+	})
+	a.SetMaintenance(true, by)
+	return nil
+}
+
+// 另外一台連進來或斷線
+func (a *Arbiter) onPeerClientChange(info api.ClientInfo, connected bool) {
+	if connected {
+		a.mu.RLock()
+		if info.Path >= 0 && info.Path < len(a.peerPaths) {
+			a.peerPaths[info.Path].detector.Restart()
+		}
+		a.mu.RUnlock()
+		a.events.Record(EventPeerConnect, fmt.Sprintf("另外一台 %s 從 %s 連線", info.ID, info.Remote), info)
+	} else {
+		a.events.Record(EventPeerLeave, fmt.Sprintf("另外一台 %s 斷線", info.ID), info)
+	}
+}
+
 func (a *Arbiter) MsgHandler() {
+	a.otherHaServer.OnPathHeartbeat = a.onPathHeartbeat
+	a.otherHaServer.OnClientChange = a.onPeerClientChange
 	a.otherHaMsgHandler()
-	a.fleetMsgHandler()
-	a.whenFleetConnect()
+	for _, f := range a.fleets {
+		a.fleetMsgHandler(f)
+		a.whenFleetConnect(f)
+	}
 	a.whenBackupConnect()
 }
 
 // 接收來自其他的HA的資料
 func (a *Arbiter) otherHaMsgHandler() {
 	a.otherHaServer.OnReceiveMsg = func(msg *gen.StatusRequest) {
+		a.metrics.messages.inc("from_peer", payloadType(msg))
+		if isReplication(msg) {
+			a.replication.recordReceived(msg.SentAt)
+		}
 
 		switch m := msg.Payload.(type) {
 		case *gen.StatusRequest_Hb:
@@ -125,84 +274,95 @@ func (a *Arbiter) otherHaMsgHandler() {
 			a.lastOtherHaHb = time.Now()
 			a.mu.Unlock()
 		case *gen.StatusRequest_IsHaConnected:
-			a.Other.Ha = m.IsHaConnected
+			a.updateOther(func(c *Connectivity) { c.Ha = m.IsHaConnected })
 		case *gen.StatusRequest_IsEcsConnected:
-			a.Other.Fleet = m.IsEcsConnected
+			a.updateOther(func(c *Connectivity) { c.Fleet = m.IsEcsConnected })
 		case *gen.StatusRequest_IsFleetConnected:
-			a.Other.Fleet = m.IsFleetConnected
+			a.updateOther(func(c *Connectivity) { c.Fleet = m.IsFleetConnected })
+		case *gen.StatusRequest_PeerArbiter:
+			// Ha 由本機的 liveness 判斷 不用另外一台說的
+			a.updateOther(func(c *Connectivity) {
+				c.ECS = m.PeerArbiter.Ecs
+				c.Fleet = m.PeerArbiter.Fleet
+				c.Deps = m.PeerArbiter.Deps
+			})
+		case *gen.StatusRequest_PeerConfig:
+			a.handlePeerConfig(m.PeerConfig)
+		case *gen.StatusRequest_VipRoles:
+			a.handlePeerVipRoles(m.VipRoles)
 
 		case *gen.StatusRequest_SyncMission:
-			a.fleetClient.SendMessageToFleet(&gen.ClientMessage{
+			a.sendToFleet(&gen.ClientMessage{
 				Payload: &gen.ClientMessage_SyncMission{
 					SyncMission: m.SyncMission,
 				},
 			})
 
 		case *gen.StatusRequest_AgvWorkStatus:
-			a.fleetClient.SendMessageToFleet(&gen.ClientMessage{
+			a.sendToFleet(&gen.ClientMessage{
 				Payload: &gen.ClientMessage_AgvWorkStatus{
 					AgvWorkStatus: m.AgvWorkStatus,
 				},
 			})
 
 		case *gen.StatusRequest_MissionReport:
-			a.fleetClient.SendMessageToFleet(&gen.ClientMessage{
+			a.sendToFleet(&gen.ClientMessage{
 				Payload: &gen.ClientMessage_MissionReport{
 					MissionReport: m.MissionReport,
 				},
 			})
 
 		case *gen.StatusRequest_UpdateCargoInfo:
-			a.fleetClient.SendMessageToFleet(&gen.ClientMessage{
+			a.sendToFleet(&gen.ClientMessage{
 				Payload: &gen.ClientMessage_UpdateCargoInfo{
 					UpdateCargoInfo: m.UpdateCargoInfo,
 				},
 			})
 
 		case *gen.StatusRequest_SaveCargoInfo:
-			a.fleetClient.SendMessageToFleet(&gen.ClientMessage{
+			a.sendToFleet(&gen.ClientMessage{
 				Payload: &gen.ClientMessage_SaveCargoInfo{
 					SaveCargoInfo: m.SaveCargoInfo,
 				},
 			})
 
 		case *gen.StatusRequest_UpdateAmrCargoInfo:
-			a.fleetClient.SendMessageToFleet(&gen.ClientMessage{
+			a.sendToFleet(&gen.ClientMessage{
 				Payload: &gen.ClientMessage_UpdateAmrCargoInfo{
 					UpdateAmrCargoInfo: m.UpdateAmrCargoInfo,
 				},
 			})
 
 		case *gen.StatusRequest_MissionAssign:
-			a.fleetClient.SendMessageToFleet(&gen.ClientMessage{
+			a.sendToFleet(&gen.ClientMessage{
 				Payload: &gen.ClientMessage_MissionAssign{
 					MissionAssign: m.MissionAssign,
 				},
 			})
 
 		case *gen.StatusRequest_BookBlock:
-			a.fleetClient.SendMessageToFleet(&gen.ClientMessage{
+			a.sendToFleet(&gen.ClientMessage{
 				Payload: &gen.ClientMessage_BookBlock{
 					BookBlock: m.BookBlock,
 				},
 			})
 
 		case *gen.StatusRequest_SyncAllMission:
-			a.fleetClient.SendMessageToFleet(&gen.ClientMessage{
+			a.sendToFleet(&gen.ClientMessage{
 				Payload: &gen.ClientMessage_SyncAllMission{
 					SyncAllMission: m.SyncAllMission,
 				},
 			})
 
 		case *gen.StatusRequest_SyncAllDbCargo:
-			a.fleetClient.SendMessageToFleet(&gen.ClientMessage{
+			a.sendToFleet(&gen.ClientMessage{
 				Payload: &gen.ClientMessage_SyncAllDbCargo{
 					SyncAllDbCargo: m.SyncAllDbCargo,
 				},
 			})
 
 		case *gen.StatusRequest_SyncAllMemoryCargo:
-			a.fleetClient.SendMessageToFleet(&gen.ClientMessage{
+			a.sendToFleet(&gen.ClientMessage{
 				Payload: &gen.ClientMessage_SyncAllMemoryCargo{
 					SyncAllMemoryCargo: m.SyncAllMemoryCargo,
 				},
@@ -215,10 +375,24 @@ func (a *Arbiter) otherHaMsgHandler() {
 	}
 }
 
-func (a *Arbiter) whenFleetConnect() {
-	a.fleetClient.OnFleetConnected = func() {
-		log.Println("連線到本機交管")
-		a.UpdateMaster(a.IsMaster)
+func (a *Arbiter) whenFleetConnect(f *fleetLink) {
+	f.client.OnFleetConnected = func() {
+		log.Printf("連線到本機交管 %s", f.name)
+		f.detector.Restart()
+		a.mu.RLock()
+		master := a.IsMaster
+		roles := a.vipRolesLocked()
+		a.mu.RUnlock()
+		a.sendFleet(f, &gen.ClientMessage{
+			Payload: &gen.ClientMessage_IsMaster{
+				IsMaster: master,
+			},
+		})
+		a.sendFleet(f, &gen.ClientMessage{
+			Payload: &gen.ClientMessage_VipRoles{
+				VipRoles: roles,
+			},
+		})
 	}
 }
 
@@ -228,7 +402,7 @@ func (a *Arbiter) whenBackupConnect() {
 	}
 
 	a.otherHaServer.OnClientConnected = func() {
-		a.fleetClient.SendMessageToFleet(&gen.ClientMessage{
+		a.broadcastToFleets(&gen.ClientMessage{
 			Payload: &gen.ClientMessage_BackupConnected{
 				BackupConnected: time.Now().GoString(),
 			},
@@ -237,38 +411,48 @@ func (a *Arbiter) whenBackupConnect() {
 }
 
 // 接收來自交管資料
-func (a *Arbiter) fleetMsgHandler() {
-	a.fleetClient.OnReceiveMsg = func(msg *gen.ServerMessage) {
+func (a *Arbiter) fleetMsgHandler(f *fleetLink) {
+	f.client.OnReceiveMsg = func(msg *gen.ServerMessage) {
 		// 先檢查 payload 是否為空
 		if msg.Payload == nil {
-			log.Printf("⚠️ 收到空的 ServerMessage")
+			config.LogWarnf("⚠️ 收到空的 ServerMessage")
 			return
 		}
+		a.metrics.messages.inc("from_fleet", payloadType(msg))
 
 		switch m := msg.Payload.(type) {
 		case *gen.ServerMessage_Hb:
+			now := time.Now()
 			a.mu.Lock()
-			a.lastFleetHb = time.Now()
+			f.detector.Heartbeat(now, a.hbFleetTimeout)
+			interval := now.Sub(f.lastHb)
+			f.lastHb = now
 			a.mu.Unlock()
+			a.metrics.hbInterval.observe(interval.Seconds(), "fleet", f.name)
+
+		case *gen.ServerMessage_ProbeEcho:
+			a.handleProbeEcho(f, m.ProbeEcho)
 
 		case *gen.ServerMessage_IsEcsConnected:
 			a.mu.Lock()
-			a.Self.ECS = m.IsEcsConnected
+			f.ecs = m.IsEcsConnected
+			a.updateFleetConnectivityLocked()
 			a.mu.Unlock()
-			log.Printf("🌐 [網路狀態] ECS 連線變更: %v", m.IsEcsConnected)
+			log.Printf("🌐 [網路狀態] %s ECS 連線變更: %v", f.name, m.IsEcsConnected)
 
 		case *gen.ServerMessage_IsFleetConnected:
-			a.fleetClient.UpdateConnectStatus(m.IsFleetConnected)
+			f.client.UpdateConnectStatus(m.IsFleetConnected)
 			a.mu.Lock()
-			a.Self.Fleet = m.IsFleetConnected
+			f.up = m.IsFleetConnected
+			a.updateFleetConnectivityLocked()
 			a.mu.Unlock()
-			log.Printf("🚚 [網路狀態] Fleet 連線變更: %v", m.IsFleetConnected)
+			log.Printf("🚚 [網路狀態] %s Fleet 連線變更: %v", f.name, m.IsFleetConnected)
 
 		case *gen.ServerMessage_SyncMission:
 			info := m.SyncMission
 			log.Printf("📋 [任務同步] 收到任務")
 
-			a.otherHaClient.SendMessage(&gen.StatusRequest{
+			a.sendToPeer(&gen.StatusRequest{
 				Payload: &gen.StatusRequest_SyncMission{
 					SyncMission: info,
 				},
@@ -279,7 +463,7 @@ func (a *Arbiter) fleetMsgHandler() {
 			log.Printf("🤖 [車輛狀態] AMR: %s (正在指派: %v, 指派中任務: %s)",
 				status.AmrId, status.IsAssigning, status.CurrentMissionId)
 
-			a.otherHaClient.SendMessage(&gen.StatusRequest{
+			a.sendToPeer(&gen.StatusRequest{
 				Payload: &gen.StatusRequest_AgvWorkStatus{
 					AgvWorkStatus: status,
 				},
@@ -290,7 +474,7 @@ func (a *Arbiter) fleetMsgHandler() {
 			log.Printf("📊 [任務報表] 類型: %s, 任務ID: %s, AMR: %s, 步驟: %d",
 				report.ReportType, report.MissionId, report.AmrId, report.GetStep())
 
-			a.otherHaClient.SendMessage(&gen.StatusRequest{
+			a.sendToPeer(&gen.StatusRequest{
 				Payload: &gen.StatusRequest_MissionReport{
 					MissionReport: report,
 				},
@@ -300,7 +484,7 @@ func (a *Arbiter) fleetMsgHandler() {
 			cuInfo := m.UpdateCargoInfo
 			log.Printf("📦 [貨物] 編輯於地點: %s", cuInfo.LocationId)
 
-			a.otherHaClient.SendMessage(&gen.StatusRequest{
+			a.sendToPeer(&gen.StatusRequest{
 				Payload: &gen.StatusRequest_UpdateCargoInfo{
 					UpdateCargoInfo: cuInfo,
 				},
@@ -310,7 +494,7 @@ func (a *Arbiter) fleetMsgHandler() {
 			saveCargo := m.SaveCargoInfo
 			log.Printf("📦 [貨物] 搬運: %s, 地點: %s", saveCargo.AmrId, saveCargo.LocationId)
 
-			a.otherHaClient.SendMessage(&gen.StatusRequest{
+			a.sendToPeer(&gen.StatusRequest{
 				Payload: &gen.StatusRequest_SaveCargoInfo{
 					SaveCargoInfo: saveCargo,
 				},
@@ -320,7 +504,7 @@ func (a *Arbiter) fleetMsgHandler() {
 			amrCargo := m.UpdateAmrCargoInfo
 			log.Printf("📦 [貨物] 更新車輛貨物:%s ", amrCargo.AmrId)
 
-			a.otherHaClient.SendMessage(&gen.StatusRequest{
+			a.sendToPeer(&gen.StatusRequest{
 				Payload: &gen.StatusRequest_UpdateAmrCargoInfo{
 					UpdateAmrCargoInfo: amrCargo,
 				},
@@ -328,7 +512,7 @@ func (a *Arbiter) fleetMsgHandler() {
 
 		case *gen.ServerMessage_MissionAssign:
 			log.Printf("📋 [任務指派] mission id: %s, amrId: %s", m.MissionAssign.MissionId, m.MissionAssign.AmrId)
-			a.otherHaClient.SendMessage(&gen.StatusRequest{
+			a.sendToPeer(&gen.StatusRequest{
 				Payload: &gen.StatusRequest_MissionAssign{
 					MissionAssign: m.MissionAssign,
 				},
@@ -336,7 +520,7 @@ func (a *Arbiter) fleetMsgHandler() {
 
 		case *gen.ServerMessage_BookBlock:
 			log.Printf("📋 [儲位預定]")
-			a.otherHaClient.SendMessage(&gen.StatusRequest{
+			a.sendToPeer(&gen.StatusRequest{
 				Payload: &gen.StatusRequest_BookBlock{
 					BookBlock: m.BookBlock,
 				},
@@ -344,21 +528,21 @@ func (a *Arbiter) fleetMsgHandler() {
 
 		case *gen.ServerMessage_SyncAllMission:
 			log.Printf("📋 [同步所有任務]")
-			a.otherHaClient.SendMessage(&gen.StatusRequest{
+			a.sendToPeer(&gen.StatusRequest{
 				Payload: &gen.StatusRequest_SyncAllMission{
 					SyncAllMission: m.SyncAllMission,
 				},
 			})
 
 		case *gen.ServerMessage_SyncAllDbCargo:
-			a.otherHaClient.SendMessage(&gen.StatusRequest{
+			a.sendToPeer(&gen.StatusRequest{
 				Payload: &gen.StatusRequest_SyncAllDbCargo{
 					SyncAllDbCargo: m.SyncAllDbCargo,
 				},
 			})
 
 		case *gen.ServerMessage_SyncAllMemoryCargo:
-			a.otherHaClient.SendMessage(&gen.StatusRequest{
+			a.sendToPeer(&gen.StatusRequest{
 				Payload: &gen.StatusRequest_SyncAllMemoryCargo{
 					SyncAllMemoryCargo: m.SyncAllMemoryCargo,
 				},
@@ -371,9 +555,9 @@ func (a *Arbiter) fleetMsgHandler() {
 	}
 }
 
-// 監測與交管心跳是否有延遲
+// 監測與每個交管心跳是否有延遲
 func (a *Arbiter) StartFleetHbMonitor() {
-	ticker := time.NewTicker(1 * time.Second)
+	ticker := time.NewTicker(detectorTick)
 
 	for {
 		select {
@@ -381,27 +565,49 @@ func (a *Arbiter) StartFleetHbMonitor() {
 			return
 		case <-ticker.C:
 			a.mu.RLock()
-			last := a.lastFleetHb
 			timeout := a.hbFleetTimeout
+			threshold := a.fleetPhiThreshold
 			a.mu.RUnlock()
 
-			if time.Since(last) > timeout || !a.fleetClient.IsConnectedToFleet() {
-				log.Printf("⚠️  WARN: Fleet heartbeat timeout! 超過 %v 秒未收到", timeout.Seconds())
-				a.mu.Lock()
-				a.Self.Fleet = false
-				a.mu.Unlock()
-			} else {
+			for _, f := range a.fleets {
+				a.mu.RLock()
+				last := f.lastHb
+				wasUp := f.up
+				serving := f.serving && f.processing
+				a.mu.RUnlock()
+
+				alive := heartbeatAlive(f.detector, threshold, last, timeout)
+				up := alive && serving && f.client.IsConnectedToFleet()
+				if !up && wasUp {
+					if !alive {
+						config.LogWarnf("⚠️  WARN: Fleet %s heartbeat timeout! 已經 %v 未收到", f.name, time.Since(last).Round(time.Millisecond))
+						a.metrics.hbTimeouts.inc("fleet", f.name)
+						a.events.Record(EventHeartbeat, f.name+" 心跳超時", map[string]any{
+							"source": "fleet",
+							"name":   f.name,
+							"age_ms": time.Since(last).Milliseconds(),
+						})
+					} else {
+						config.LogWarnf("⚠️  WARN: Fleet %s 不可用 (連線: %v, health/echo: %v)", f.name, f.client.IsConnectedToFleet(), serving)
+					}
+				}
+
 				a.mu.Lock()
-				a.Self.Fleet = true
+				f.up = up
 				a.mu.Unlock()
 			}
+
+			a.mu.Lock()
+			a.updateFleetConnectivityLocked()
+			a.mu.Unlock()
 		}
 	}
 }
 
 // 跟另外一台HA心跳用
 func (a *Arbiter) StartHeartbeatToOtherHA() {
-	ticker := time.NewTicker(time.Duration(config.Cfg.OTHER_HA_HB_INTERVAL) * time.Second)
+	interval := config.Current().OTHER_HA_HB_INTERVAL.Duration()
+	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 
 	for {
@@ -409,22 +615,15 @@ func (a *Arbiter) StartHeartbeatToOtherHA() {
 		case <-a.ctx.Done():
 			return
 		case <-ticker.C:
-			err := a.otherHaClient.SendMessage(&gen.StatusRequest{
-				Payload: &gen.StatusRequest_Hb{
-					Hb: int32(time.Now().Unix()),
-				},
-			})
-
-			if err != nil {
-				log.Printf("💓 心跳到其他HA發送失敗: %v", err)
-			}
+			a.sendHeartbeatToAllPaths()
+			retick(ticker, &interval, config.Current().OTHER_HA_HB_INTERVAL.Duration())
 		}
 	}
 }
 
 // 監測與另外一台HA是否有延遲
 func (a *Arbiter) StartOtherHaHbMonitor() {
-	ticker := time.NewTicker(1 * time.Second)
+	ticker := time.NewTicker(detectorTick)
 
 	for {
 		select {
@@ -432,54 +631,49 @@ func (a *Arbiter) StartOtherHaHbMonitor() {
 			return
 		case <-ticker.C:
 			a.mu.RLock()
-			last := a.lastOtherHaHb
 			timeout := a.hbOtherTimeout
 			a.mu.RUnlock()
 
-			if time.Since(last) > timeout {
-				log.Printf("⚠️  WARN: other ha heartbeat timeout! 超過 %v 秒未收到", timeout.Seconds())
-				a.mu.Lock()
-				a.Other.Ha = false
-				a.mu.Unlock()
-			} else {
-				a.mu.Lock()
-				a.Other.Ha = true
-				a.mu.Unlock()
-			}
+			// 所有路徑都沒有心跳 才算 stream 斷掉 再跟 UDP 心跳一起判斷
+			streamAlive := a.updatePeerPaths(timeout) > 0
+			a.updatePeerLiveness(streamAlive, timeout)
 		}
 	}
 }
 
-func (a *Arbiter) CheckInitRole() {
+// 本機網卡上的 IPv4 位址 (不含 loopback)
+func localIPv4s() (map[string]bool, error) {
 	addrs, err := net.InterfaceAddrs()
 	if err != nil {
-		log.Printf("❌ 無法取得網卡資訊: %v", err)
-		return
+		return nil, err
 	}
+	return ipv4Set(addrs), nil
+}
 
-	for _, addr := range addrs {
-
-		if ipnet, ok := addr.(*net.IPNet); ok {
-
-			if ipnet.IP.IsLoopback() {
-				continue
-			}
-
-			ip := ipnet.IP.To4()
-			if ip == nil {
-				continue
-			}
+// 啟動時依照本機有沒有 VIP 決定每個 instance 的角色 之後由 StartVipWatch 持續檢查
+func (a *Arbiter) CheckInitRole() {
+	local, err := a.addrs.Addrs()
+	if err != nil {
+		config.LogErrorf("❌ 無法取得網卡資訊: %v", err)
+		return
+	}
+	for ip := range local {
+		fmt.Printf("🔍 偵測到本機 IP: %s\n", ip)
+	}
 
-			fmt.Printf("🔍 偵測到本機 IP: %s\n", ip.String())
+	a.mu.RLock()
+	instances := a.instances
+	a.mu.RUnlock()
 
-			if ip.String() == config.Cfg.VIP {
-				log.Printf("👑 [啟動檢查] 發現 VIP (%s)，身分確認為: MASTER", config.Cfg.VIP)
-				a.UpdateMaster(true)
-				return
-			}
+	for _, inst := range instances {
+		if local[inst.vip] {
+			log.Printf("👑 [啟動檢查] 發現 %s 的 VIP (%s)，身分確認為: MASTER", inst.name, inst.vip)
+		} else {
+			log.Printf("🥈 [啟動檢查] 未發現 %s 的 VIP (%s)，身分確認為: BACKUP", inst.name, inst.vip)
 		}
+		a.UpdateRole(inst.name, local[inst.vip], DecisionCause{
+			Source: CauseStartup,
+			Detail: fmt.Sprintf("VIP (%s) %s", inst.vip, heldText(local[inst.vip])),
+		})
 	}
-
-	log.Printf("🥈 [啟動檢查] 未發現 VIP (%s)，身分確認為: BACKUP", config.Cfg.VIP)
-	a.UpdateMaster(false)
 }
@@ -0,0 +1,87 @@
+package internal
+
+import (
+	"encoding/json"
+	"kenmec/ha/jimmy/config"
+	gen "kenmec/ha/jimmy/protoGen"
+	"log"
+	"time"
+)
+
+// 多久送一次本機設定到另外一台HA
+const configSyncInterval = 5 * time.Second
+
+// 兩台HA設定比對的結果
+type ConfigConsistency struct {
+	PeerSeen   bool              `json:"peer_seen"`
+	CheckedAt  time.Time         `json:"checked_at"`
+	Mismatches []config.Mismatch `json:"mismatches"`
+}
+
+func (c ConfigConsistency) Consistent() bool {
+	return len(c.Mismatches) == 0
+}
+
+// 定時把本機設定 (已遮蔽) 送到另外一台HA 讓對方比對
+// 每次都用目前的設定 重新載入後的 reload:"live" 欄位下一次就會送出
+func (a *Arbiter) StartConfigSync() {
+	ticker := time.NewTicker(configSyncInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-a.ctx.Done():
+			return
+		case <-ticker.C:
+			a.sendConfigToPeer()
+		}
+	}
+}
+
+func (a *Arbiter) sendConfigToPeer() {
+	payload, err := json.Marshal(config.Current().Masked())
+	if err != nil {
+		config.LogErrorf("❌ 無法序列化本機設定: %v", err)
+		return
+	}
+	a.sendToPeer(&gen.StatusRequest{
+		Payload: &gen.StatusRequest_PeerConfig{
+			PeerConfig: string(payload),
+		},
+	})
+}
+
+// 收到另外一台的設定 跟本機比對
+func (a *Arbiter) handlePeerConfig(raw string) {
+	var peer map[string]string
+	if err := json.Unmarshal([]byte(raw), &peer); err != nil {
+		config.LogErrorf("❌ 另外一台HA的設定格式錯誤: %v", err)
+		return
+	}
+
+	mismatches := config.Current().ComparePeer(peer)
+
+	a.mu.Lock()
+	wasConsistent := a.configCheck.Consistent()
+	firstSeen := !a.configCheck.PeerSeen
+	a.configCheck = ConfigConsistency{
+		PeerSeen:   true,
+		CheckedAt:  time.Now(),
+		Mismatches: mismatches,
+	}
+	a.mu.Unlock()
+
+	if len(mismatches) > 0 && (wasConsistent || firstSeen) {
+		for _, m := range mismatches {
+			config.LogWarnf("⚠️  [設定比對] %s=%q 與另外一台 %s=%q 不一致", m.Key, m.Self, m.PeerKey, m.Peer)
+		}
+	} else if len(mismatches) == 0 && !wasConsistent {
+		log.Printf("✅ [設定比對] 兩台HA設定已一致")
+	}
+}
+
+func (a *Arbiter) ConfigConsistency() ConfigConsistency {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.configCheck
+}
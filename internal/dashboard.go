@@ -0,0 +1,71 @@
+package internal
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"io"
+	"io/fs"
+	"kenmec/ha/jimmy/config"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// dashboard 的靜態檔案 編進執行檔 不用另外部署
+//
+//go:embed web
+var dashboardFiles embed.FS
+
+// 向另外一台查狀態的超時
+const peerStatusTimeout = 2 * time.Second
+
+// 掛上 /ui 頁面本身不需要權限 資料都是透過需要 token 的 API 取得
+func registerDashboard(r *gin.Engine) {
+	files, err := fs.Sub(dashboardFiles, "web")
+	if err != nil {
+		panic(err)
+	}
+	r.StaticFS("/ui", http.FS(files))
+	r.GET("/", func(ctx *gin.Context) {
+		ctx.Redirect(http.StatusFound, "/ui/")
+	})
+}
+
+// PeerStatus 向另外一台的 REST API 查 /status 依序嘗試每條網路路徑
+// 用 API_AUTH.PEER_TOKEN 不會轉送呼叫者的 token
+func (a *Arbiter) PeerStatus(ctx context.Context) (int, []byte, error) {
+	cfg := config.Current()
+	client := http.Client{Timeout: peerStatusTimeout}
+
+	var lastErr error
+	for _, ip := range cfg.PeerIPs() {
+		url := "http://" + net.JoinHostPort(ip, cfg.PEER_WEB_API_PORT) + "/status"
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return 0, nil, err
+		}
+		if token := cfg.API_AUTH.PEER_TOKEN; token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+
+		resp, err := client.Do(req)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+		resp.Body.Close()
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		return resp.StatusCode, body, nil
+	}
+	if lastErr == nil {
+		lastErr = fmt.Errorf("沒有設定另外一台的 IP")
+	}
+	return 0, nil, lastErr
+}
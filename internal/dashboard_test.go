@@ -0,0 +1,41 @@
+package internal
+
+import (
+	"context"
+	"kenmec/ha/jimmy/config"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPeerStatusUsesPeerToken(t *testing.T) {
+	var got string
+	peer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Get("Authorization")
+		w.Write([]byte(`{"role":"BACKUP"}`))
+	}))
+	defer peer.Close()
+	host, port, _ := net.SplitHostPort(peer.Listener.Addr().String())
+
+	prev := config.Current()
+	defer config.Set(prev)
+
+	for _, tt := range []struct {
+		token string
+		want  string
+	}{{"peer-secret", "Bearer peer-secret"}, {"", ""}} {
+		config.Set(&config.Config{
+			CLIENT_IP:         host,
+			PEER_WEB_API_PORT: port,
+			API_AUTH:          config.APIAuthConfig{PEER_TOKEN: tt.token},
+		})
+		code, body, err := (&Arbiter{}).PeerStatus(context.Background())
+		if err != nil || code != http.StatusOK || string(body) != `{"role":"BACKUP"}` {
+			t.Fatalf("PeerStatus = %d %s %v", code, body, err)
+		}
+		if got != tt.want {
+			t.Errorf("PEER_TOKEN %q: Authorization = %q, want %q", tt.token, got, tt.want)
+		}
+	}
+}
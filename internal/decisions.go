@@ -0,0 +1,221 @@
+package internal
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// 保留最近幾筆決策
+const decisionLogSize = 500
+
+// 決策的種類
+const (
+	DecisionRole        = "role"        // instance 的角色變更 (或啟動時決定的角色)
+	DecisionMaintenance = "maintenance" // 維修模式開關 failover 會失敗 keepalived 會把 VIP 切走
+	DecisionSwitchover  = "switchover"  // 手動切換到另外一台
+	DecisionPeer        = "peer"        // 另外一台 alive / stream_stuck / gone
+	DecisionHealth      = "health"      // failover 健康檢查 (keepalived 的 track_script) 的結果
+)
+
+// 觸發決策的來源
+const (
+	CauseStartup    = "startup"     // 啟動時依照網卡上的 VIP
+	CauseKeepalived = "keepalived"  // keepalived 的通知 (notify_fifo 或 notify 腳本)
+	CauseRoleChange = "role_change" // 舊版 notify 腳本呼叫 /role_change
+	CauseReconcile  = "reconcile"   // 網卡上的 VIP 跟角色不一致 校正
+	CauseAPI        = "api"         // 操作人員
+	CauseHeartbeat  = "heartbeat"   // 另外一台的心跳
+	CauseHealth     = "health"      // 健康檢查項目變動
+)
+
+// DecisionCause 是觸發決策的原因 keepalived 的通知會附上整筆通知
+type DecisionCause struct {
+	Source       string                  `json:"source"`
+	Detail       string                  `json:"detail,omitempty"`
+	Notification *KeepalivedNotification `json:"notification,omitempty"`
+}
+
+func (c DecisionCause) String() string {
+	if c.Detail == "" {
+		return c.Source
+	}
+	return c.Source + ": " + c.Detail
+}
+
+// DecisionInputs 是做決策當下看到的狀態 (變更之前)
+type DecisionInputs struct {
+	Role         string             `json:"role"` // 交管跟著的 instance 的角色
+	Maintenance  bool               `json:"maintenance"`
+	Self         Connectivity       `json:"self"`
+	Other        Connectivity       `json:"other"`
+	PeerLiveness PeerLiveness       `json:"peer_liveness"`
+	Heartbeats   HeartbeatAges      `json:"heartbeats"`
+	Failover     *DecisionFailover  `json:"failover,omitempty"` // 最近一次 failover 健康檢查的結果 還沒檢查過時沒有
+	Instances    []DecisionInstance `json:"instances"`
+}
+
+// 決策當下一個 instance 的狀態
+type DecisionInstance struct {
+	Name       string `json:"name"`
+	Role       string `json:"role"`
+	PeerMaster bool   `json:"peer_master"`
+	HoldsVIP   bool   `json:"holds_vip"`
+	State      string `json:"state,omitempty"` // keepalived 最後通知的狀態
+}
+
+type DecisionFailover struct {
+	OK     bool      `json:"ok"`
+	Failed []string  `json:"failed"`
+	Since  time.Time `json:"since"`
+}
+
+// Decision 是一筆會影響角色的決策 from / to 是變更前後的值 (角色、維修模式、另外一台的狀態、健康檢查結果)
+type Decision struct {
+	Seq      uint64         `json:"seq"`
+	At       time.Time      `json:"at"`
+	Kind     string         `json:"kind"`
+	Instance string         `json:"instance,omitempty"` // 只有 role 有 其他種類影響所有 instance
+	From     string         `json:"from"`
+	To       string         `json:"to"`
+	Summary  string         `json:"summary"`
+	Cause    DecisionCause  `json:"cause"`
+	Inputs   DecisionInputs `json:"inputs"`
+}
+
+// 決策紀錄 有自己的鎖 超過 decisionLogSize 筆時丟掉最舊的
+type decisionLog struct {
+	mu        sync.Mutex
+	seq       uint64
+	decisions []Decision
+}
+
+func (l *decisionLog) add(d Decision) Decision {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.seq++
+	d.Seq = l.seq
+	if len(l.decisions) >= decisionLogSize {
+		l.decisions = l.decisions[1:]
+	}
+	l.decisions = append(l.decisions, d)
+	return d
+}
+
+func (l *decisionLog) list() []Decision {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]Decision{}, l.decisions...)
+}
+
+// 目前的狀態 呼叫前要先拿到 a.mu
+func (a *Arbiter) decisionInputsLocked(now time.Time) DecisionInputs {
+	inputs := DecisionInputs{
+		Role:         roleName(a.IsMaster),
+		Maintenance:  a.Maintenance,
+		Self:         a.Self,
+		Other:        a.Other,
+		PeerLiveness: a.peerLiveness,
+		Heartbeats:   a.heartbeatAgesLocked(now),
+		Failover:     a.health.lastFailover(),
+		Instances:    []DecisionInstance{},
+	}
+	for _, inst := range a.instances {
+		inputs.Instances = append(inputs.Instances, DecisionInstance{
+			Name:       inst.name,
+			Role:       roleName(inst.master),
+			PeerMaster: inst.peerMaster,
+			HoldsVIP:   inst.heldVip,
+			State:      inst.state,
+		})
+	}
+	return inputs
+}
+
+// 記錄一筆決策 附上目前的狀態 呼叫前要先拿到 a.mu
+func (a *Arbiter) decideLocked(d Decision) {
+	d.At = time.Now()
+	d.Inputs = a.decisionInputsLocked(d.At)
+	a.decisions.add(d)
+}
+
+func (a *Arbiter) decide(d Decision) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	a.decideLocked(d)
+}
+
+// Decisions 回傳所有保留的決策 舊的在前面
+func (a *Arbiter) Decisions() []Decision {
+	return a.decisions.list()
+}
+
+// Explanation 是 GET /explain 的結果 說明一個 instance 為什麼是目前的角色
+type Explanation struct {
+	Instance string    `json:"instance"`
+	Service  string    `json:"service"`
+	Role     string    `json:"role"`
+	Since    time.Time `json:"since"`
+	Summary  string    `json:"summary"`
+	// 決定目前角色的那一筆 已經不在紀錄裡時沒有
+	Decision *Decision `json:"decision,omitempty"`
+	// 上一次角色變更之後到現在的決策 (包含決定目前角色的那一筆) all 時是全部
+	Chain []Decision `json:"chain"`
+}
+
+// Explain 說明 instance 為什麼是目前的角色 name 空白代表交管跟著的 instance
+func (a *Arbiter) Explain(name string, all bool) (Explanation, error) {
+	a.mu.RLock()
+	inst := a.instanceLocked(name)
+	if inst == nil {
+		a.mu.RUnlock()
+		return Explanation{}, fmt.Errorf("找不到 instance %q", name)
+	}
+	e := Explanation{
+		Instance: inst.name,
+		Service:  inst.service,
+		Role:     roleName(inst.master),
+		Since:    inst.since,
+		Chain:    []Decision{},
+	}
+	a.mu.RUnlock()
+
+	var relevant []Decision
+	for _, d := range a.decisions.list() {
+		if d.Instance == "" || d.Instance == e.Instance {
+			relevant = append(relevant, d)
+		}
+	}
+
+	// 最後一筆以及前一筆這個 instance 的角色決策 chain 從前一筆之後開始
+	last, prev := -1, -1
+	for i := len(relevant) - 1; i >= 0 && prev < 0; i-- {
+		if relevant[i].Kind != DecisionRole || relevant[i].Instance != e.Instance {
+			continue
+		}
+		if last < 0 {
+			last = i
+		} else {
+			prev = i
+		}
+	}
+	start := prev + 1
+	if all {
+		start = 0
+	}
+	e.Chain = append(e.Chain, relevant[start:]...)
+
+	if last < 0 {
+		e.Summary = fmt.Sprintf("%s 從 %s 開始是 %s 決定這個角色的紀錄已經不在了", e.Instance, e.Since.Format(time.DateTime), e.Role)
+		return e, nil
+	}
+	d := relevant[last]
+	e.Decision = &d
+	e.Summary = fmt.Sprintf("%s 從 %s 開始是 %s 原因 %s", e.Instance, e.Since.Format(time.DateTime), e.Role, d.Cause)
+	if d.To != e.Role {
+		// 不應該發生 角色變更一定會記錄
+		e.Summary += fmt.Sprintf(" (紀錄的角色是 %s)", d.To)
+	}
+	return e, nil
+}
@@ -0,0 +1,137 @@
+package internal
+
+import (
+	"kenmec/ha/jimmy/config"
+	"strings"
+	"testing"
+)
+
+// 兩個 instance TC_VI (交管跟著的) 以及 DB_VI
+func newDecisionArbiter(t *testing.T) *Arbiter {
+	t.Helper()
+	prev := config.Current()
+	t.Cleanup(func() { config.Set(prev) })
+	config.Set(&config.Config{KEEPALIVED: config.KeepalivedConfig{INSTANCES: []config.KeepalivedInstance{
+		{NAME: "TC_VI", SERVICE: "tc", VIP: "192.168.0.200/24"},
+		{NAME: "DB_VI", SERVICE: "db", VIP: "192.168.0.202/24"},
+	}}})
+
+	a := NewArbiter(nil, nil, nil, nil)
+	t.Cleanup(a.cancel)
+	return a
+}
+
+func updateRole(t *testing.T, a *Arbiter, name string, master bool) {
+	t.Helper()
+	if err := a.UpdateRole(name, master, DecisionCause{Source: CauseKeepalived}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func healthDecision(a *Arbiter, to string) {
+	a.decide(Decision{Kind: DecisionHealth, From: healthStatus(to != "ok"), To: to, Cause: DecisionCause{Source: CauseHealth}})
+}
+
+func chainSeqs(chain []Decision) []uint64 {
+	var seqs []uint64
+	for _, d := range chain {
+		seqs = append(seqs, d.Seq)
+	}
+	return seqs
+}
+
+func TestExplainChain(t *testing.T) {
+	a := newDecisionArbiter(t)
+
+	updateRole(t, a, "TC_VI", true)  // 1 TC_VI → MASTER
+	healthDecision(a, "not ok")      // 2
+	updateRole(t, a, "DB_VI", true)  // 3 別的 instance 不算
+	updateRole(t, a, "TC_VI", false) // 4 TC_VI → BACKUP 前一筆角色決策
+	healthDecision(a, "ok")          // 5
+	updateRole(t, a, "DB_VI", false) // 6
+	updateRole(t, a, "TC_VI", true)  // 7 決定目前角色的那一筆
+	healthDecision(a, "not ok")      // 8 之後的決策也要列出
+
+	e, err := a.Explain("TC_VI", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Role != "MASTER" || e.Decision == nil || e.Decision.Seq != 7 {
+		t.Fatalf("role = %s decision = %+v, want MASTER decided by #7", e.Role, e.Decision)
+	}
+	// 從前一筆 TC_VI 的角色決策 (#4) 之後開始 不包含 DB_VI 的
+	if got := chainSeqs(e.Chain); len(got) != 3 || got[0] != 5 || got[1] != 7 || got[2] != 8 {
+		t.Errorf("chain = %v, want [5 7 8]", got)
+	}
+
+	// DB_VI 從 #3 之後開始 不包含 TC_VI 的
+	e, _ = a.Explain("DB_VI", false)
+	if got := chainSeqs(e.Chain); len(got) != 3 || got[0] != 5 || got[1] != 6 || got[2] != 8 || e.Decision.Seq != 6 {
+		t.Errorf("DB_VI chain = %v decision = %d, want [5 6 8] decided by #6", got, e.Decision.Seq)
+	}
+
+	// 空白代表交管跟著的 instance
+	if e, _ := a.Explain("", false); e.Instance != "TC_VI" {
+		t.Errorf("default instance = %s, want TC_VI", e.Instance)
+	}
+	if _, err := a.Explain("XX_VI", false); err == nil {
+		t.Error("unknown instance explained")
+	}
+}
+
+func TestExplainAll(t *testing.T) {
+	a := newDecisionArbiter(t)
+
+	updateRole(t, a, "TC_VI", true)
+	updateRole(t, a, "DB_VI", true)
+	updateRole(t, a, "TC_VI", false)
+	healthDecision(a, "not ok")
+	updateRole(t, a, "TC_VI", true)
+
+	// 只有一筆角色決策時 chain 從頭開始
+	if e, _ := a.Explain("DB_VI", false); len(e.Chain) != 2 || e.Chain[0].Seq != 2 {
+		t.Errorf("DB_VI chain = %v, want [2 4]", chainSeqs(e.Chain))
+	}
+
+	e, err := a.Explain("TC_VI", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 全部 TC_VI 以及不屬於 instance 的決策 不包含 DB_VI 的
+	if got := chainSeqs(e.Chain); len(got) != 4 || got[0] != 1 || got[1] != 3 || got[3] != 5 {
+		t.Errorf("chain = %v, want [1 3 4 5]", got)
+	}
+	if e.Decision == nil || e.Decision.Seq != 5 {
+		t.Errorf("decision = %+v, want #5", e.Decision)
+	}
+}
+
+func TestExplainEvictedDecision(t *testing.T) {
+	a := newDecisionArbiter(t)
+
+	updateRole(t, a, "TC_VI", true)
+	for range decisionLogSize {
+		healthDecision(a, "ok")
+	}
+	if n := len(a.Decisions()); n != decisionLogSize {
+		t.Fatalf("kept %d decisions, want %d", n, decisionLogSize)
+	}
+	if first := a.Decisions()[0]; first.Seq != 2 {
+		t.Errorf("oldest decision = #%d, want #2", first.Seq)
+	}
+
+	// 決定目前角色的那一筆已經被丟掉了
+	e, err := a.Explain("TC_VI", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Decision != nil {
+		t.Errorf("decision = %+v, want nil after eviction", e.Decision)
+	}
+	if e.Role != "MASTER" || !strings.Contains(e.Summary, "不在") {
+		t.Errorf("role = %s summary = %q", e.Role, e.Summary)
+	}
+	if len(e.Chain) != decisionLogSize {
+		t.Errorf("chain has %d decisions, want all %d kept", len(e.Chain), decisionLogSize)
+	}
+}
@@ -0,0 +1,192 @@
+package internal
+
+import (
+	"context"
+	"kenmec/ha/jimmy/api"
+	"kenmec/ha/jimmy/config"
+	"log"
+	"time"
+)
+
+// 一個依賴的服務 (RabbitMQ、MySQL 等) 的檢查狀態 欄位由 Arbiter.mu 保護
+type dependency struct {
+	cfg config.DependencyConfig
+
+	checked   bool // 至少檢查過一次
+	up        bool
+	okCount   int // 連續成功次數
+	failCount int // 連續失敗次數
+	lastErr   string
+	lastCheck time.Time
+	latency   time.Duration
+	since     time.Time // 狀態從什麼時候開始
+}
+
+func newDependencies(cfgs []config.DependencyConfig) []*dependency {
+	deps := make([]*dependency, 0, len(cfgs))
+	for _, c := range cfgs {
+		deps = append(deps, &dependency{cfg: c, since: time.Now()})
+	}
+	return deps
+}
+
+// 目標位址 顯示用
+func (d *dependency) target() string {
+	switch d.cfg.TYPE {
+	case "http":
+		return d.cfg.URL
+	case "exec":
+		return d.cfg.COMMAND[0]
+	}
+	return d.cfg.ADDRESS
+}
+
+// StartDependencyProbes 每個依賴的服務一個 goroutine 依照自己的 INTERVAL 檢查
+func (a *Arbiter) StartDependencyProbes() {
+	for _, d := range a.deps {
+		go a.runDependencyProbe(d)
+	}
+}
+
+func (a *Arbiter) runDependencyProbe(d *dependency) {
+	ticker := time.NewTicker(d.cfg.INTERVAL.Duration())
+	defer ticker.Stop()
+
+	for {
+		a.checkDependency(d)
+
+		select {
+		case <-a.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// 檢查一次 連續成功 RISE 次才算恢復 連續失敗 FALL 次才算異常
+// 第一次檢查的結果直接當成目前狀態
+func (a *Arbiter) checkDependency(d *dependency) {
+	ctx, cancel := context.WithTimeout(a.ctx, d.cfg.TIMEOUT.Duration())
+	start := time.Now()
+	err := api.CheckDependency(ctx, d.cfg)
+	cancel()
+
+	a.mu.Lock()
+	d.lastCheck = time.Now()
+	d.latency = time.Since(start)
+	first := !d.checked
+	d.checked = true
+
+	wasUp := d.up
+	if err == nil {
+		d.okCount++
+		d.failCount = 0
+		d.lastErr = ""
+		if first || d.okCount >= d.cfg.RISE {
+			d.up = true
+		}
+	} else {
+		d.failCount++
+		d.okCount = 0
+		d.lastErr = err.Error()
+		if first || d.failCount >= d.cfg.FALL {
+			d.up = false
+		}
+	}
+
+	changed := d.up != wasUp
+	if changed {
+		d.since = d.lastCheck
+	}
+	a.updateDepsConnectivityLocked()
+	up, lastErr := d.up, d.lastErr
+	a.mu.Unlock()
+
+	switch {
+	case up && (changed || first):
+		log.Printf("✅ [依賴] %s (%s %s) 正常", d.cfg.NAME, d.cfg.TYPE, d.target())
+	case !up && (changed || first):
+		config.LogErrorf("❌ [依賴] %s (%s %s) 異常: %s", d.cfg.NAME, d.cfg.TYPE, d.target(), lastErr)
+	}
+	if changed {
+		message := d.cfg.NAME + " 恢復正常"
+		if !up {
+			message = d.cfg.NAME + " 異常"
+		}
+		a.events.Record(EventDependency, message, map[string]any{
+			"name":  d.cfg.NAME,
+			"up":    up,
+			"error": lastErr,
+		})
+	}
+}
+
+// REQUIRED 的依賴都正常才算 Self.Deps 呼叫前要先拿到 a.mu
+func (a *Arbiter) updateDepsConnectivityLocked() {
+	before := a.Self
+	ok := true
+	for _, d := range a.deps {
+		if d.cfg.REQUIRED && !d.up {
+			ok = false
+		}
+	}
+	a.Self.Deps = ok
+	a.recordConnectivityLocked("self", before, a.Self)
+}
+
+// 對外顯示用的依賴狀態
+type DependencyStatus struct {
+	Name      string    `json:"name"`
+	Type      string    `json:"type"`
+	Target    string    `json:"target"`
+	Required  bool      `json:"required"`
+	Up        bool      `json:"up"`
+	Checked   bool      `json:"checked"`
+	Since     time.Time `json:"since"`
+	LastCheck time.Time `json:"last_check"`
+	LatencyMs float64   `json:"latency_ms"`
+	LastError string    `json:"last_error,omitempty"`
+	OKCount   int       `json:"ok_count"`
+	FailCount int       `json:"fail_count"`
+}
+
+func (d *dependency) status() DependencyStatus {
+	return DependencyStatus{
+		Name:      d.cfg.NAME,
+		Type:      d.cfg.TYPE,
+		Target:    d.target(),
+		Required:  d.cfg.REQUIRED,
+		Up:        d.up,
+		Checked:   d.checked,
+		Since:     d.since,
+		LastCheck: d.lastCheck,
+		LatencyMs: float64(d.latency.Microseconds()) / 1000,
+		LastError: d.lastErr,
+		OKCount:   d.okCount,
+		FailCount: d.failCount,
+	}
+}
+
+func (a *Arbiter) Dependencies() []DependencyStatus {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	out := []DependencyStatus{}
+	for _, d := range a.deps {
+		out = append(out, d.status())
+	}
+	return out
+}
+
+// Dependency 回傳一個依賴的狀態 找不到時 ok 為 false
+func (a *Arbiter) Dependency(name string) (DependencyStatus, bool) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	for _, d := range a.deps {
+		if d.cfg.NAME == name {
+			return d.status(), true
+		}
+	}
+	return DependencyStatus{}, false
+}
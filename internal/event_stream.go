@@ -0,0 +1,73 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 沒有事件時多久送一次註解 避免 proxy 把閒置的連線關掉
+const eventStreamKeepalive = 15 * time.Second
+
+// 用 Server-Sent Events 送出事件 每筆事件的 id 是序號
+// type=role,peer 只送這些種類 last=N 先補最後 N 筆
+// 重新連線時帶 Last-Event-ID (或 since=<seq>) 會補上之後的事件
+func streamEvents(ctx *gin.Context, events *EventLog) {
+	filter := ParseEventFilter(ctx.Query("type"))
+	last, _ := strconv.Atoi(ctx.Query("last"))
+	// 最多只保留 eventLogSize 筆
+	last = min(max(last, 0), eventLogSize)
+	since, _ := strconv.ParseUint(ctx.Query("since"), 10, 64)
+	if id := ctx.GetHeader("Last-Event-ID"); id != "" {
+		since, _ = strconv.ParseUint(id, 10, 64)
+	}
+
+	sub := events.Subscribe(filter, since, last)
+	defer sub.Close()
+
+	header := ctx.Writer.Header()
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	header.Set("Connection", "keep-alive")
+	header.Set("X-Accel-Buffering", "no") // nginx 不要暫存
+	ctx.Status(http.StatusOK)
+
+	w := ctx.Writer
+	fmt.Fprint(w, "retry: 3000\n\n")
+	for _, e := range sub.Replay {
+		writeSSE(w, e)
+	}
+	w.Flush()
+
+	keepalive := time.NewTicker(eventStreamKeepalive)
+	defer keepalive.Stop()
+
+	for {
+		select {
+		case <-ctx.Request.Context().Done():
+			return
+		case e, ok := <-sub.Events:
+			if !ok {
+				// 跟不上被取消訂閱 結束連線讓對方帶 Last-Event-ID 重連補回
+				return
+			}
+			writeSSE(w, e)
+			w.Flush()
+		case <-keepalive.C:
+			fmt.Fprint(w, ": keepalive\n\n")
+			w.Flush()
+		}
+	}
+}
+
+func writeSSE(w gin.ResponseWriter, e Event) {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	fmt.Fprintf(w, "id: %d\ndata: %s\n\n", e.Seq, data)
+}
@@ -0,0 +1,90 @@
+package internal
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func recordEvents(l *EventLog, n int) {
+	for i := 0; i < n; i++ {
+		typ := EventRoleChange
+		if i%2 == 1 {
+			typ = EventMaintenance
+		}
+		l.Record(typ, "test", nil)
+	}
+}
+
+func TestSubscribeReplay(t *testing.T) {
+	l := NewEventLog()
+	recordEvents(l, 6)
+
+	tests := []struct {
+		name   string
+		filter EventFilter
+		since  uint64
+		last   int
+		want   []uint64
+	}{
+		{"last", nil, 0, 2, []uint64{5, 6}},
+		{"last larger than the log", nil, 0, 100, []uint64{1, 2, 3, 4, 5, 6}},
+		{"negative last", nil, 0, -1, nil},
+		{"last after filter", ParseEventFilter(EventRoleChange), 0, 2, []uint64{3, 5}},
+		// since 優先 last 不限制補送的數量
+		{"since", nil, 4, 1, []uint64{5, 6}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sub := l.Subscribe(tt.filter, tt.since, tt.last)
+			defer sub.Close()
+
+			var got []uint64
+			for _, e := range sub.Replay {
+				got = append(got, e.Seq)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("replay = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("replay = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestStreamEventsLastParameter(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	l := NewEventLog()
+	recordEvents(l, 3)
+
+	for _, tt := range []struct {
+		last string
+		want int
+	}{{"-1", 0}, {"2", 2}, {"99999999", 3}, {"abc", 0}} {
+		t.Run(tt.last, func(t *testing.T) {
+			r := gin.New()
+			r.GET("/events/stream", func(ctx *gin.Context) { streamEvents(ctx, l) })
+
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+			req := httptest.NewRequest(http.MethodGet, "/events/stream?last="+tt.last, nil).WithContext(ctx)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d", w.Code)
+			}
+			if got := strings.Count(w.Body.String(), "id: "); got != tt.want {
+				t.Errorf("replayed %d events, want %d\n%s", got, tt.want, w.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,221 @@
+package internal
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 保留最近幾筆事件
+const eventLogSize = 1000
+
+// 每個訂閱者最多暫存幾筆還沒送出的事件 超過時關掉訂閱 讓對方重新連線補回
+const eventSubscriberBuffer = 64
+
+// 事件種類
+const (
+	EventConfigReload     = "config.reload"
+	EventRoleChange       = "role.change"
+	EventDependency       = "dependency.change"
+	EventConnectivity     = "connectivity.change" // Self / Other 的 ECS、Fleet、Ha、Deps 變更
+	EventHeartbeat        = "heartbeat.timeout"   // 交管或另外一台的某條路徑心跳超時
+	EventPeerLiveness     = "peer.liveness"       // 另外一台 alive / stream_stuck / gone
+	EventPeerConnect      = "peer.connect"        // 另外一台連進來
+	EventPeerLeave        = "peer.disconnect"
+	EventMaintenance      = "maintenance.change"
+	EventHealth           = "health.change"     // /health/live、ready、failover 的結果變動
+	EventSwitchover       = "role.switchover"   // 手動把 VIP 切到另外一台
+	EventRoleReconcile    = "role.reconcile"    // 依照網卡上的 VIP 校正角色 (漏掉了通知)
+	EventKeepalivedNotify = "keepalived.notify" // keepalived 的每一筆通知
+)
+
+// Event 是仲裁程式發生的重要事情 例如角色切換、重新載入設定
+type Event struct {
+	Seq     uint64    `json:"seq"`
+	At      time.Time `json:"at"`
+	Type    string    `json:"type"`
+	Message string    `json:"message"`
+	Data    any       `json:"data,omitempty"`
+}
+
+// EventLog 把事件保存在記憶體 超過 eventLogSize 筆時丟掉最舊的
+// 同時也是事件匯流排 Record 時會送給每個訂閱者
+type EventLog struct {
+	mu          sync.RWMutex
+	seq         uint64
+	events      []Event
+	subscribers map[*EventSubscription]struct{}
+}
+
+func NewEventLog() *EventLog {
+	return &EventLog{}
+}
+
+func (l *EventLog) Record(typ, message string, data any) Event {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.seq++
+	e := Event{
+		Seq:     l.seq,
+		At:      time.Now(),
+		Type:    typ,
+		Message: message,
+		Data:    data,
+	}
+
+	if len(l.events) >= eventLogSize {
+		l.events = l.events[1:]
+	}
+	l.events = append(l.events, e)
+
+	for sub := range l.subscribers {
+		if !sub.match(e) {
+			continue
+		}
+		select {
+		case sub.ch <- e:
+		default:
+			// 訂閱者太慢 不能卡住 Record
+			l.unsubscribeLocked(sub)
+		}
+	}
+	return e
+}
+
+// Since 回傳序號大於 seq 的事件 seq 為 0 代表全部
+func (l *EventLog) Since(seq uint64) []Event {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	out := []Event{}
+	for _, e := range l.events {
+		if e.Seq > seq {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+// EventFilter 依照事件種類過濾 "role" 符合 role.change "role.change" 只符合自己 空白代表全部
+type EventFilter []string
+
+func ParseEventFilter(s string) EventFilter {
+	var f EventFilter
+	for _, t := range strings.Split(s, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			f = append(f, t)
+		}
+	}
+	return f
+}
+
+func (f EventFilter) match(e Event) bool {
+	if len(f) == 0 {
+		return true
+	}
+	for _, t := range f {
+		if e.Type == t || strings.HasPrefix(e.Type, t+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// Filter 回傳符合的事件
+func (f EventFilter) Filter(events []Event) []Event {
+	out := []Event{}
+	for _, e := range events {
+		if f.match(e) {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+// EventSubscription 收到 Subscribe 之後符合條件的事件
+// 訂閱者跟不上時 Events 會被關掉
+type EventSubscription struct {
+	Replay []Event // 訂閱前已經發生 要先補送的事件
+	Events <-chan Event
+
+	ch     chan Event
+	filter EventFilter
+	log    *EventLog
+}
+
+func (s *EventSubscription) match(e Event) bool {
+	return s.filter.match(e)
+}
+
+// Close 取消訂閱
+func (s *EventSubscription) Close() {
+	s.log.mu.Lock()
+	defer s.log.mu.Unlock()
+	s.log.unsubscribeLocked(s)
+}
+
+// Subscribe 訂閱之後的事件 並補上 since 之後的事件 (since 為 0 時補最後 last 筆)
+// 補送的事件跟之後的事件之間不會漏掉也不會重複
+func (l *EventLog) Subscribe(filter EventFilter, since uint64, last int) *EventSubscription {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	ch := make(chan Event, eventSubscriberBuffer)
+	sub := &EventSubscription{Events: ch, ch: ch, filter: filter, log: l}
+
+	var replay []Event
+	for _, e := range l.events {
+		if e.Seq > since && filter.match(e) {
+			replay = append(replay, e)
+		}
+	}
+	if since == 0 {
+		replay = replay[len(replay)-min(max(last, 0), len(replay)):]
+	}
+	sub.Replay = replay
+
+	if l.subscribers == nil {
+		l.subscribers = map[*EventSubscription]struct{}{}
+	}
+	l.subscribers[sub] = struct{}{}
+	return sub
+}
+
+func (l *EventLog) unsubscribeLocked(sub *EventSubscription) {
+	if _, ok := l.subscribers[sub]; ok {
+		delete(l.subscribers, sub)
+		close(sub.ch)
+	}
+}
+
+// 比對連線狀態 有變更的欄位各記錄一筆事件 呼叫前要先拿到 a.mu
+func (a *Arbiter) recordConnectivityLocked(side string, before, after Connectivity) {
+	name := "本機"
+	if side == "other" {
+		name = "另外一台"
+	}
+	for _, f := range []struct {
+		field    string
+		was, now bool
+	}{
+		{"ecs", before.ECS, after.ECS},
+		{"fleet", before.Fleet, after.Fleet},
+		{"ha", before.Ha, after.Ha},
+		{"deps", before.Deps, after.Deps},
+	} {
+		if f.was == f.now {
+			continue
+		}
+		a.events.Record(EventConnectivity, fmt.Sprintf("%s %s 變更為 %v", name, f.field, f.now), map[string]any{
+			"side":  side,
+			"field": f.field,
+			"value": f.now,
+		})
+	}
+}
+
+func (a *Arbiter) Events() *EventLog {
+	return a.events
+}
@@ -0,0 +1,181 @@
+package internal
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"kenmec/ha/jimmy/config"
+	gen "kenmec/ha/jimmy/protoGen"
+	"log"
+	"time"
+)
+
+// 保留最近幾次來回時間
+const probeRTTHistory = 100
+
+// 一個交管 echo 探測的狀態
+// 心跳只能證明交管送心跳的 goroutine 還活著 echo 則要經過交管的訊息處理流程
+type fleetProbe struct {
+	enabled bool
+	timeout time.Duration
+
+	pending    map[string]time.Time // token -> 送出時間
+	sent       uint64
+	received   uint64
+	lastEchoAt time.Time
+	rtts       []time.Duration
+}
+
+// 對外顯示用的 echo 探測狀態
+type FleetProbeStatus struct {
+	Name        string  `json:"name"`
+	Enabled     bool    `json:"enabled"`
+	Processing  bool    `json:"processing"`
+	Sent        uint64  `json:"sent"`
+	Received    uint64  `json:"received"`
+	Outstanding int     `json:"outstanding"`
+	LastEchoAge int64   `json:"last_echo_ms"`
+	LastRTTMs   float64 `json:"last_rtt_ms"`
+	AvgRTTMs    float64 `json:"avg_rtt_ms"`
+	MaxRTTMs    float64 `json:"max_rtt_ms"`
+}
+
+func newFleetProbe() *fleetProbe {
+	return &fleetProbe{
+		enabled:    config.Current().FLEET_PROBE_INTERVAL > 0,
+		timeout:    config.Current().FLEET_PROBE_TIMEOUT.Duration(),
+		pending:    map[string]time.Time{},
+		lastEchoAt: time.Now(),
+	}
+}
+
+func newProbeToken() string {
+	var b [8]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// 定時送出 probe 給每個交管 並檢查交管多久沒有回 echo
+// FLEET_PROBE_INTERVAL 可以在執行中打開或關掉
+func (a *Arbiter) StartFleetProbe() {
+	var interval time.Duration
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	retick(ticker, &interval, config.Current().FLEET_PROBE_INTERVAL.Duration())
+
+	for {
+		select {
+		case <-a.ctx.Done():
+			return
+		case <-ticker.C:
+			want := config.Current().FLEET_PROBE_INTERVAL.Duration()
+			if want > 0 {
+				for _, f := range a.fleets {
+					a.sendProbe(f)
+				}
+			}
+			retick(ticker, &interval, want)
+		}
+	}
+}
+
+func (a *Arbiter) sendProbe(f *fleetLink) {
+	now := time.Now()
+	token := newProbeToken()
+	p := f.probe
+
+	a.mu.Lock()
+	timeout := p.timeout
+	// 超過 timeout 還沒回的 probe 不會再等
+	for t, sentAt := range p.pending {
+		if now.Sub(sentAt) > timeout {
+			delete(p.pending, t)
+		}
+	}
+	p.pending[token] = now
+	p.sent++
+
+	processing := now.Sub(p.lastEchoAt) <= timeout
+	changed := processing != f.processing
+	f.processing = processing
+	a.mu.Unlock()
+
+	if changed {
+		if processing {
+			log.Printf("✅ [交管 echo] %s 恢復處理訊息", f.name)
+		} else {
+			config.LogWarnf("⚠️  [交管 echo] %s 超過 %v 沒有回 echo 判定沒有在處理訊息", f.name, timeout)
+		}
+	}
+
+	a.sendFleet(f, &gen.ClientMessage{
+		Payload: &gen.ClientMessage_Probe{
+			Probe: &gen.Probe{
+				Token:        token,
+				SentAtUnixMs: now.UnixMilli(),
+			},
+		},
+	})
+}
+
+// 交管送回的 echo
+func (a *Arbiter) handleProbeEcho(f *fleetLink, echo *gen.Probe) {
+	now := time.Now()
+	p := f.probe
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	sentAt, ok := p.pending[echo.GetToken()]
+	if !ok {
+		config.LogWarnf("⚠️  [交管 echo] %s 收到未知或已逾時的 token: %s", f.name, echo.GetToken())
+		return
+	}
+	delete(p.pending, echo.GetToken())
+
+	rtt := now.Sub(sentAt)
+	if len(p.rtts) >= probeRTTHistory {
+		p.rtts = p.rtts[1:]
+	}
+	p.rtts = append(p.rtts, rtt)
+	p.received++
+	p.lastEchoAt = now
+
+	if !f.processing {
+		log.Printf("✅ [交管 echo] %s 恢復處理訊息 (來回 %v)", f.name, rtt)
+	}
+	f.processing = true
+}
+
+func (a *Arbiter) FleetProbeStatus() []FleetProbeStatus {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	var statuses []FleetProbeStatus
+	for _, f := range a.fleets {
+		p := f.probe
+		status := FleetProbeStatus{
+			Name:        f.name,
+			Enabled:     p.enabled,
+			Processing:  f.processing,
+			Sent:        p.sent,
+			Received:    p.received,
+			Outstanding: len(p.pending),
+			LastEchoAge: time.Since(p.lastEchoAt).Milliseconds(),
+		}
+
+		if n := len(p.rtts); n > 0 {
+			var sum, max time.Duration
+			for _, rtt := range p.rtts {
+				sum += rtt
+				if rtt > max {
+					max = rtt
+				}
+			}
+			status.LastRTTMs = float64(p.rtts[n-1].Microseconds()) / 1000
+			status.AvgRTTMs = float64(sum.Microseconds()) / 1000 / float64(n)
+			status.MaxRTTMs = float64(max.Microseconds()) / 1000
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
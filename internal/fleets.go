@@ -0,0 +1,226 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"kenmec/ha/jimmy/api"
+	"kenmec/ha/jimmy/config"
+	gen "kenmec/ha/jimmy/protoGen"
+	"slices"
+	"time"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// 本機交管的連線 main 依照設定的 FLEETS 建立
+type FleetEndpoint struct {
+	Name   string
+	Routes []string
+	Client *api.GRPCFleetClient
+}
+
+// 一個交管的狀態 欄位由 Arbiter.mu 保護
+type fleetLink struct {
+	name   string
+	routes []string
+	client *api.GRPCFleetClient
+
+	lastHb   time.Time
+	detector *PhiAccrualDetector
+	probe    *fleetProbe
+
+	ecs bool // 交管回報的 ECS 連線狀態
+	up  bool // 心跳、health、echo 都正常
+
+	// grpc.health.v1 是否 SERVING 沒有開 FLEET_HEALTH_CHECK 時永遠是 true
+	serving bool
+	// 是否有回 echo probe 沒有開 FLEET_PROBE_INTERVAL 時永遠是 true
+	processing bool
+}
+
+func newFleetLinks(endpoints []FleetEndpoint, hbInterval time.Duration) []*fleetLink {
+	links := make([]*fleetLink, 0, len(endpoints))
+	for _, e := range endpoints {
+		links = append(links, &fleetLink{
+			name:       e.Name,
+			routes:     e.Routes,
+			client:     e.Client,
+			lastHb:     time.Now(),
+			detector:   newDetector(hbInterval),
+			probe:      newFleetProbe(),
+			serving:    !config.Current().FLEET_HEALTH_CHECK,
+			processing: true,
+		})
+	}
+	return links
+}
+
+// FleetHealthRule 決定幾個交管正常才算交管正常
+type FleetHealthRule struct {
+	name     string
+	required int
+}
+
+// 規則在 config.Load 時已經檢查過
+func newFleetHealthRule(fleets int) FleetHealthRule {
+	required, _ := config.FleetHealthRequired(config.Current().FLEET_HEALTH_RULE, fleets)
+	return FleetHealthRule{name: config.Current().FLEET_HEALTH_RULE, required: required}
+}
+
+func (r FleetHealthRule) String() string {
+	return fmt.Sprintf("%s (%d)", r.name, r.required)
+}
+
+// 依照每個交管的狀態更新 Self.Fleet 以及 Self.ECS 呼叫前要先拿到 a.mu
+func (a *Arbiter) updateFleetConnectivityLocked() {
+	before := a.Self
+	up, ecs := 0, 0
+	for _, f := range a.fleets {
+		if f.up {
+			up++
+		}
+		if f.ecs {
+			ecs++
+		}
+	}
+	a.Self.Fleet = up >= a.fleetRule.required
+	a.Self.ECS = ecs >= a.fleetRule.required
+	a.recordConnectivityLocked("self", before, a.Self)
+}
+
+// 從資料裡取出 FLEET_ROUTE_KEY 的值
+// proto message 直接找同名欄位 字串內容 (例如 sync_mission) 當成 JSON 物件找
+func routeValue(msg *gen.ClientMessage, key string) (string, bool) {
+	m := msg.ProtoReflect()
+	fd := m.WhichOneof(m.Descriptor().Oneofs().ByName("payload"))
+	if fd == nil {
+		return "", false
+	}
+	v := m.Get(fd)
+
+	switch fd.Kind() {
+	case protoreflect.MessageKind:
+		field := fd.Message().Fields().ByName(protoreflect.Name(key))
+		if field == nil || field.Kind() != protoreflect.StringKind {
+			return "", false
+		}
+		s := v.Message().Get(field).String()
+		return s, s != ""
+
+	case protoreflect.StringKind:
+		var obj map[string]any
+		if json.Unmarshal([]byte(v.String()), &obj) != nil {
+			return "", false
+		}
+		s, ok := obj[key].(string)
+		return s, ok && s != ""
+	}
+
+	return "", false
+}
+
+// 決定資料要送到哪些交管
+// 找不到 route 值就送給全部 找不到對應的交管就送給沒有設定 ROUTES 的交管
+func (a *Arbiter) fleetsFor(msg *gen.ClientMessage) []*fleetLink {
+	key := config.Current().FLEET_ROUTE_KEY
+	if key == "" || len(a.fleets) == 1 {
+		return a.fleets
+	}
+
+	value, ok := routeValue(msg, key)
+	if !ok {
+		return a.fleets
+	}
+
+	var matched, fallback []*fleetLink
+	for _, f := range a.fleets {
+		if len(f.routes) == 0 {
+			fallback = append(fallback, f)
+		} else if slices.Contains(f.routes, value) {
+			matched = append(matched, f)
+		}
+	}
+	if len(matched) > 0 {
+		return matched
+	}
+	return fallback
+}
+
+// 把另外一台同步過來的資料送到對應的交管
+func (a *Arbiter) sendToFleet(msg *gen.ClientMessage) {
+	targets := a.fleetsFor(msg)
+	if len(targets) == 0 {
+		value, _ := routeValue(msg, config.Current().FLEET_ROUTE_KEY)
+		config.LogWarnf("⚠️  [交管路由] %s=%q 沒有對應的交管 丟棄 %T", config.Current().FLEET_ROUTE_KEY, value, msg.Payload)
+		a.metrics.dropped.inc("fleet", "no_route")
+		return
+	}
+
+	for _, f := range targets {
+		a.sendFleet(f, msg)
+	}
+}
+
+// 送給所有交管 (角色、備援連線等通知)
+func (a *Arbiter) broadcastToFleets(msg *gen.ClientMessage) {
+	for _, f := range a.fleets {
+		a.sendFleet(f, msg)
+	}
+}
+
+// 送給一個交管 並記錄 metric
+func (a *Arbiter) sendFleet(f *fleetLink, msg *gen.ClientMessage) error {
+	typ := payloadType(msg)
+	err := f.client.SendMessageToFleet(msg)
+	switch {
+	case errors.Is(err, api.ErrNotConnected):
+		a.metrics.dropped.inc("fleet", "not_connected")
+	case err != nil:
+		a.metrics.sendErrors.inc("fleet", typ)
+	default:
+		a.metrics.messages.inc("to_fleet", typ)
+	}
+	return err
+}
+
+// 對外顯示用的交管狀態
+type FleetStatus struct {
+	Name       string                `json:"name"`
+	Routes     []string              `json:"routes,omitempty"`
+	Up         bool                  `json:"up"`
+	ECS        bool                  `json:"ecs"`
+	Serving    bool                  `json:"serving"`
+	Processing bool                  `json:"processing"`
+	LastHbAge  int64                 `json:"last_hb_ms"`
+	Stream     api.StreamClientStats `json:"stream"`
+}
+
+type FleetsStatus struct {
+	Rule   string        `json:"rule"`
+	Up     bool          `json:"up"`
+	Fleets []FleetStatus `json:"fleets"`
+}
+
+func (a *Arbiter) FleetsStatus() FleetsStatus {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	status := FleetsStatus{
+		Rule: a.fleetRule.String(),
+		Up:   a.Self.Fleet,
+	}
+	for _, f := range a.fleets {
+		status.Fleets = append(status.Fleets, FleetStatus{
+			Name:       f.name,
+			Routes:     f.routes,
+			Up:         f.up,
+			ECS:        f.ecs,
+			Serving:    f.serving,
+			Processing: f.processing,
+			LastHbAge:  time.Since(f.lastHb).Milliseconds(),
+			Stream:     f.client.Stats(),
+		})
+	}
+	return status
+}
@@ -0,0 +1,30 @@
+package internal
+
+import "testing"
+
+func TestUpdateFleetConnectivity(t *testing.T) {
+	tests := []struct {
+		name         string
+		required     int
+		up, ecs      []bool
+		fleet, ecsOK bool
+	}{
+		{"all up", 3, []bool{true, true, true}, []bool{true, true, true}, true, true},
+		{"all with one down", 3, []bool{true, false, true}, []bool{true, true, true}, false, true},
+		{"majority with one down", 2, []bool{true, false, true}, []bool{false, false, true}, true, false},
+		{"any with one up", 1, []bool{false, false, true}, []bool{false, true, false}, true, true},
+		{"any with none up", 1, []bool{false, false, false}, []bool{false, false, false}, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &Arbiter{events: NewEventLog(), fleetRule: FleetHealthRule{required: tt.required}}
+			for i := range tt.up {
+				a.fleets = append(a.fleets, &fleetLink{up: tt.up[i], ecs: tt.ecs[i]})
+			}
+			a.updateFleetConnectivityLocked()
+			if a.Self.Fleet != tt.fleet || a.Self.ECS != tt.ecsOK {
+				t.Errorf("Self.Fleet = %v, Self.ECS = %v, want %v, %v", a.Self.Fleet, a.Self.ECS, tt.fleet, tt.ecsOK)
+			}
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package internal
+
+import (
+	"context"
+	"kenmec/ha/jimmy/api"
+	"kenmec/ha/jimmy/config"
+	"log"
+	"time"
+)
+
+// 定時算 live / ready / failover 並依照角色以及健康狀態更新 HA gRPC port 上的 grpc.health.v1
+// 健康狀態只在這裡算 /health 的 API 只讀算好的結果
+func (a *Arbiter) StartGrpcHealthUpdater() {
+	ticker := time.NewTicker(1 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		a.updateHealth()
+
+		a.mu.RLock()
+		master := a.IsMaster
+		a.mu.RUnlock()
+		failover, _ := a.Health(HealthFailover)
+		ready, _ := a.Health(HealthReady)
+
+		a.otherHaServer.SetServingStatus("", failover.OK)
+		a.otherHaServer.SetServingStatus(api.HealthServiceMaster, master)
+		a.otherHaServer.SetServingStatus(api.HealthServiceReady, ready.OK)
+
+		select {
+		case <-a.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// 用 grpc.health.v1 檢查每個本機交管 結果會影響 Self.Fleet
+// FLEET_HEALTH_CHECK 可以在執行中打開或關掉
+func (a *Arbiter) StartFleetHealthProbe() {
+	interval := config.Current().FLEET_HB_INTERVAL.Duration()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-a.ctx.Done():
+			return
+		case <-ticker.C:
+			cfg := config.Current()
+			if cfg.FLEET_HEALTH_CHECK {
+				for _, f := range a.fleets {
+					a.checkFleetHealth(f, cfg.FLEET_HEALTH_SERVICE, interval)
+				}
+			}
+			retick(ticker, &interval, cfg.FLEET_HB_INTERVAL.Duration())
+		}
+	}
+}
+
+func (a *Arbiter) checkFleetHealth(f *fleetLink, service string, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(a.ctx, timeout)
+	serving, err := f.client.HealthCheck(ctx, service)
+	cancel()
+
+	a.mu.Lock()
+	changed := serving != f.serving
+	f.serving = serving
+	a.mu.Unlock()
+
+	if changed {
+		if serving {
+			log.Printf("✅ [交管 health] %s gRPC 服務 SERVING", f.name)
+		} else {
+			config.LogWarnf("⚠️  [交管 health] %s gRPC 服務不是 SERVING: %v", f.name, err)
+		}
+	}
+}
@@ -0,0 +1,255 @@
+package internal
+
+import (
+	"cmp"
+	"fmt"
+	"kenmec/ha/jimmy/config"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 三種健康狀態 規則在設定檔的 HEALTH
+const (
+	HealthLive     = "live"
+	HealthReady    = "ready"
+	HealthFailover = "failover"
+)
+
+// 一個檢查項目的結果 since 是這個結果從什麼時候開始
+type HealthCheck struct {
+	Name     string    `json:"name"`
+	OK       bool      `json:"ok"`
+	Required bool      `json:"required"`
+	Since    time.Time `json:"since"`
+	Detail   string    `json:"detail,omitempty"`
+}
+
+// HealthResult 是一個規則 (live / ready / failover) 的結果 failed 列出失敗的項目
+type HealthResult struct {
+	Policy string        `json:"policy"`
+	OK     bool          `json:"ok"`
+	Status string        `json:"status"`
+	Since  time.Time     `json:"since"`
+	Reason string        `json:"reason,omitempty"`
+	Failed []string      `json:"failed"`
+	Checks []HealthCheck `json:"checks"`
+}
+
+// 每個檢查項目以及規則的結果從什麼時候開始 有自己的鎖
+// results 是定時算好的結果 API 只讀這裡 不會改到狀態
+type healthState struct {
+	mu       sync.Mutex
+	checks   map[string]healthSince
+	policies map[string]healthSince
+	results  map[string]HealthResult
+	failover *DecisionFailover // 最近一次 failover 的結果 決策紀錄用
+}
+
+type healthSince struct {
+	ok    bool
+	since time.Time
+}
+
+// 結果有變動時更新開始的時間 回傳開始的時間以及有沒有變動 (第一次看到不算) 呼叫前要先拿到 h.mu
+func (h *healthState) observe(m map[string]healthSince, name string, ok bool, now time.Time) (time.Time, bool) {
+	prev, seen := m[name]
+	if seen && prev.ok == ok {
+		return prev.since, false
+	}
+	m[name] = healthSince{ok: ok, since: now}
+	return now, seen
+}
+
+func (h *healthState) lastFailover() *DecisionFailover {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.failover == nil {
+		return nil
+	}
+	last := *h.failover
+	return &last
+}
+
+// 目前每個檢查項目的結果 只會算規則有用到的
+func (a *Arbiter) healthSignals(names []string) map[string]HealthCheck {
+	cfg := config.Current().HEALTH
+	checks := map[string]HealthCheck{}
+
+	a.mu.RLock()
+	self := a.Self
+	maintenance := a.Maintenance
+	liveness := a.peerLiveness
+	startedAt := a.startedAt
+	consistent := len(a.configCheck.Mismatches) == 0
+	var mismatched []string
+	for _, inst := range a.instances {
+		if inst.heldVip != inst.master {
+			mismatched = append(mismatched, inst.name)
+		}
+	}
+	a.mu.RUnlock()
+
+	for _, name := range names {
+		c := HealthCheck{Name: name}
+		switch name {
+		case "maintenance":
+			c.OK = !maintenance
+			if maintenance {
+				c.Detail = "維修此機器中"
+			}
+		case "ecs":
+			c.OK = self.ECS
+		case "fleet":
+			c.OK = self.Fleet
+		case "deps":
+			c.OK = self.Deps
+		case "peer":
+			c.OK = liveness == PeerAlive
+			c.Detail = string(liveness)
+		case "replication":
+			lag := a.replication.status().LagMs
+			c.OK = lag <= float64(cfg.MAX_REPLICATION_LAG.Duration().Milliseconds())
+			c.Detail = fmt.Sprintf("延遲 %.1fms", lag)
+		case "startup":
+			uptime := time.Since(startedAt)
+			c.OK = uptime >= cfg.STARTUP_GRACE.Duration()
+			if !c.OK {
+				c.Detail = fmt.Sprintf("啟動 %v 還在 %v 內", uptime.Round(time.Second), cfg.STARTUP_GRACE.Duration())
+			}
+		case "config":
+			c.OK = consistent
+			if !consistent {
+				c.Detail = "跟另外一台的設定不一致 (/config/consistency)"
+			}
+		case "vip":
+			c.OK = len(mismatched) == 0
+			if !c.OK {
+				c.Detail = "VIP 跟角色不一致: " + strings.Join(mismatched, ", ")
+			}
+		default:
+			dep, _ := strings.CutPrefix(name, "dep:")
+			status, ok := a.Dependency(dep)
+			c.OK = ok && status.Up
+			c.Detail = status.LastError
+		}
+		checks[name] = c
+	}
+	return checks
+}
+
+func healthPolicy(cfg config.HealthConfig, policy string) (config.HealthPolicy, bool) {
+	switch policy {
+	case HealthLive:
+		return cfg.LIVE, true
+	case HealthReady:
+		return cfg.READY, true
+	case HealthFailover:
+		return cfg.FAILOVER, true
+	}
+	return config.HealthPolicy{}, false
+}
+
+// Health 回傳最近一次算好的結果 (StartGrpcHealthUpdater 每秒算一次) 找不到規則時 ok 為 false
+// 還沒算過時當成異常
+func (a *Arbiter) Health(policy string) (HealthResult, bool) {
+	if _, ok := healthPolicy(config.Current().HEALTH, policy); !ok {
+		return HealthResult{}, false
+	}
+	a.health.mu.Lock()
+	result, ok := a.health.results[policy]
+	a.health.mu.Unlock()
+	if !ok {
+		return HealthResult{Policy: policy, Status: healthStatus(false), Reason: "還沒有檢查結果", Failed: []string{}, Checks: []HealthCheck{}}, true
+	}
+	return result, true
+}
+
+// 依照 HEALTH 的規則算出 live / failover / ready 並存起來 只有定時的 goroutine 會呼叫
+func (a *Arbiter) updateHealth() {
+	for _, policy := range []string{HealthLive, HealthFailover, HealthReady} {
+		a.evaluateHealth(policy)
+	}
+}
+
+// evaluateHealth 算出一個規則的結果 結果變動時寫日誌並記錄 health.change 事件
+func (a *Arbiter) evaluateHealth(policy string) HealthResult {
+	rule, _ := healthPolicy(config.Current().HEALTH, policy)
+	signals := a.healthSignals(append(append([]string{}, rule.REQUIRED...), rule.OPTIONAL...))
+
+	now := time.Now()
+	result := HealthResult{Policy: policy, OK: true, Failed: []string{}, Checks: []HealthCheck{}}
+	optionalOK := 0
+
+	a.health.mu.Lock()
+	add := func(names []string, required bool) {
+		for _, name := range names {
+			c := signals[name]
+			c.Required = required
+			c.Since, _ = a.health.observe(a.health.checks, name, c.OK, now)
+			switch {
+			case c.OK && !required:
+				optionalOK++
+			case !c.OK && required:
+				result.OK = false
+				result.Failed = append(result.Failed, name)
+			case !c.OK:
+				result.Failed = append(result.Failed, name)
+			}
+			result.Checks = append(result.Checks, c)
+		}
+	}
+	add(rule.REQUIRED, true)
+	add(rule.OPTIONAL, false)
+
+	if optionalOK < rule.MIN_OPTIONAL {
+		result.OK = false
+		result.Reason = fmt.Sprintf("OPTIONAL 只有 %d 個正常 至少要 %d 個", optionalOK, rule.MIN_OPTIONAL)
+	}
+	var changed bool
+	result.Since, changed = a.health.observe(a.health.policies, policy, result.OK, now)
+	if policy == HealthFailover {
+		a.health.failover = &DecisionFailover{OK: result.OK, Failed: result.Failed, Since: result.Since}
+	}
+
+	result.Status = healthStatus(result.OK)
+	if !result.OK {
+		if result.Reason == "" {
+			result.Reason = "異常: " + strings.Join(result.Failed, ", ")
+		}
+	}
+	a.health.results[policy] = result
+	a.health.mu.Unlock()
+
+	if changed {
+		if result.OK {
+			log.Printf("✅ [health] %s 恢復正常", policy)
+		} else {
+			config.LogWarnf("⚠️  [health] %s 異常 %s", policy, result.Reason)
+		}
+		a.events.Record(EventHealth, fmt.Sprintf("%s %s", policy, result.Status), map[string]any{
+			"policy": policy,
+			"ok":     result.OK,
+			"failed": result.Failed,
+		})
+		// keepalived 的 track_script 看 failover 失敗時 VIP 會切到另外一台
+		if policy == HealthFailover {
+			a.decide(Decision{
+				Kind:    DecisionHealth,
+				From:    healthStatus(!result.OK),
+				To:      result.Status,
+				Summary: fmt.Sprintf("failover 健康檢查 %s", result.Status),
+				Cause:   DecisionCause{Source: CauseHealth, Detail: cmp.Or(result.Reason, "全部正常")},
+			})
+		}
+	}
+	return result
+}
+
+func healthStatus(ok bool) string {
+	if ok {
+		return "ok"
+	}
+	return "not ok"
+}
@@ -0,0 +1,137 @@
+package internal
+
+import (
+	"kenmec/ha/jimmy/config"
+	"slices"
+	"testing"
+	"time"
+)
+
+// 只用 maintenance / ecs / fleet / deps 這幾個直接看 Self 的項目
+func newHealthArbiter(t *testing.T, failover config.HealthPolicy) *Arbiter {
+	t.Helper()
+	prev := config.Current()
+	t.Cleanup(func() { config.Set(prev) })
+	config.Set(&config.Config{HEALTH: config.HealthConfig{FAILOVER: failover}})
+
+	a := NewArbiter(nil, nil, nil, nil)
+	t.Cleanup(a.cancel)
+	a.Self = Connectivity{ECS: true, Fleet: true, Deps: true}
+	return a
+}
+
+func TestEvaluateHealthPolicy(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy config.HealthPolicy
+		self   Connectivity
+		ok     bool
+		failed []string
+	}{
+		{"required all ok", config.HealthPolicy{REQUIRED: []string{"ecs", "fleet"}}, Connectivity{ECS: true, Fleet: true}, true, []string{}},
+		{"required failed", config.HealthPolicy{REQUIRED: []string{"ecs", "fleet"}}, Connectivity{ECS: true}, false, []string{"fleet"}},
+		// OPTIONAL 失敗會列出來 但是沒有 MIN_OPTIONAL 時不影響結果
+		{"optional failed", config.HealthPolicy{REQUIRED: []string{"ecs"}, OPTIONAL: []string{"fleet", "deps"}}, Connectivity{ECS: true}, true, []string{"fleet", "deps"}},
+		{"min optional met", config.HealthPolicy{OPTIONAL: []string{"fleet", "deps"}, MIN_OPTIONAL: 1}, Connectivity{Deps: true}, true, []string{"fleet"}},
+		{"min optional not met", config.HealthPolicy{OPTIONAL: []string{"fleet", "deps"}, MIN_OPTIONAL: 2}, Connectivity{Deps: true}, false, []string{"fleet"}},
+		{"empty policy", config.HealthPolicy{}, Connectivity{}, true, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newHealthArbiter(t, tt.policy)
+			a.Self = tt.self
+
+			result := a.evaluateHealth(HealthFailover)
+			if result.OK != tt.ok || !slices.Equal(result.Failed, tt.failed) {
+				t.Errorf("ok = %v failed = %v, want %v %v (reason %q)", result.OK, result.Failed, tt.ok, tt.failed, result.Reason)
+			}
+			for _, c := range result.Checks {
+				if c.Required != slices.Contains(tt.policy.REQUIRED, c.Name) {
+					t.Errorf("check %s required = %v", c.Name, c.Required)
+				}
+			}
+		})
+	}
+}
+
+func TestHealthReadsCachedResult(t *testing.T) {
+	a := newHealthArbiter(t, config.HealthPolicy{REQUIRED: []string{"maintenance"}})
+
+	// 還沒算過 當成異常
+	if result, ok := a.Health(HealthFailover); !ok || result.OK {
+		t.Fatalf("before the first evaluation: ok = %v result = %+v", ok, result)
+	}
+	if _, ok := a.Health("unknown"); ok {
+		t.Error("unknown policy found")
+	}
+
+	a.updateHealth()
+	if result, _ := a.Health(HealthFailover); !result.OK {
+		t.Fatalf("result = %+v, want ok", result)
+	}
+
+	// 狀態變了 但是還沒重新算 API 讀到的還是上一次的結果 也不會記錄事件
+	a.Maintenance = true
+	events := len(a.Events().Since(0))
+	if result, _ := a.Health(HealthFailover); !result.OK {
+		t.Error("Health evaluated the policy instead of returning the cached result")
+	}
+	if n := len(a.Events().Since(0)); n != events {
+		t.Errorf("Health recorded %d events", n-events)
+	}
+
+	a.updateHealth()
+	if result, _ := a.Health(HealthFailover); result.OK || !slices.Equal(result.Failed, []string{"maintenance"}) {
+		t.Errorf("result = %+v, want maintenance failed", result)
+	}
+}
+
+func TestEvaluateHealthSince(t *testing.T) {
+	a := newHealthArbiter(t, config.HealthPolicy{REQUIRED: []string{"ecs"}, OPTIONAL: []string{"fleet"}})
+
+	first := a.evaluateHealth(HealthFailover)
+	checkSince := func(r HealthResult, name string) time.Time {
+		for _, c := range r.Checks {
+			if c.Name == name {
+				return c.Since
+			}
+		}
+		t.Fatalf("check %s not in %+v", name, r.Checks)
+		return time.Time{}
+	}
+
+	// 結果沒變 since 不變 也不會記錄事件
+	time.Sleep(time.Millisecond)
+	second := a.evaluateHealth(HealthFailover)
+	if !second.Since.Equal(first.Since) || !checkSince(second, "ecs").Equal(checkSince(first, "ecs")) {
+		t.Errorf("since moved although nothing changed: %v → %v", first.Since, second.Since)
+	}
+	if n := len(ParseEventFilter(EventHealth).Filter(a.Events().Since(0))); n != 0 {
+		t.Errorf("got %d health events on the first evaluations, want none", n)
+	}
+
+	// OPTIONAL 失敗 只有那一項的 since 會變
+	time.Sleep(time.Millisecond)
+	a.Self.Fleet = false
+	third := a.evaluateHealth(HealthFailover)
+	if !third.OK || !third.Since.Equal(first.Since) {
+		t.Errorf("policy changed on an optional failure: ok = %v since = %v", third.OK, third.Since)
+	}
+	if !checkSince(third, "fleet").After(checkSince(first, "fleet")) || !checkSince(third, "ecs").Equal(checkSince(first, "ecs")) {
+		t.Error("check since not tracked per check")
+	}
+
+	// REQUIRED 失敗 規則的 since 變成現在 記錄事件以及決策
+	time.Sleep(time.Millisecond)
+	a.Self.ECS = false
+	fourth := a.evaluateHealth(HealthFailover)
+	if fourth.OK || !fourth.Since.After(first.Since) {
+		t.Errorf("ok = %v since = %v, want failed since now", fourth.OK, fourth.Since)
+	}
+	if n := len(ParseEventFilter(EventHealth).Filter(a.Events().Since(0))); n != 1 {
+		t.Errorf("got %d health events, want 1", n)
+	}
+	if last := a.health.lastFailover(); last == nil || last.OK || !last.Since.Equal(fourth.Since) {
+		t.Errorf("last failover = %+v", last)
+	}
+}
@@ -0,0 +1,231 @@
+package internal
+
+import (
+	"bytes"
+	_ "embed"
+	"fmt"
+	"kenmec/ha/jimmy/config"
+	"os"
+	"path/filepath"
+	"strconv"
+	"text/template"
+)
+
+//go:embed keepalived.conf.tmpl
+var keepalivedTemplate string
+
+// keepalived 的 priority 範圍 255 保留給 VIP 的擁有者
+const (
+	keepalivedMaxPriority = 254
+	keepalivedMaxWeight   = 253
+)
+
+// RenderKeepalived 依照設定的 KEEPALIVED 產生 keepalived.conf
+func RenderKeepalived(cfg *config.Config) ([]byte, error) {
+	k := cfg.KEEPALIVED
+
+	routerID := cfg.NODE_ID
+	if routerID == "" {
+		routerID = "LVS_DEVEL"
+	}
+
+	tmpl, err := template.New("keepalived.conf").Funcs(template.FuncMap{
+		"scriptPath": k.ScriptPath,
+		"seconds": func(d config.Duration) string {
+			return strconv.FormatFloat(d.Duration().Seconds(), 'f', -1, 64)
+		},
+	}).Parse(keepalivedTemplate)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	err = tmpl.Execute(&buf, map[string]any{
+		"RouterID":   routerID,
+		"Interface":  k.INTERFACE,
+		"AdvertInt":  k.ADVERT_INT,
+		"AuthPass":   k.AUTH_PASS,
+		"Notify":     k.ScriptPath(k.NOTIFY),
+		"NotifyFifo": k.NOTIFY_FIFO,
+		"Scripts":    k.SCRIPTS,
+		"Instances":  k.INSTANCES,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// KeepalivedIssue 是 keepalived 設定檢查找到的問題
+type KeepalivedIssue struct {
+	Error   bool   `json:"error"` // false 代表只是警告
+	Key     string `json:"key"`
+	Message string `json:"message"`
+}
+
+func (i KeepalivedIssue) String() string {
+	if i.Error {
+		return fmt.Sprintf("❌ %s: %s", i.Key, i.Message)
+	}
+	return fmt.Sprintf("⚠️  %s: %s", i.Key, i.Message)
+}
+
+type keepalivedLint []KeepalivedIssue
+
+func (l *keepalivedLint) errorf(key, format string, args ...any) {
+	*l = append(*l, KeepalivedIssue{Error: true, Key: key, Message: fmt.Sprintf(format, args...)})
+}
+
+func (l *keepalivedLint) warnf(key, format string, args ...any) {
+	*l = append(*l, KeepalivedIssue{Key: key, Message: fmt.Sprintf(format, args...)})
+}
+
+// 腳本必須存在而且可以執行 root 是檢查時的根目錄 (例如還沒安裝的目錄)
+func (l *keepalivedLint) script(key, path, root string) {
+	if root == "" {
+		return
+	}
+	info, err := os.Stat(filepath.Join(root, path))
+	if err != nil {
+		l.errorf(key, "找不到腳本 %s", path)
+		return
+	}
+	if info.Mode()&0o111 == 0 {
+		l.errorf(key, "腳本 %s 沒有執行權限", path)
+	}
+}
+
+// LintKeepalived 檢查 keepalived 設定 root 空白代表不檢查腳本檔案
+// 包含 router id 重複、找不到腳本 以及 priority 扣掉權重後永遠不會切換的情況
+func LintKeepalived(k config.KeepalivedConfig, root string) []KeepalivedIssue {
+	var l keepalivedLint
+
+	if k.INTERFACE == "" {
+		l.errorf("KEEPALIVED.INTERFACE", "必須設定 VRRP 用的網卡")
+	}
+	for _, p := range []struct {
+		key   string
+		value int
+	}{{"KEEPALIVED.PRIORITY", k.PRIORITY}, {"KEEPALIVED.PEER_PRIORITY", k.PEER_PRIORITY}} {
+		if p.value < 1 || p.value > keepalivedMaxPriority {
+			l.errorf(p.key, "priority %d 必須在 1 ~ %d 之間", p.value, keepalivedMaxPriority)
+		}
+	}
+	if k.ADVERT_INT <= 0 {
+		l.errorf("KEEPALIVED.ADVERT_INT", "必須大於 0")
+	}
+	if len(k.AUTH_PASS) > 8 {
+		l.warnf("KEEPALIVED.AUTH_PASS", "keepalived 只會用前 8 個字")
+	}
+	if !filepath.IsAbs(k.SCRIPT_DIR) {
+		l.errorf("KEEPALIVED.SCRIPT_DIR", "必須是絕對路徑 %q", k.SCRIPT_DIR)
+	}
+	// 有 notify_fifo 時不會用到 notify 腳本
+	if k.NOTIFY_FIFO == "" {
+		l.script("KEEPALIVED.NOTIFY", k.ScriptPath(k.NOTIFY), root)
+	}
+
+	scripts := map[string]config.KeepalivedScript{}
+	for i, s := range k.SCRIPTS {
+		key := fmt.Sprintf("KEEPALIVED.SCRIPTS[%d]", i)
+		if s.NAME == "" {
+			l.errorf(key+".NAME", "必須設定")
+		} else if _, ok := scripts[s.NAME]; ok {
+			l.errorf(key+".NAME", "名稱 %q 重複", s.NAME)
+		}
+		scripts[s.NAME] = s
+
+		if s.SCRIPT == "" {
+			l.errorf(key+".SCRIPT", "必須設定")
+		} else {
+			l.script(key+".SCRIPT", k.ScriptPath(s.SCRIPT), root)
+		}
+		if s.INTERVAL <= 0 || s.TIMEOUT <= 0 {
+			l.errorf(key, "INTERVAL 以及 TIMEOUT 必須大於 0")
+		}
+		if s.WEIGHT < -keepalivedMaxWeight || s.WEIGHT > keepalivedMaxWeight {
+			l.errorf(key+".WEIGHT", "權重 %d 必須在 -%d ~ %d 之間", s.WEIGHT, keepalivedMaxWeight, keepalivedMaxWeight)
+		}
+		if s.FALL < 1 || s.RISE < 1 {
+			l.errorf(key, "FALL 以及 RISE 至少要 1")
+		}
+	}
+
+	// instance 名稱以及 VIP 在 config.Load 時已經檢查過
+	routerIDs := map[int]string{}
+	tracked := map[string]bool{}
+	for i, inst := range k.INSTANCES {
+		key := fmt.Sprintf("KEEPALIVED.INSTANCES[%d]", i)
+		if inst.ROUTER_ID < 1 || inst.ROUTER_ID > 255 {
+			l.errorf(key+".ROUTER_ID", "virtual_router_id %d 必須在 1 ~ 255 之間", inst.ROUTER_ID)
+		} else if other, ok := routerIDs[inst.ROUTER_ID]; ok {
+			l.errorf(key+".ROUTER_ID", "virtual_router_id %d 跟 %s 重複", inst.ROUTER_ID, other)
+		}
+		routerIDs[inst.ROUTER_ID] = inst.NAME
+
+		var track []config.KeepalivedScript
+		for _, name := range inst.TRACK {
+			s, ok := scripts[name]
+			if !ok {
+				l.errorf(key+".TRACK", "找不到 vrrp_script %q", name)
+				continue
+			}
+			tracked[name] = true
+			track = append(track, s)
+		}
+		for _, p := range []struct {
+			key   string
+			value int
+		}{{key + ".PRIORITY", inst.PRIORITY}, {key + ".PEER_PRIORITY", inst.PEER_PRIORITY}} {
+			if p.value < 1 || p.value > keepalivedMaxPriority {
+				l.errorf(p.key, "priority %d 必須在 1 ~ %d 之間", p.value, keepalivedMaxPriority)
+			}
+		}
+		l.failover(key, inst.PRIORITY, inst.PEER_PRIORITY, track)
+	}
+
+	for i, s := range k.SCRIPTS {
+		if s.NAME != "" && !tracked[s.NAME] {
+			l.warnf(fmt.Sprintf("KEEPALIVED.SCRIPTS[%d]", i), "%s 沒有被任何 instance 追蹤", s.NAME)
+		}
+	}
+
+	return l
+}
+
+// 檢查 track_script 失敗時 MASTER 的 priority 會不會低於另外一台
+// 權重是正的時候 失敗等於少加分 所以一樣用絕對值計算
+func (l *keepalivedLint) failover(key string, priority, peerPriority int, track []config.KeepalivedScript) {
+	if len(track) == 0 {
+		l.warnf(key+".TRACK", "沒有 track_script 只有 keepalived 或整台停掉才會切換")
+		return
+	}
+
+	high, low := max(priority, peerPriority), min(priority, peerPriority)
+	drop := 0
+	for _, s := range track {
+		if s.WEIGHT == 0 {
+			// 權重 0 失敗時直接進入 FAULT
+			return
+		}
+		drop += abs(s.WEIGHT)
+	}
+
+	if high-drop >= low {
+		l.errorf(key+".TRACK", "priority %d 扣掉所有檢查的權重 %d 還是 %d 不會低於另外一台的 %d 檢查失敗也不會切換",
+			high, drop, high-drop, low)
+		return
+	}
+	for _, s := range track {
+		if high-abs(s.WEIGHT) >= low {
+			l.warnf(key+".TRACK", "%s 單獨失敗不會切換 (priority %d 權重 %d 另外一台 %d)", s.NAME, high, s.WEIGHT, low)
+		}
+	}
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,171 @@
+package internal
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"kenmec/ha/jimmy/config"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// keepalived 通知的狀態
+var keepalivedStates = []string{"MASTER", "BACKUP", "FAULT", "STOP", "DELETED"}
+
+// KeepalivedNotification 是 keepalived 的一筆通知 TYPE NAME STATE PRIORITY
+type KeepalivedNotification struct {
+	Type     string `json:"type"` // INSTANCE / GROUP
+	Name     string `json:"name"`
+	State    string `json:"state"`
+	Priority int    `json:"priority"`
+	Source   string `json:"source"` // fifo / api
+}
+
+// ParseKeepalivedNotification 解析 notify_fifo 的一行 例如 INSTANCE "VI_1" MASTER 100
+// 舊版的 keepalived 沒有 priority
+func ParseKeepalivedNotification(line string) (KeepalivedNotification, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 3 || len(fields) > 4 {
+		return KeepalivedNotification{}, fmt.Errorf("格式錯誤 %q (TYPE NAME STATE PRIORITY)", line)
+	}
+	n := KeepalivedNotification{
+		Type:  fields[0],
+		Name:  strings.Trim(fields[1], `"`),
+		State: fields[2],
+	}
+	if len(fields) == 4 {
+		priority, err := strconv.Atoi(fields[3])
+		if err != nil {
+			return KeepalivedNotification{}, fmt.Errorf("priority 不是數字 %q", fields[3])
+		}
+		n.Priority = priority
+	}
+	return n, n.validate()
+}
+
+func (n KeepalivedNotification) validate() error {
+	if n.Type != "INSTANCE" && n.Type != "GROUP" {
+		return fmt.Errorf("無效的類型 %q (INSTANCE、GROUP)", n.Type)
+	}
+	if n.Name == "" {
+		return errors.New("沒有名稱")
+	}
+	if !slices.Contains(keepalivedStates, n.State) {
+		return fmt.Errorf("無效的狀態 %q", n.State)
+	}
+	return nil
+}
+
+// HandleKeepalivedNotify 記錄一筆 keepalived 通知 INSTANCE 的通知會更新角色
+// 只有 MASTER 算持有 VIP FAULT / STOP 都當成 BACKUP
+func (a *Arbiter) HandleKeepalivedNotify(n KeepalivedNotification) error {
+	a.metrics.notifications.inc(n.Source, n.State)
+	a.events.Record(EventKeepalivedNotify, fmt.Sprintf("keepalived %s %s %s", n.Type, n.Name, n.State), map[string]any{
+		"type":     n.Type,
+		"name":     n.Name,
+		"state":    n.State,
+		"priority": n.Priority,
+		"source":   n.Source,
+	})
+
+	if err := n.validate(); err != nil {
+		return err
+	}
+	if n.Type == "GROUP" {
+		// sync group 只記錄 角色看裡面每個 instance 自己的通知
+		return nil
+	}
+
+	a.mu.RLock()
+	inst := a.instanceLocked(n.Name)
+	a.mu.RUnlock()
+	if inst == nil {
+		return fmt.Errorf("找不到 instance %q", n.Name)
+	}
+
+	log.Printf("📣 [keepalived] %s %s priority %d (%s)", inst.name, n.State, n.Priority, n.Source)
+	cause := DecisionCause{
+		Source:       CauseKeepalived,
+		Detail:       fmt.Sprintf("%s %s %s priority %d (%s)", n.Type, n.Name, n.State, n.Priority, n.Source),
+		Notification: &n,
+	}
+	if err := a.UpdateRole(inst.name, n.State == "MASTER", cause); err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	inst.state = n.State
+	inst.priority = n.Priority
+	inst.mismatchSince = time.Time{}
+	a.mu.Unlock()
+	return nil
+}
+
+// StartNotifyFifo 讀 keepalived 的 notify_fifo 沒有設定 KEEPALIVED.NOTIFY_FIFO 時不做事
+func (a *Arbiter) StartNotifyFifo() {
+	path := config.Current().KEEPALIVED.NOTIFY_FIFO
+	if path == "" {
+		return
+	}
+
+	if err := ensureFifo(path); err != nil {
+		config.LogErrorf("❌ [keepalived] 無法建立 notify_fifo %s: %v", path, err)
+		return
+	}
+	// 用讀寫開啟 keepalived 重新啟動 (關掉寫的那端) 時不會讀到 EOF
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		config.LogErrorf("❌ [keepalived] 無法開啟 notify_fifo %s: %v", path, err)
+		return
+	}
+	go func() {
+		<-a.ctx.Done()
+		f.Close()
+	}()
+
+	log.Printf("📣 [keepalived] 讀取 notify_fifo %s", path)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		n, err := ParseKeepalivedNotification(line)
+		if err != nil {
+			config.LogWarnf("⚠️  [keepalived] 無法解析 notify_fifo 的通知: %v", err)
+			continue
+		}
+		n.Source = "fifo"
+		if err := a.HandleKeepalivedNotify(n); err != nil {
+			config.LogWarnf("⚠️  [keepalived] %v", err)
+		}
+	}
+	if err := scanner.Err(); err != nil && a.ctx.Err() == nil {
+		config.LogErrorf("❌ [keepalived] 讀取 notify_fifo 失敗: %v", err)
+	}
+}
+
+// 路徑不存在時建立 FIFO 已經存在的必須是 FIFO
+func ensureFifo(path string) error {
+	info, err := os.Stat(path)
+	if err == nil {
+		if info.Mode()&fs.ModeNamedPipe == 0 {
+			return errors.New("已經存在而且不是 FIFO")
+		}
+		return nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return err
+	}
+	return syscall.Mkfifo(path, 0o600)
+}
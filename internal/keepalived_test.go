@@ -0,0 +1,130 @@
+package internal
+
+import (
+	"kenmec/ha/jimmy/config"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testKeepalived() config.KeepalivedConfig {
+	return config.KeepalivedConfig{
+		INTERFACE:     "eno2",
+		PRIORITY:      100,
+		PEER_PRIORITY: 100,
+		ADVERT_INT:    config.Duration(time.Second),
+		AUTH_PASS:     "1111",
+		SCRIPT_DIR:    "/etc/keepalived",
+		NOTIFY:        "notify_role.sh",
+		SCRIPTS: []config.KeepalivedScript{
+			{NAME: "chk_health", SCRIPT: "chk_server_health.sh", INTERVAL: config.Duration(2 * time.Second), TIMEOUT: config.Duration(2 * time.Second), WEIGHT: -60, FALL: 2, RISE: 2},
+		},
+		INSTANCES: []config.KeepalivedInstance{
+			{NAME: "TC_VI", ROUTER_ID: 51, VIP: "192.168.0.200/24", TRACK: []string{"chk_health"}, PRIORITY: 100, PEER_PRIORITY: 90},
+			{NAME: "DB_VI", ROUTER_ID: 53, VIP: "192.168.0.202/24", TRACK: []string{"chk_health"}, PRIORITY: 90, PEER_PRIORITY: 100},
+		},
+	}
+}
+
+func TestRenderKeepalivedInstancePriority(t *testing.T) {
+	out, err := RenderKeepalived(&config.Config{NODE_ID: "ha-a", KEEPALIVED: testKeepalived()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	priorities := map[string]string{}
+	re := regexp.MustCompile(`(?s)vrrp_instance (\w+) \{.*?priority (\d+)`)
+	for _, m := range re.FindAllStringSubmatch(string(out), -1) {
+		priorities[m[1]] = m[2]
+	}
+	if priorities["TC_VI"] != "100" || priorities["DB_VI"] != "90" {
+		t.Errorf("priorities = %v, want TC_VI 100 and DB_VI 90\n%s", priorities, out)
+	}
+	if !strings.Contains(string(out), "router_id ha-a") {
+		t.Errorf("router_id not rendered:\n%s", out)
+	}
+}
+
+func TestLintKeepalived(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(k *config.KeepalivedConfig)
+		key    string // 空白代表沒有錯誤
+	}{
+		{"valid", func(k *config.KeepalivedConfig) {}, ""},
+		{"duplicate router id", func(k *config.KeepalivedConfig) { k.INSTANCES[1].ROUTER_ID = 51 }, "KEEPALIVED.INSTANCES[1].ROUTER_ID"},
+		{"unknown track script", func(k *config.KeepalivedConfig) { k.INSTANCES[0].TRACK = []string{"chk_x"} }, "KEEPALIVED.INSTANCES[0].TRACK"},
+		{"instance priority out of range", func(k *config.KeepalivedConfig) { k.INSTANCES[1].PRIORITY = 255 }, "KEEPALIVED.INSTANCES[1].PRIORITY"},
+		{"weight too small to fail over", func(k *config.KeepalivedConfig) {
+			k.INSTANCES[0].PRIORITY, k.INSTANCES[0].PEER_PRIORITY = 200, 100
+		}, "KEEPALIVED.INSTANCES[0].TRACK"},
+		// 全域的 priority 差很多 但是 instance 自己的 priority 可以切換
+		{"instance priority overrides global", func(k *config.KeepalivedConfig) { k.PRIORITY = 200 }, ""},
+		{"relative script dir", func(k *config.KeepalivedConfig) { k.SCRIPT_DIR = "keepalived" }, "KEEPALIVED.SCRIPT_DIR"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k := testKeepalived()
+			tt.modify(&k)
+
+			var errors []string
+			for _, issue := range LintKeepalived(k, "") {
+				if issue.Error {
+					errors = append(errors, issue.Key)
+				}
+			}
+			if tt.key == "" {
+				if len(errors) != 0 {
+					t.Fatalf("got errors %v, want none", errors)
+				}
+				return
+			}
+			if !slices.Contains(errors, tt.key) {
+				t.Errorf("got errors %v, want %s", errors, tt.key)
+			}
+		})
+	}
+}
+
+func TestRenderKeepalivedNotifyChannel(t *testing.T) {
+	for _, tt := range []struct {
+		fifo             string
+		wantFifo, script bool
+	}{
+		{"/run/ha_arbiter/keepalived.fifo", true, false},
+		{"", false, true},
+	} {
+		k := testKeepalived()
+		k.NOTIFY_FIFO = tt.fifo
+		out, err := RenderKeepalived(&config.Config{KEEPALIVED: k})
+		if err != nil {
+			t.Fatal(err)
+		}
+		conf := string(out)
+
+		// 只會有一個管道 同一個通知不會收到兩次
+		if got := strings.Contains(conf, "notify_fifo "+tt.fifo); got != tt.wantFifo {
+			t.Errorf("NOTIFY_FIFO %q: notify_fifo rendered = %v, want %v", tt.fifo, got, tt.wantFifo)
+		}
+		want := 0
+		if tt.script {
+			want = len(k.INSTANCES)
+		}
+		if got := strings.Count(conf, `notify "/etc/keepalived/notify_role.sh"`); got != want {
+			t.Errorf("NOTIFY_FIFO %q: notify script rendered %d times, want %d\n%s", tt.fifo, got, want, conf)
+		}
+	}
+}
+
+func TestLintKeepalivedSkipsNotifyScriptWithFifo(t *testing.T) {
+	k := testKeepalived()
+	k.NOTIFY_FIFO = "/run/ha_arbiter/keepalived.fifo"
+	// root 是空的目錄 腳本都找不到
+	for _, issue := range LintKeepalived(k, t.TempDir()) {
+		if issue.Key == "KEEPALIVED.NOTIFY" {
+			t.Errorf("notify script checked although NOTIFY_FIFO is set: %v", issue)
+		}
+	}
+}
@@ -0,0 +1,18 @@
+package internal
+
+import (
+	"kenmec/ha/jimmy/config"
+	"log"
+	"os"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SetupLogging 讓 log 以及 gin 的輸出依照 LOG_LEVEL 過濾
+// 一般的 log.Printf 算 info 警告跟錯誤用 config.LogWarnf / config.LogErrorf
+// gin 的路由以及每個請求的紀錄算 debug
+func SetupLogging(level string) {
+	config.SetLogLevel(level)
+	log.SetOutput(config.LogWriter(os.Stderr, config.LogInfo))
+	gin.DefaultWriter = config.LogWriter(os.Stdout, config.LogDebug)
+}
@@ -0,0 +1,353 @@
+package internal
+
+import (
+	"fmt"
+	"io"
+	"kenmec/ha/jimmy/api"
+	"math"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// Prometheus text format 0.0.4 自己產生 不另外引入 client library
+const metricsContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+var (
+	// 心跳間隔 預設每秒一次 超過幾秒才算遲到由 TIMEOUT / phi 決定
+	heartbeatBuckets = []float64{0.1, 0.25, 0.5, 0.75, 1, 1.25, 1.5, 2, 3, 5, 10}
+	// 角色維持的時間
+	roleDurationBuckets = []float64{1, 10, 60, 300, 1800, 3600, 6 * 3600, 24 * 3600, 7 * 24 * 3600}
+	// 另外一台不見到本機接手 VIP
+	failoverBuckets = []float64{0.5, 1, 2, 3, 5, 10, 20, 30, 60, 120}
+)
+
+// label 依照宣告的順序 值要跟 labels 一樣多
+func labelPairs(names []string, values []string) string {
+	var b strings.Builder
+	for i, name := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(name)
+		b.WriteString(`="`)
+		b.WriteString(escapeLabel(values[i]))
+		b.WriteByte('"')
+	}
+	return b.String()
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(v string) string {
+	return labelEscaper.Replace(v)
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// 寫出一個 metric 的 HELP / TYPE 以及樣本
+type metricsWriter struct {
+	w io.Writer
+}
+
+func (m metricsWriter) header(name, help, typ string) {
+	fmt.Fprintf(m.w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+func (m metricsWriter) sample(name, labels string, value float64) {
+	if labels == "" {
+		fmt.Fprintf(m.w, "%s %s\n", name, formatFloat(value))
+		return
+	}
+	fmt.Fprintf(m.w, "%s{%s} %s\n", name, labels, formatFloat(value))
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// 累加的計數器 每組 label 一個值
+type counterVec struct {
+	name, help string
+	labels     []string
+
+	mu     sync.Mutex
+	values map[string]float64
+}
+
+func newCounterVec(name, help string, labels ...string) *counterVec {
+	return &counterVec{name: name, help: help, labels: labels, values: map[string]float64{}}
+}
+
+func (c *counterVec) inc(values ...string) {
+	key := labelPairs(c.labels, values)
+	c.mu.Lock()
+	c.values[key]++
+	c.mu.Unlock()
+}
+
+func (c *counterVec) write(m metricsWriter) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	m.header(c.name, c.help, "counter")
+	keys := make([]string, 0, len(c.values))
+	for k := range c.values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		m.sample(c.name, k, c.values[k])
+	}
+}
+
+type histogram struct {
+	counts []uint64 // 每個 bucket 各自的數量 輸出時再累加
+	sum    float64
+	count  uint64
+}
+
+// 直方圖 每組 label 一個
+type histogramVec struct {
+	name, help string
+	labels     []string
+	buckets    []float64
+
+	mu     sync.Mutex
+	series map[string]*histogram
+}
+
+func newHistogramVec(name, help string, buckets []float64, labels ...string) *histogramVec {
+	return &histogramVec{name: name, help: help, labels: labels, buckets: buckets, series: map[string]*histogram{}}
+}
+
+func (h *histogramVec) observe(v float64, values ...string) {
+	key := labelPairs(h.labels, values)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s, ok := h.series[key]
+	if !ok {
+		s = &histogram{counts: make([]uint64, len(h.buckets))}
+		h.series[key] = s
+	}
+	if i, _ := slices.BinarySearch(h.buckets, v); i < len(h.buckets) {
+		s.counts[i]++
+	}
+	s.sum += v
+	s.count++
+}
+
+func (h *histogramVec) write(m metricsWriter) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	m.header(h.name, h.help, "histogram")
+	keys := make([]string, 0, len(h.series))
+	for k := range h.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		s := h.series[k]
+		prefix := k
+		if prefix != "" {
+			prefix += ","
+		}
+		var cumulative uint64
+		for i, le := range h.buckets {
+			cumulative += s.counts[i]
+			m.sample(h.name+"_bucket", prefix+`le="`+formatFloat(le)+`"`, float64(cumulative))
+		}
+		m.sample(h.name+"_bucket", prefix+`le="+Inf"`, float64(s.count))
+		m.sample(h.name+"_sum", k, s.sum)
+		m.sample(h.name+"_count", k, float64(s.count))
+	}
+}
+
+// proto 訊息 payload oneof 裡設定的欄位名稱 例如 sync_mission
+func payloadType(msg proto.Message) string {
+	m := msg.ProtoReflect()
+	oneof := m.Descriptor().Oneofs().ByName("payload")
+	if oneof == nil {
+		return "unknown"
+	}
+	fd := m.WhichOneof(oneof)
+	if fd == nil {
+		return "none"
+	}
+	return string(fd.Name())
+}
+
+// 仲裁程式在執行中累積的 metric 目前狀態類的 gauge 在輸出時才從 Arbiter 取
+type arbiterMetrics struct {
+	messages        *counterVec
+	sendErrors      *counterVec
+	dropped         *counterVec
+	hbInterval      *histogramVec
+	hbTimeouts      *counterVec
+	roleTransitions *counterVec
+	roleDuration    *histogramVec
+	failover        *histogramVec
+	notifications   *counterVec
+	reconciled      *counterVec
+}
+
+func newArbiterMetrics() *arbiterMetrics {
+	return &arbiterMetrics{
+		messages: newCounterVec("ha_messages_total",
+			"收送的 gRPC 訊息數量 direction 是 to_peer / from_peer / to_fleet / from_fleet",
+			"direction", "type"),
+		sendErrors: newCounterVec("ha_send_errors_total",
+			"送出失敗的訊息數量", "target", "type"),
+		dropped: newCounterVec("ha_messages_dropped_total",
+			"沒有送出就丟棄的訊息數量 (沒有連線、找不到對應的交管)", "target", "reason"),
+		hbInterval: newHistogramVec("ha_heartbeat_interval_seconds",
+			"收到心跳的間隔", heartbeatBuckets, "source", "name"),
+		hbTimeouts: newCounterVec("ha_heartbeat_timeouts_total",
+			"心跳超時的次數", "source", "name"),
+		roleTransitions: newCounterVec("ha_role_transitions_total",
+			"instance 角色變更的次數 role 是變更後的角色", "instance", "role"),
+		roleDuration: newHistogramVec("ha_role_duration_seconds",
+			"角色變更前 上一個角色維持了多久", roleDurationBuckets, "instance", "role"),
+		failover: newHistogramVec("ha_failover_seconds",
+			"偵測到另外一台不見之後 本機接手 instance 花了多久", failoverBuckets, "instance"),
+		notifications: newCounterVec("ha_keepalived_notifications_total",
+			"收到的 keepalived 通知 source 是 fifo / api", "source", "state"),
+		reconciled: newCounterVec("ha_role_reconciled_total",
+			"依照網卡上的 VIP 校正角色的次數 (漏掉了通知)", "instance"),
+	}
+}
+
+// WriteMetrics 輸出 Prometheus text format
+func (a *Arbiter) WriteMetrics(w io.Writer) {
+	m := metricsWriter{w: w}
+	status := a.Status()
+	roles := a.VipRoles()
+	deps := a.Dependencies()
+
+	m.header("ha_info", "版本以及節點 值固定是 1", "gauge")
+	m.sample("ha_info", labelPairs([]string{"version", "node_id"}, []string{status.Version, status.NodeID}), 1)
+	m.header("ha_uptime_seconds", "啟動了幾秒", "gauge")
+	m.sample("ha_uptime_seconds", "", time.Since(status.StartedAt).Seconds())
+
+	m.header("ha_is_master", "交管跟著的 instance 是不是 MASTER", "gauge")
+	m.sample("ha_is_master", "", boolValue(status.Role == "MASTER"))
+	m.header("ha_role", "每個 instance 的角色 1 是 MASTER 0 是 BACKUP", "gauge")
+	for _, r := range roles.Roles {
+		m.sample("ha_role", labelPairs([]string{"instance", "service"}, []string{r.Instance, r.Service}), boolValue(r.Master))
+	}
+	m.header("ha_peer_role", "另外一台回報的每個 instance 角色 1 是 MASTER", "gauge")
+	for _, r := range roles.Roles {
+		m.sample("ha_peer_role", labelPairs([]string{"instance", "service"}, []string{r.Instance, r.Service}), boolValue(r.PeerMaster))
+	}
+	m.header("ha_vip_held", "每個 instance 的 VIP 實際上在不在本機", "gauge")
+	for _, r := range roles.Roles {
+		m.sample("ha_vip_held", labelPairs([]string{"instance", "service"}, []string{r.Instance, r.Service}), boolValue(r.HoldsVIP))
+	}
+	m.header("ha_vip_mismatch", "VIP 在不在本機跟角色不一致", "gauge")
+	for _, r := range roles.Roles {
+		m.sample("ha_vip_mismatch", labelPairs([]string{"instance", "service"}, []string{r.Instance, r.Service}), boolValue(r.Mismatch))
+	}
+	m.header("ha_vip_split", "VIP 分散在兩台上", "gauge")
+	m.sample("ha_vip_split", "", boolValue(roles.Split))
+	m.header("ha_role_epoch", "角色變更的次數 (放在 UDP 心跳裡的 epoch)", "gauge")
+	m.sample("ha_role_epoch", "", float64(status.Epoch))
+	m.header("ha_maintenance", "維修模式", "gauge")
+	m.sample("ha_maintenance", "", boolValue(status.Maintenance))
+
+	m.header("ha_connectivity", "連線狀態 side 是 self / other", "gauge")
+	for _, c := range []struct {
+		side string
+		conn Connectivity
+	}{{"self", status.Self}, {"other", status.Other}} {
+		for _, f := range []struct {
+			kind string
+			ok   bool
+		}{{"ecs", c.conn.ECS}, {"fleet", c.conn.Fleet}, {"ha", c.conn.Ha}, {"deps", c.conn.Deps}} {
+			m.sample("ha_connectivity", labelPairs([]string{"side", "kind"}, []string{c.side, f.kind}), boolValue(f.ok))
+		}
+	}
+	m.header("ha_peer_liveness", "另外一台的狀態 目前的狀態值是 1", "gauge")
+	for _, s := range []PeerLiveness{PeerAlive, PeerStreamStuck, PeerGone} {
+		m.sample("ha_peer_liveness", labelPairs([]string{"state"}, []string{string(s)}), boolValue(status.PeerLiveness == s))
+	}
+
+	m.header("ha_heartbeat_age_seconds", "距離上次收到心跳幾秒", "gauge")
+	fleetNames := make([]string, 0, len(status.Heartbeats.Fleets))
+	for name := range status.Heartbeats.Fleets {
+		fleetNames = append(fleetNames, name)
+	}
+	sort.Strings(fleetNames)
+	for _, name := range fleetNames {
+		age := status.Heartbeats.Fleets[name]
+		m.sample("ha_heartbeat_age_seconds", labelPairs([]string{"source", "name"}, []string{"fleet", name}), float64(age)/1000)
+	}
+	m.sample("ha_heartbeat_age_seconds", labelPairs([]string{"source", "name"}, []string{"peer", "grpc"}), float64(status.Heartbeats.Peer)/1000)
+	if status.Heartbeats.PeerUDP > 0 {
+		m.sample("ha_heartbeat_age_seconds", labelPairs([]string{"source", "name"}, []string{"peer", "udp"}), float64(status.Heartbeats.PeerUDP)/1000)
+	}
+	a.metrics.hbInterval.write(m)
+	a.metrics.hbTimeouts.write(m)
+
+	streamLabels := []string{"client", "name", "address"}
+	type stream struct {
+		labels string
+		stats  api.StreamClientStats
+	}
+	var streams []stream
+	for _, c := range status.PeerClients {
+		streams = append(streams, stream{labelPairs(streamLabels, []string{"peer", "path" + strconv.Itoa(c.Path), c.Address}), c.StreamClientStats})
+	}
+	for _, c := range status.FleetClients {
+		streams = append(streams, stream{labelPairs(streamLabels, []string{"fleet", c.Name, c.Address}), c.StreamClientStats})
+	}
+	m.header("ha_stream_up", "gRPC stream 是否已經建立", "gauge")
+	for _, s := range streams {
+		m.sample("ha_stream_up", s.labels, boolValue(s.stats.State == api.StateReady))
+	}
+	m.header("ha_stream_retries", "目前連續重連失敗的次數", "gauge")
+	for _, s := range streams {
+		m.sample("ha_stream_retries", s.labels, float64(s.stats.Retries))
+	}
+	m.header("ha_stream_reconnects_total", "成功重新連線的次數", "counter")
+	for _, s := range streams {
+		m.sample("ha_stream_reconnects_total", s.labels, float64(s.stats.Reconnects))
+	}
+	m.header("ha_server_clients", "另外一台連進來的連線數", "gauge")
+	m.sample("ha_server_clients", "", float64(status.ServerClients))
+
+	a.metrics.messages.write(m)
+	a.metrics.sendErrors.write(m)
+	a.metrics.dropped.write(m)
+
+	m.header("ha_replication_lag_seconds", "最後一筆同步資料從另外一台送出到本機收到的時間 單向 包含兩台的時鐘差", "gauge")
+	m.sample("ha_replication_lag_seconds", "", status.Replication.LagMs/1000)
+
+	a.metrics.roleTransitions.write(m)
+	a.metrics.roleDuration.write(m)
+	a.metrics.failover.write(m)
+	a.metrics.notifications.write(m)
+	a.metrics.reconciled.write(m)
+
+	m.header("ha_dependency_up", "依賴的服務是否正常", "gauge")
+	for _, d := range deps {
+		m.sample("ha_dependency_up", labelPairs([]string{"name", "type", "required"}, []string{d.Name, d.Type, strconv.FormatBool(d.Required)}), boolValue(d.Up))
+	}
+}
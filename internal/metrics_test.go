@@ -0,0 +1,104 @@
+package internal
+
+import (
+	pb "kenmec/ha/jimmy/protoGen"
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+)
+
+func TestPayloadType(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  proto.Message
+		want string
+	}{
+		{"client heartbeat", &pb.ClientMessage{Payload: &pb.ClientMessage_Hb{Hb: 1}}, "hb"},
+		{"client message", &pb.ClientMessage{Payload: &pb.ClientMessage_SyncMission{SyncMission: "{}"}}, "sync_mission"},
+		// 空的 message 型別也要用 oneof 的欄位名稱
+		{"empty sub message", &pb.ServerMessage{Payload: &pb.ServerMessage_MissionReport{MissionReport: &pb.MissionReport{}}}, "mission_report"},
+		{"peer message", &pb.StatusRequest{Payload: &pb.StatusRequest_IsFleetConnected{IsFleetConnected: false}}, "is_fleet_connected"},
+		{"no payload set", &pb.StatusResponse{}, "none"},
+		{"no payload oneof", &pb.Probe{}, "unknown"},
+	}
+	for _, tt := range tests {
+		if got := payloadType(tt.msg); got != tt.want {
+			t.Errorf("%s: payloadType = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestHistogramVecWrite(t *testing.T) {
+	h := newHistogramVec("ha_test_seconds", "測試用", []float64{0.5, 1, 2.5}, "path")
+	// 剛好等於上限的值算在那個 bucket 超過最大的只算在 +Inf
+	for _, v := range []float64{0.1, 0.5, 0.7, 2.5, 10} {
+		h.observe(v, "grpc")
+	}
+	h.observe(1, "udp")
+
+	var b strings.Builder
+	h.write(metricsWriter{&b})
+	want := `# HELP ha_test_seconds 測試用
+# TYPE ha_test_seconds histogram
+ha_test_seconds_bucket{path="grpc",le="0.5"} 2
+ha_test_seconds_bucket{path="grpc",le="1"} 3
+ha_test_seconds_bucket{path="grpc",le="2.5"} 4
+ha_test_seconds_bucket{path="grpc",le="+Inf"} 5
+ha_test_seconds_sum{path="grpc"} 13.8
+ha_test_seconds_count{path="grpc"} 5
+ha_test_seconds_bucket{path="udp",le="0.5"} 0
+ha_test_seconds_bucket{path="udp",le="1"} 1
+ha_test_seconds_bucket{path="udp",le="2.5"} 1
+ha_test_seconds_bucket{path="udp",le="+Inf"} 1
+ha_test_seconds_sum{path="udp"} 1
+ha_test_seconds_count{path="udp"} 1
+`
+	if got := b.String(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestHistogramVecWithoutLabels(t *testing.T) {
+	h := newHistogramVec("ha_failover_seconds", "測試用", []float64{1})
+	h.observe(3)
+
+	var b strings.Builder
+	h.write(metricsWriter{&b})
+	for _, line := range []string{
+		`ha_failover_seconds_bucket{le="1"} 0`,
+		`ha_failover_seconds_bucket{le="+Inf"} 1`,
+		"ha_failover_seconds_sum 3",
+		"ha_failover_seconds_count 1",
+	} {
+		if !strings.Contains(b.String(), line+"\n") {
+			t.Errorf("missing %q in\n%s", line, b.String())
+		}
+	}
+}
+
+func TestMetricsLabelEscaping(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"fleet", `fleet`},
+		{`C:\fleet`, `C:\\fleet`},
+		{`say "hi"`, `say \"hi\"`},
+		{"two\nlines", `two\nlines`},
+	}
+	for _, tt := range tests {
+		c := newCounterVec("ha_test_total", "測試用", "name", "kind")
+		c.inc(tt.value, "x")
+
+		var b strings.Builder
+		c.write(metricsWriter{&b})
+		want := `ha_test_total{name="` + tt.want + `",kind="x"} 1` + "\n"
+		if !strings.HasSuffix(b.String(), want) {
+			t.Errorf("label %q written as\n%s\nwant %s", tt.value, b.String(), want)
+		}
+		if strings.Count(b.String(), "\n") != 3 {
+			t.Errorf("label %q broke the line format:\n%s", tt.value, b.String())
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"kenmec/ha/jimmy/api"
+	"kenmec/ha/jimmy/config"
+	gen "kenmec/ha/jimmy/protoGen"
+	"log"
+	"strconv"
+	"time"
+)
+
+// 連到另外一台HA的其中一條網路路徑
+type peerPath struct {
+	client   *api.GRPCHAClient
+	lastHb   time.Time // 最後一次從這條路徑收到另外一台的心跳
+	detector *PhiAccrualDetector
+	up       bool
+}
+
+// 對外顯示用的路徑狀態
+type PeerPathStatus struct {
+	Index     int    `json:"index"`
+	Address   string `json:"address"`
+	Connected bool   `json:"connected"`  // 本機送出去的連線是否建立
+	Up        bool   `json:"up"`         // 是否有收到另外一台從這條路徑送來的心跳
+	LastHbAge int64  `json:"last_hb_ms"` // 距離上次心跳幾毫秒
+}
+
+// 每條路徑各自一個偵測器 多條路徑的心跳混在一起會讓間隔分佈失真
+func newPeerPaths(clients []*api.GRPCHAClient, hbInterval time.Duration) []*peerPath {
+	paths := make([]*peerPath, 0, len(clients))
+	for _, c := range clients {
+		paths = append(paths, &peerPath{
+			client:   c,
+			lastHb:   time.Now(),
+			detector: newDetector(hbInterval),
+			up:       false,
+		})
+	}
+	return paths
+}
+
+// 收到某條路徑的心跳
+func (a *Arbiter) onPathHeartbeat(index int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if index < 0 || index >= len(a.peerPaths) {
+		return
+	}
+	now := time.Now()
+	a.metrics.hbInterval.observe(now.Sub(a.peerPaths[index].lastHb).Seconds(), "peer", "path"+strconv.Itoa(index))
+	a.peerPaths[index].lastHb = now
+	a.peerPaths[index].detector.Heartbeat(now, a.hbOtherTimeout)
+}
+
+// 資料同步只走一條路徑 避免另外一台收到重複的資料
+func (a *Arbiter) sendToPeer(msg *gen.StatusRequest) error {
+	msg.SentAt = time.Now().UnixNano()
+	typ := payloadType(msg)
+	err := api.ErrNotConnected
+	attempted := false
+	for _, p := range a.peerPaths {
+		if !p.client.IsConnected() {
+			continue
+		}
+		attempted = true
+		if err = p.client.SendMessage(msg); err == nil {
+			break
+		}
+		a.metrics.sendErrors.inc("peer", typ)
+	}
+	switch {
+	case !attempted:
+		a.metrics.dropped.inc("peer", "not_connected")
+	case err == nil:
+		a.metrics.messages.inc("to_peer", typ)
+	}
+	if isReplication(msg) {
+		a.replication.recordSent(err)
+	}
+	return err
+}
+
+// 心跳則是每一條路徑都送
+func (a *Arbiter) sendHeartbeatToAllPaths() {
+	for _, p := range a.peerPaths {
+		err := p.client.SendMessage(&gen.StatusRequest{
+			Payload: &gen.StatusRequest_Hb{
+				Hb: int32(time.Now().Unix()),
+			},
+		})
+
+		if err != nil {
+			if errors.Is(err, api.ErrNotConnected) {
+				a.metrics.dropped.inc("peer", "not_connected")
+			} else {
+				a.metrics.sendErrors.inc("peer", "hb")
+			}
+			log.Printf("💓 心跳到其他HA %s 發送失敗: %v", p.client.Address(), err)
+		} else {
+			a.metrics.messages.inc("to_peer", "hb")
+		}
+	}
+}
+
+// 依照 phi 或超時判斷每條路徑 回傳還活著的路徑數量
+func (a *Arbiter) updatePeerPaths(timeout time.Duration) int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	alive := 0
+	for i, p := range a.peerPaths {
+		up := heartbeatAlive(p.detector, a.otherPhiThreshold, p.lastHb, timeout)
+		if up != p.up {
+			if up {
+				log.Printf("✅ [網路路徑] 第 %d 條 (%s) 恢復", i, p.client.Address())
+			} else {
+				config.LogWarnf("⚠️  [網路路徑] 第 %d 條 (%s) 已經 %v 沒有心跳", i, p.client.Address(), time.Since(p.lastHb).Round(time.Millisecond))
+				a.metrics.hbTimeouts.inc("peer", "path"+strconv.Itoa(i))
+				a.events.Record(EventHeartbeat, fmt.Sprintf("另外一台第 %d 條路徑心跳超時", i), map[string]any{
+					"source":  "peer_path",
+					"path":    i,
+					"address": p.client.Address(),
+					"age_ms":  time.Since(p.lastHb).Milliseconds(),
+				})
+			}
+		}
+		p.up = up
+
+		if up {
+			alive++
+		}
+	}
+	return alive
+}
+
+func (a *Arbiter) PeerPaths() []PeerPathStatus {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	out := make([]PeerPathStatus, 0, len(a.peerPaths))
+	for i, p := range a.peerPaths {
+		out = append(out, PeerPathStatus{
+			Index:     i,
+			Address:   p.client.Address(),
+			Connected: p.client.IsConnected(),
+			Up:        p.up,
+			LastHbAge: time.Since(p.lastHb).Milliseconds(),
+		})
+	}
+	return out
+}
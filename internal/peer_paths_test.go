@@ -0,0 +1,117 @@
+package internal
+
+import (
+	"errors"
+	"kenmec/ha/jimmy/api"
+	"kenmec/ha/jimmy/config"
+	gen "kenmec/ha/jimmy/protoGen"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+const testPathTimeout = 3 * time.Second
+
+// n 條路徑的仲裁程式 只用固定的 TIMEOUT 判斷 client 不會真的連線
+func newPeerPathArbiter(t *testing.T, n int) *Arbiter {
+	t.Helper()
+	prev := config.Current()
+	t.Cleanup(func() { config.Set(prev) })
+	config.Set(&config.Config{
+		OTHER_HA_HB_INTERVAL:   config.Duration(time.Second),
+		OTHER_HA_HB_TIMEOUT:    config.Duration(testPathTimeout),
+		OTHER_HA_PHI_THRESHOLD: -1,
+		PHI_WINDOW:             100,
+	})
+
+	var clients []*api.GRPCHAClient
+	for i := range n {
+		clients = append(clients, api.NewGRPCClient("127.0.0.1:1", i, "ha-a", insecure.NewCredentials()))
+	}
+	a := NewArbiter(nil, clients, nil, nil)
+	t.Cleanup(a.cancel)
+	return a
+}
+
+func TestUpdatePeerPaths(t *testing.T) {
+	fresh, stale := time.Second, 2*testPathTimeout
+	tests := []struct {
+		name   string
+		ages   []time.Duration // 每條路徑距離上次心跳多久
+		alive  int
+		events int
+	}{
+		{"all paths up", []time.Duration{fresh, fresh}, 2, 0},
+		// 其中一條斷掉 另外一條還有心跳 stream 還算活著
+		{"one path down", []time.Duration{stale, fresh}, 1, 1},
+		{"all paths down", []time.Duration{stale, stale}, 0, 2},
+		{"single path", []time.Duration{fresh}, 1, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newPeerPathArbiter(t, len(tt.ages))
+			// 一開始都當成正常 斷掉的才會記錄事件
+			for i, p := range a.peerPaths {
+				p.up = true
+				p.lastHb = time.Now().Add(-tt.ages[i])
+			}
+
+			if got := a.updatePeerPaths(testPathTimeout); got != tt.alive {
+				t.Errorf("alive paths = %d, want %d", got, tt.alive)
+			}
+			for i, s := range a.PeerPaths() {
+				if want := tt.ages[i] < testPathTimeout; s.Up != want || s.Index != i {
+					t.Errorf("path %d: %+v, want up = %v", i, s, want)
+				}
+			}
+			if n := len(ParseEventFilter(EventHeartbeat).Filter(a.Events().Since(0))); n != tt.events {
+				t.Errorf("got %d heartbeat events, want %d", n, tt.events)
+			}
+		})
+	}
+}
+
+func TestPathHeartbeatRecoversOnlyThatPath(t *testing.T) {
+	a := newPeerPathArbiter(t, 2)
+	for _, p := range a.peerPaths {
+		p.lastHb = time.Now().Add(-2 * testPathTimeout)
+	}
+	if got := a.updatePeerPaths(testPathTimeout); got != 0 {
+		t.Fatalf("alive paths = %d, want 0", got)
+	}
+
+	a.onPathHeartbeat(1)
+	// 不存在的路徑直接忽略
+	a.onPathHeartbeat(2)
+	a.onPathHeartbeat(-1)
+
+	if got := a.updatePeerPaths(testPathTimeout); got != 1 {
+		t.Fatalf("alive paths = %d, want 1", got)
+	}
+	if paths := a.PeerPaths(); paths[0].Up || !paths[1].Up {
+		t.Errorf("paths = %+v, want only path 1 up", paths)
+	}
+}
+
+func TestSendToPeerNotConnected(t *testing.T) {
+	a := newPeerPathArbiter(t, 2)
+
+	err := a.sendToPeer(&gen.StatusRequest{Payload: &gen.StatusRequest_SyncMission{SyncMission: "{}"}})
+	if !errors.Is(err, api.ErrNotConnected) {
+		t.Errorf("err = %v, want ErrNotConnected", err)
+	}
+	// 資料只送一次 沒有路徑可以送只算一次丟棄
+	if n := a.metrics.dropped.values[labelPairs(a.metrics.dropped.labels, []string{"peer", "not_connected"})]; n != 1 {
+		t.Errorf("dropped = %v, want 1", n)
+	}
+
+	// 心跳每條路徑都送 每條各算一次
+	a.sendHeartbeatToAllPaths()
+	if n := a.metrics.dropped.values[labelPairs(a.metrics.dropped.labels, []string{"peer", "not_connected"})]; n != 3 {
+		t.Errorf("dropped = %v after the heartbeats, want 3", n)
+	}
+	if n := len(a.metrics.sendErrors.values); n != 0 {
+		t.Errorf("got %d send error series, want none for paths that are not connected", n)
+	}
+}
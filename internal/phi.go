@@ -0,0 +1,192 @@
+package internal
+
+import (
+	"kenmec/ha/jimmy/config"
+	"math"
+	"sync"
+	"time"
+)
+
+// 監測心跳的頻率 phi 會隨時間連續上升 所以比一秒檢查一次更細
+const detectorTick = 200 * time.Millisecond
+
+// 保留多少筆 phi 歷史給調整門檻用 (detectorTick * 600 = 2 分鐘)
+const phiHistorySize = 600
+
+// PhiAccrualDetector 依照心跳間隔的分佈計算懷疑程度 (phi)
+// phi = 1 代表誤判機率約 10%, phi = 2 約 1%, phi = 3 約 0.1% 依此類推
+// 參考 Hayashibara et al. "The φ Accrual Failure Detector"
+type PhiAccrualDetector struct {
+	mu sync.Mutex
+
+	window    int
+	minStd    time.Duration
+	intervals []float64 // 最近的心跳間隔 (毫秒)
+	next      int
+	last      time.Time
+	primed    bool // 開始或 Restart 之後收到第一個心跳前是 false
+
+	history []PhiSample
+}
+
+type PhiSample struct {
+	At  time.Time `json:"at"`
+	Phi float64   `json:"phi"`
+}
+
+// 對外顯示用的偵測器狀態
+type PhiStatus struct {
+	Phi       float64     `json:"phi"`
+	Threshold float64     `json:"threshold"`
+	Samples   int         `json:"samples"`
+	MeanMs    float64     `json:"mean_ms"`
+	StdDevMs  float64     `json:"stddev_ms"`
+	LastHbAge int64       `json:"last_hb_ms"`
+	History   []PhiSample `json:"history,omitempty"`
+}
+
+// expected 是預期的心跳間隔 在還沒有足夠的樣本前用來估計分佈
+func NewPhiAccrualDetector(window int, minStd time.Duration, expected time.Duration) *PhiAccrualDetector {
+	d := &PhiAccrualDetector{
+		window: window,
+		minStd: minStd,
+		last:   time.Now(),
+	}
+
+	// 先放兩個樣本 平均是 expected 標準差是 expected/4
+	mean := float64(expected.Milliseconds())
+	d.record(mean - mean/4)
+	d.record(mean + mean/4)
+	return d
+}
+
+func (d *PhiAccrualDetector) record(interval float64) {
+	if len(d.intervals) < d.window {
+		d.intervals = append(d.intervals, interval)
+		return
+	}
+	d.intervals[d.next] = interval
+	d.next = (d.next + 1) % d.window
+}
+
+// Heartbeat 記錄一次心跳 開始或 Restart 之後的第一個心跳只當成起點 不算樣本
+// 間隔最多記成 maxInterval (心跳超時) 斷線的空白會拉高平均 之後要很久才偵測得到斷線
+func (d *PhiAccrualDetector) Heartbeat(now time.Time, maxInterval time.Duration) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.primed {
+		interval := now.Sub(d.last)
+		if maxInterval > 0 {
+			interval = min(interval, maxInterval)
+		}
+		d.record(float64(interval.Milliseconds()))
+	}
+	d.primed = true
+	d.last = now
+}
+
+// Restart 在重新連線時呼叫 下一個心跳只當成起點
+func (d *PhiAccrualDetector) Restart() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.primed = false
+}
+
+func (d *PhiAccrualDetector) stats() (mean, std float64) {
+	for _, v := range d.intervals {
+		mean += v
+	}
+	mean /= float64(len(d.intervals))
+
+	for _, v := range d.intervals {
+		std += (v - mean) * (v - mean)
+	}
+	std = math.Sqrt(std / float64(len(d.intervals)))
+
+	return mean, math.Max(std, float64(d.minStd.Milliseconds()))
+}
+
+func (d *PhiAccrualDetector) phi(now time.Time) float64 {
+	mean, std := d.stats()
+	elapsed := float64(now.Sub(d.last).Milliseconds())
+
+	// 常態分佈 CDF 的 logistic 近似: phi = -log10(1 - CDF) = log10(1 + exp(a))
+	// a 很大時 exp 會溢位 直接用 a/ln(10)
+	y := (elapsed - mean) / std
+	a := y * (1.5976 + 0.070566*y*y)
+	if a > 30 {
+		return a / math.Ln10
+	}
+	return math.Log10(1 + math.Exp(a))
+}
+
+// Phi 計算目前的懷疑程度 並記錄到歷史
+func (d *PhiAccrualDetector) Phi(now time.Time) float64 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	phi := d.phi(now)
+	if len(d.history) >= phiHistorySize {
+		d.history = d.history[1:]
+	}
+	d.history = append(d.history, PhiSample{At: now, Phi: phi})
+	return phi
+}
+
+func (d *PhiAccrualDetector) Status(threshold float64, withHistory bool) PhiStatus {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := time.Now()
+	mean, std := d.stats()
+	status := PhiStatus{
+		Phi:       d.phi(now),
+		Threshold: threshold,
+		Samples:   len(d.intervals),
+		MeanMs:    mean,
+		StdDevMs:  std,
+		LastHbAge: now.Sub(d.last).Milliseconds(),
+	}
+	if withHistory {
+		status.History = append([]PhiSample(nil), d.history...)
+	}
+	return status
+}
+
+func newDetector(expected time.Duration) *PhiAccrualDetector {
+	minStd := time.Duration(config.Current().PHI_MIN_STD_MS) * time.Millisecond
+	return NewPhiAccrualDetector(config.Current().PHI_WINDOW, minStd, expected)
+}
+
+// 超過固定的超時一定判定中斷 門檻大於 0 時 phi 超過門檻也算中斷 兩種情況都會記錄 phi 歷史
+func heartbeatAlive(d *PhiAccrualDetector, threshold float64, last time.Time, timeout time.Duration) bool {
+	phi := d.Phi(time.Now())
+	// 固定的 TIMEOUT 是上限 phi 只會讓判定提早
+	if time.Since(last) > timeout {
+		return false
+	}
+	return threshold <= 0 || phi <= threshold
+}
+
+// 每個交管以及每條HA路徑的偵測器狀態
+type DetectorStatus struct {
+	Fleets    map[string]PhiStatus `json:"fleets"`
+	PeerPaths []PhiStatus          `json:"peer_paths"`
+}
+
+func (a *Arbiter) DetectorStatus(withHistory bool) DetectorStatus {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	status := DetectorStatus{
+		Fleets: map[string]PhiStatus{},
+	}
+	for _, f := range a.fleets {
+		status.Fleets[f.name] = f.detector.Status(a.fleetPhiThreshold, withHistory)
+	}
+	for _, p := range a.peerPaths {
+		status.PeerPaths = append(status.PeerPaths, p.detector.Status(a.otherPhiThreshold, withHistory))
+	}
+	return status
+}
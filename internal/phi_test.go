@@ -0,0 +1,144 @@
+package internal
+
+import (
+	"testing"
+	"time"
+)
+
+// 從 start 開始每 interval 送 n 個心跳 回傳最後一個心跳的時間
+func beat(d *PhiAccrualDetector, start time.Time, interval time.Duration, n int, maxInterval time.Duration) time.Time {
+	now := start
+	for i := 0; i < n; i++ {
+		now = now.Add(interval)
+		d.Heartbeat(now, maxInterval)
+	}
+	return now
+}
+
+func TestPhiRisesWithSilence(t *testing.T) {
+	d := NewPhiAccrualDetector(100, 100*time.Millisecond, time.Second)
+	last := beat(d, time.Now(), time.Second, 30, 3*time.Second)
+
+	prev := -1.0
+	for _, elapsed := range []time.Duration{0, 500 * time.Millisecond, time.Second, 2 * time.Second, 3 * time.Second} {
+		phi := d.Phi(last.Add(elapsed))
+		if phi < prev {
+			t.Fatalf("phi went down from %.2f to %.2f at %v", prev, phi, elapsed)
+		}
+		prev = phi
+	}
+	if phi := d.Phi(last.Add(500 * time.Millisecond)); phi > 1 {
+		t.Errorf("phi half an interval after a heartbeat = %.2f, want <= 1", phi)
+	}
+	if phi := d.Phi(last.Add(3 * time.Second)); phi < 8 {
+		t.Errorf("phi after 3 missed heartbeats = %.2f, want >= 8", phi)
+	}
+}
+
+func TestPhiSkipsFirstHeartbeat(t *testing.T) {
+	start := time.Now()
+	d := NewPhiAccrualDetector(100, 100*time.Millisecond, time.Second)
+
+	// 啟動 30 秒後才收到第一個心跳 這段空白不算樣本
+	d.Heartbeat(start.Add(30*time.Second), 3*time.Second)
+	status := d.Status(8, false)
+	if status.Samples != 2 {
+		t.Fatalf("samples after the first heartbeat = %d, want the 2 seeded samples", status.Samples)
+	}
+	if status.MeanMs != 1000 {
+		t.Errorf("mean = %.0fms, want 1000ms", status.MeanMs)
+	}
+
+	d.Heartbeat(start.Add(31*time.Second), 3*time.Second)
+	if got := d.Status(8, false).Samples; got != 3 {
+		t.Errorf("samples after the second heartbeat = %d, want 3", got)
+	}
+}
+
+func TestPhiRestartSkipsReconnectGap(t *testing.T) {
+	d := NewPhiAccrualDetector(100, 100*time.Millisecond, time.Second)
+	last := beat(d, time.Now(), time.Second, 10, 0)
+	before := d.Status(8, false)
+
+	// 重新連線後的第一個心跳只當成起點 即使沒有上限也不會記錄 30 秒的間隔
+	d.Restart()
+	d.Heartbeat(last.Add(30*time.Second), 0)
+	after := d.Status(8, false)
+	if after.Samples != before.Samples || after.MeanMs != before.MeanMs {
+		t.Errorf("reconnect gap was recorded: samples %d -> %d, mean %.0f -> %.0f",
+			before.Samples, after.Samples, before.MeanMs, after.MeanMs)
+	}
+}
+
+func TestPhiCapsOutageInterval(t *testing.T) {
+	const timeout = 3 * time.Second
+	start := time.Now()
+
+	capped := NewPhiAccrualDetector(100, 100*time.Millisecond, time.Second)
+	uncapped := NewPhiAccrualDetector(100, 100*time.Millisecond, time.Second)
+	for _, d := range []*PhiAccrualDetector{capped, uncapped} {
+		limit := timeout
+		if d == uncapped {
+			limit = 0
+		}
+		last := beat(d, start, time.Second, 20, limit)
+		// 斷線 30 秒後恢復 再正常送幾個心跳
+		d.Heartbeat(last.Add(30*time.Second), limit)
+		beat(d, last.Add(30*time.Second), time.Second, 5, limit)
+	}
+
+	last := start.Add(20*time.Second + 30*time.Second + 5*time.Second)
+	if mean := capped.Status(8, false).MeanMs; mean > 1200 {
+		t.Errorf("capped mean = %.0fms, want close to 1000ms", mean)
+	}
+	// 第二次斷線 5 秒後應該要偵測到
+	if phi := capped.Phi(last.Add(5 * time.Second)); phi < 8 {
+		t.Errorf("capped phi 5s into the second outage = %.2f, want >= 8", phi)
+	}
+	if phi := uncapped.Phi(last.Add(5 * time.Second)); phi >= 8 {
+		t.Errorf("uncapped phi = %.2f, expected the 30s gap to hide the outage", phi)
+	}
+}
+
+func TestHeartbeatAliveTimeoutIsUpperBound(t *testing.T) {
+	const timeout = 3 * time.Second
+	tests := []struct {
+		name      string
+		threshold float64
+		// 最後一個心跳之後過了多久 以及之前的心跳是否很不穩定
+		since   time.Duration
+		jittery bool
+		want    bool
+	}{
+		{"phi below threshold", 8, 500 * time.Millisecond, false, true},
+		{"phi above threshold before timeout", 8, 2500 * time.Millisecond, false, false},
+		// 心跳很不穩定 phi 一直很低 超過 TIMEOUT 還是要判定中斷
+		{"low phi after timeout", 8, 3500 * time.Millisecond, true, false},
+		{"disabled before timeout", -1, 2500 * time.Millisecond, false, true},
+		{"disabled after timeout", -1, 3500 * time.Millisecond, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := NewPhiAccrualDetector(100, 100*time.Millisecond, time.Second)
+			now := time.Now()
+			last := now.Add(-tt.since)
+			if tt.jittery {
+				// 間隔在 0.2 秒跟 2 秒之間跳 最後一個心跳剛好在 last
+				at := last.Add(-33 * time.Second)
+				for i := range 30 {
+					at = at.Add(time.Duration(200+i%2*1800) * time.Millisecond)
+					d.Heartbeat(at, 10*time.Second)
+				}
+			} else {
+				beat(d, last.Add(-30*time.Second), time.Second, 30, timeout)
+			}
+
+			if got := heartbeatAlive(d, tt.threshold, last, timeout); got != tt.want {
+				t.Errorf("alive = %v, want %v (phi %.2f)", got, tt.want, d.Phi(now))
+			}
+			if tt.jittery && d.Phi(now) > tt.threshold {
+				t.Fatalf("phi = %.2f, want it below the threshold so only the timeout decides", d.Phi(now))
+			}
+		})
+	}
+}
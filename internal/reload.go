@@ -0,0 +1,170 @@
+package internal
+
+import (
+	"kenmec/ha/jimmy/config"
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// 多久檢查一次設定檔有沒有被修改
+const configWatchInterval = 2 * time.Second
+
+// 一次重新載入的結果 也會記錄在事件裡
+type ReloadResult struct {
+	Trigger string          `json:"trigger"` // sighup / file / api
+	OK      bool            `json:"ok"`
+	Error   string          `json:"error,omitempty"`
+	Applied []config.Change `json:"applied"`
+	Refused []config.Change `json:"refused"` // 需要重開程式才會生效的變更
+}
+
+// 重新載入設定用 同一時間只會有一個在跑
+type configReloader struct {
+	mu      sync.Mutex
+	path    string
+	modTime time.Time
+	size    int64
+}
+
+func (r *configReloader) changed() bool {
+	info, err := os.Stat(r.path)
+	if err != nil {
+		return false
+	}
+	changed := !info.ModTime().Equal(r.modTime) || info.Size() != r.size
+	r.modTime = info.ModTime()
+	r.size = info.Size()
+	return changed
+}
+
+// StartConfigReload 收到 SIGHUP 或設定檔被修改時重新載入設定
+func (a *Arbiter) StartConfigReload(path string) {
+	a.reloader.mu.Lock()
+	a.reloader.path = path
+	a.reloader.changed()
+	a.reloader.mu.Unlock()
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	ticker := time.NewTicker(configWatchInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-a.ctx.Done():
+			return
+		case <-hup:
+			a.ReloadConfig("sighup")
+		case <-ticker.C:
+			a.reloader.mu.Lock()
+			changed := a.reloader.changed()
+			a.reloader.mu.Unlock()
+			if changed {
+				a.ReloadConfig("file")
+			}
+		}
+	}
+}
+
+// ReloadConfig 重新讀取設定檔 只套用可以在執行中修改的欄位
+// 其他欄位 (listen port、VIP 等) 有變動時保留原本的值 並提示需要重開程式
+func (a *Arbiter) ReloadConfig(trigger string) ReloadResult {
+	a.reloader.mu.Lock()
+	defer a.reloader.mu.Unlock()
+
+	result := ReloadResult{Trigger: trigger}
+	defer func() {
+		message := "重新載入設定"
+		if !result.OK {
+			message = "重新載入設定失敗"
+		}
+		a.events.Record(EventConfigReload, message, result)
+	}()
+
+	next, err := config.Load(a.reloader.path)
+	if err != nil {
+		result.Error = err.Error()
+		config.LogErrorf("❌ [設定重載] %s 有錯誤 維持原本的設定:\n%v", a.reloader.path, err)
+		return result
+	}
+
+	old := config.Current()
+	for _, c := range config.Diff(old, next) {
+		if c.Live {
+			result.Applied = append(result.Applied, c)
+		} else {
+			result.Refused = append(result.Refused, c)
+		}
+	}
+
+	merged := config.MergeLive(old, next)
+	if errs := merged.Validate(); len(errs) > 0 {
+		result.Error = errs[0].Error()
+		config.LogErrorf("❌ [設定重載] 可以套用的變更跟目前的設定不相容 維持原本的設定: %v", errs[0])
+		return result
+	}
+
+	config.Set(merged)
+	a.applyLiveConfig(merged)
+	result.OK = true
+
+	for _, c := range result.Applied {
+		log.Printf("🔧 [設定重載] 套用 %s", c)
+	}
+	for _, c := range result.Refused {
+		config.LogWarnf("⚠️  [設定重載] %s 需要重開程式才會生效 這次不套用", c)
+	}
+	if len(result.Applied) == 0 && len(result.Refused) == 0 {
+		log.Printf("🔧 [設定重載] 設定沒有變動")
+	}
+	return result
+}
+
+// 把新的設定套用到執行中的狀態 ticker 會在下一次觸發時改用新的間隔
+func (a *Arbiter) applyLiveConfig(cfg *config.Config) {
+	config.SetLogLevel(cfg.LOG_LEVEL)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.hbFleetTimeout = cfg.FLEET_HB_TIMEOUT.Duration()
+	a.hbOtherTimeout = cfg.OTHER_HA_HB_TIMEOUT.Duration()
+	a.fleetPhiThreshold = cfg.FLEET_PHI_THRESHOLD
+	a.otherPhiThreshold = cfg.OTHER_HA_PHI_THRESHOLD
+	a.fleetRule = newFleetHealthRule(len(a.fleets))
+
+	for _, f := range a.fleets {
+		// 關掉的檢查不能再讓交管被判定為異常
+		if !cfg.FLEET_HEALTH_CHECK {
+			f.serving = true
+		}
+		if cfg.FLEET_PROBE_INTERVAL <= 0 {
+			f.processing = true
+		}
+		if !f.probe.enabled && cfg.FLEET_PROBE_INTERVAL > 0 {
+			// 剛打開 從現在開始等 echo
+			f.probe.lastEchoAt = time.Now()
+		}
+		f.probe.enabled = cfg.FLEET_PROBE_INTERVAL > 0
+		f.probe.timeout = cfg.FLEET_PROBE_TIMEOUT.Duration()
+	}
+	a.updateFleetConnectivityLocked()
+}
+
+// 設定重新載入後間隔有變 就重設 ticker
+// 間隔是 0 (功能關閉) 時改成每秒檢查一次 等功能被打開
+func retick(ticker *time.Ticker, current *time.Duration, want time.Duration) {
+	if want <= 0 {
+		want = time.Second
+	}
+	if want != *current {
+		*current = want
+		ticker.Reset(want)
+	}
+}
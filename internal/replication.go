@@ -0,0 +1,118 @@
+package internal
+
+import (
+	gen "kenmec/ha/jimmy/protoGen"
+	"sync"
+	"time"
+)
+
+// 平均延遲的平滑係數 越大越看重最近的資料
+const replicationLagAlpha = 0.2
+
+// 跟另外一台之間資料同步 (任務、貨物、車輛狀態) 的統計
+// 有自己的鎖 sendToPeer 可能在拿著 Arbiter.mu 時被呼叫
+type replicationStats struct {
+	mu sync.Mutex
+
+	sent         uint64
+	failed       uint64
+	received     uint64
+	lastSent     time.Time
+	lastReceived time.Time
+
+	// 另外一台送出到本機收到的時間 依賴兩台的時鐘同步
+	lagSamples uint64
+	lastLag    time.Duration
+	avgLag     float64 // 毫秒
+	maxLag     time.Duration
+}
+
+// 只有交管的資料算同步 心跳、角色、設定比對不算
+func isReplication(msg *gen.StatusRequest) bool {
+	switch msg.Payload.(type) {
+	case *gen.StatusRequest_SyncMission,
+		*gen.StatusRequest_AgvWorkStatus,
+		*gen.StatusRequest_MissionReport,
+		*gen.StatusRequest_UpdateCargoInfo,
+		*gen.StatusRequest_SaveCargoInfo,
+		*gen.StatusRequest_UpdateAmrCargoInfo,
+		*gen.StatusRequest_MissionAssign,
+		*gen.StatusRequest_BookBlock,
+		*gen.StatusRequest_SyncAllMission,
+		*gen.StatusRequest_SyncAllDbCargo,
+		*gen.StatusRequest_SyncAllMemoryCargo:
+		return true
+	}
+	return false
+}
+
+func (r *replicationStats) recordSent(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err != nil {
+		r.failed++
+		return
+	}
+	r.sent++
+	r.lastSent = time.Now()
+}
+
+// sentAt 為 0 代表另外一台是舊版 沒有帶送出時間
+func (r *replicationStats) recordReceived(sentAt int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	r.received++
+	r.lastReceived = now
+	if sentAt == 0 {
+		return
+	}
+
+	lag := max(now.Sub(time.Unix(0, sentAt)), 0)
+	r.lagSamples++
+	r.lastLag = lag
+	r.maxLag = max(r.maxLag, lag)
+	ms := float64(lag.Microseconds()) / 1000
+	if r.lagSamples == 1 {
+		r.avgLag = ms
+	} else {
+		r.avgLag += replicationLagAlpha * (ms - r.avgLag)
+	}
+}
+
+// 對外顯示用的同步統計 時間是距離現在幾毫秒 還沒發生時是 -1
+type ReplicationStatus struct {
+	Sent           uint64 `json:"sent"`
+	Failed         uint64 `json:"failed"` // 所有路徑都送不出去的次數
+	Received       uint64 `json:"received"`
+	LastSentAge    int64  `json:"last_sent_ms"`
+	LastReceiveAge int64  `json:"last_received_ms"`
+	// 最後一筆從另外一台送出到本機收到的時間 單向的 兩台的時鐘差會直接算進去
+	LagMs    float64 `json:"lag_ms"`
+	AvgLagMs float64 `json:"avg_lag_ms"`
+	MaxLagMs float64 `json:"max_lag_ms"`
+}
+
+func (r *replicationStats) status() ReplicationStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	age := func(t time.Time) int64 {
+		if t.IsZero() {
+			return -1
+		}
+		return time.Since(t).Milliseconds()
+	}
+	return ReplicationStatus{
+		Sent:           r.sent,
+		Failed:         r.failed,
+		Received:       r.received,
+		LastSentAge:    age(r.lastSent),
+		LastReceiveAge: age(r.lastReceived),
+		LagMs:          float64(r.lastLag.Microseconds()) / 1000,
+		AvgLagMs:       r.avgLag,
+		MaxLagMs:       float64(r.maxLag.Microseconds()) / 1000,
+	}
+}
@@ -1,8 +1,10 @@
 package internal
 
 import (
+	"fmt"
 	"kenmec/ha/jimmy/config"
 	"net/http"
+	"strconv"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
@@ -16,53 +18,262 @@ import (
 // 這種感覺就會更強烈
 
 func StartRestWebApi(arbiter *Arbiter) {
+	cfg := config.Current()
+	r := newRestRouter(arbiter, cfg)
+
+	if cfg.API_AUTH.UNIX_SOCKET != "" {
+		go serveUnixSocket(cfg.API_AUTH.UNIX_SOCKET, r)
+	}
+
+	r.Run(":" + cfg.WEB_API_PORT)
+}
+
+// 所有的 REST API 以及 dashboard
+func newRestRouter(arbiter *Arbiter, cfg *config.Config) *gin.Engine {
+	auth := newAPIAuth(cfg.API_AUTH)
+
 	r := gin.Default()
-	r.Use(cors.Default())
+	r.Use(auth.audit())
+	if len(cfg.API_AUTH.CORS_ORIGINS) > 0 {
+		r.Use(cors.New(cors.Config{
+			AllowOrigins: cfg.API_AUTH.CORS_ORIGINS,
+			AllowMethods: []string{http.MethodGet, http.MethodPost},
+			AllowHeaders: []string{"Authorization", "Content-Type"},
+		}))
+	}
+
+	// 查詢類 API
+	read := r.Group("/", auth.require(scopeRead))
+	// 會改變狀態的 API
+	operate := r.Group("/", auth.require(scopeOperator), auth.localOnly())
 
+	// 跟 /health/failover 一樣 keepalived 的 chk_server_health.sh 用 異常時回 500 跟以前一樣
 	r.GET("/health", func(ctx *gin.Context) {
-		arbiter.mu.RLock()
-		defer arbiter.mu.RUnlock()
+		result, _ := arbiter.Health(HealthFailover)
+		if !result.OK {
+			ctx.JSON(http.StatusInternalServerError, result)
+			return
+		}
+		ctx.JSON(http.StatusOK, result)
+	})
 
-		if arbiter.Maintenance {
-			ctx.JSON(http.StatusInternalServerError, gin.H{
-				"status": "維修此機器中",
-			})
+	// 依照設定檔 HEALTH 的規則 異常時回 503 並列出哪一項從什麼時候開始失敗
+	for _, policy := range []string{HealthLive, HealthReady, HealthFailover} {
+		r.GET("/health/"+policy, func(ctx *gin.Context) {
+			result, _ := arbiter.Health(policy)
+			if !result.OK {
+				ctx.JSON(http.StatusServiceUnavailable, result)
+				return
+			}
+			ctx.JSON(http.StatusOK, result)
+		})
+	}
+
+	// 完整的狀態 角色、連線、心跳、gRPC 連線以及版本
+	read.GET("/status", func(ctx *gin.Context) {
+		ctx.JSON(http.StatusOK, arbiter.Status())
+	})
+
+	// Prometheus metrics
+	read.GET("/metrics", func(ctx *gin.Context) {
+		ctx.Header("Content-Type", metricsContentType)
+		arbiter.WriteMetrics(ctx.Writer)
+	})
+
+	// 另外一台的 /status 給 dashboard 並排顯示 用 PEER_TOKEN 向另外一台查
+	read.GET("/peer/status", func(ctx *gin.Context) {
+		code, body, err := arbiter.PeerStatus(ctx.Request.Context())
+		if err != nil {
+			ctx.JSON(http.StatusBadGateway, gin.H{"status": err.Error()})
+			return
 		}
+		ctx.Data(code, "application/json; charset=utf-8", body)
+	})
 
-		if arbiter.Self.ECS && arbiter.Self.Fleet {
-			ctx.JSON(http.StatusOK, gin.H{
-				"status": "ok",
-			})
-		} else {
-			ctx.JSON(http.StatusInternalServerError, gin.H{
-				"status": "not ok",
-				"ecs":    arbiter.Self.ECS,
-				"fleet":  arbiter.Self.Fleet,
-			})
+	read.GET("/config/consistency", func(ctx *gin.Context) {
+		check := arbiter.ConfigConsistency()
+
+		ctx.JSON(http.StatusOK, gin.H{
+			"consistent": check.Consistent(),
+			"peer_seen":  check.PeerSeen,
+			"checked_at": check.CheckedAt,
+			"mismatches": check.Mismatches,
+		})
+	})
+
+	// 每條網路路徑的狀態 部分路徑斷掉時 degraded 為 true
+	read.GET("/peer/paths", func(ctx *gin.Context) {
+		paths := arbiter.PeerPaths()
+
+		up := 0
+		for _, p := range paths {
+			if p.Up {
+				up++
+			}
+		}
+
+		ctx.JSON(http.StatusOK, gin.H{
+			"paths":    paths,
+			"up":       up,
+			"degraded": up > 0 && up < len(paths),
+		})
+	})
+
+	// 另外一台連進來的連線 以及被拒絕的次數
+	read.GET("/peer/clients", func(ctx *gin.Context) {
+		ctx.JSON(http.StatusOK, gin.H{
+			"clients":  arbiter.otherHaServer.Clients(),
+			"rejected": arbiter.otherHaServer.RejectedCount(),
+		})
+	})
+
+	// 另外一台是活著 / stream 卡住 / 整台不見
+	read.GET("/peer/liveness", func(ctx *gin.Context) {
+		ctx.JSON(http.StatusOK, arbiter.PeerLiveness())
+	})
+
+	// 每個本機交管的狀態 以及合併的規則
+	read.GET("/fleets", func(ctx *gin.Context) {
+		ctx.JSON(http.StatusOK, arbiter.FleetsStatus())
+	})
+
+	// 交管 echo 探測的來回時間
+	read.GET("/fleet/probe", func(ctx *gin.Context) {
+		ctx.JSON(http.StatusOK, arbiter.FleetProbeStatus())
+	})
+
+	// phi accrual 偵測器目前的數值 history=true 會附上最近兩分鐘的 phi
+	read.GET("/detector", func(ctx *gin.Context) {
+		ctx.JSON(http.StatusOK, arbiter.DetectorStatus(ctx.Query("history") == "true"))
+	})
+
+	// 事件紀錄 since=<seq> 只回傳之後的事件 type=role,peer 只回傳這些種類
+	read.GET("/events", func(ctx *gin.Context) {
+		since, _ := strconv.ParseUint(ctx.Query("since"), 10, 64)
+		filter := ParseEventFilter(ctx.Query("type"))
+		ctx.JSON(http.StatusOK, filter.Filter(arbiter.Events().Since(since)))
+	})
+
+	// 即時的事件串流 (Server-Sent Events)
+	read.GET("/events/stream", func(ctx *gin.Context) {
+		streamEvents(ctx, arbiter.Events())
+	})
+
+	// 重新載入設定檔 跟 SIGHUP 一樣
+	operate.POST("/config/reload", func(ctx *gin.Context) {
+		result := arbiter.ReloadConfig("api")
+		if !result.OK {
+			ctx.JSON(http.StatusUnprocessableEntity, result)
+			return
 		}
+		ctx.JSON(http.StatusOK, result)
+	})
 
+	// 每個服務 (VRRP instance) 的健康狀態 給 keepalived 的 track_script 用
+	r.GET("/health/service/:name", func(ctx *gin.Context) {
+		health, ok := arbiter.ServiceHealth(ctx.Param("name"))
+		if !ok {
+			ctx.JSON(http.StatusNotFound, gin.H{"status": "找不到服務 " + ctx.Param("name")})
+			return
+		}
+		if !health.OK {
+			ctx.JSON(http.StatusServiceUnavailable, health)
+			return
+		}
+		ctx.JSON(http.StatusOK, health)
 	})
 
-	r.POST("role_change", func(ctx *gin.Context) {
+	// 依賴的服務 給 keepalived 的 track_script 用 異常時回 503
+	r.GET("/health/:name", func(ctx *gin.Context) {
+		status, ok := arbiter.Dependency(ctx.Param("name"))
+		if !ok {
+			ctx.JSON(http.StatusNotFound, gin.H{"status": "找不到依賴 " + ctx.Param("name")})
+			return
+		}
+		if !status.Up {
+			ctx.JSON(http.StatusServiceUnavailable, status)
+			return
+		}
+		ctx.JSON(http.StatusOK, status)
+	})
+
+	read.GET("/dependencies", func(ctx *gin.Context) {
+		ctx.JSON(http.StatusOK, arbiter.Dependencies())
+	})
+
+	// 每個 VIP 在哪一台 split 代表 VIP 分散在兩台
+	read.GET("/roles", func(ctx *gin.Context) {
+		ctx.JSON(http.StatusOK, arbiter.VipRoles())
+	})
+
+	// 為什麼是目前的角色 以及之前的決策過程 instance 空白代表交管跟著的 instance all=true 回傳全部的決策
+	read.GET("/explain", func(ctx *gin.Context) {
+		explanation, err := arbiter.Explain(ctx.Query("instance"), ctx.Query("all") == "true")
+		if err != nil {
+			ctx.JSON(http.StatusNotFound, gin.H{"status": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusOK, explanation)
+	})
+
+	// 舊版的 notify 腳本呼叫 instance 空白代表交管跟著的 instance
+	operate.POST("/role_change", func(ctx *gin.Context) {
 		role := ctx.Query("role")
+		instance := ctx.Query("instance")
 
-		if role == "MASTER" {
-			arbiter.UpdateMaster(true)
-		} else {
-			arbiter.UpdateMaster(false)
+		cause := DecisionCause{Source: CauseRoleChange, Detail: fmt.Sprintf("role=%s instance=%s", role, instance)}
+		if err := arbiter.UpdateRole(instance, role == "MASTER", cause); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"status": err.Error(),
+			})
+			return
 		}
 		ctx.JSON(http.StatusOK, gin.H{
-			"status": "ok",
-			"role":   role,
+			"status":   "ok",
+			"role":     role,
+			"instance": instance,
 		})
 	})
 
-	r.GET("/maintenance", func(ctx *gin.Context) {
-		enable := ctx.Query("enable") == "true"
+	// keepalived 的 notify 腳本呼叫 帶完整的 TYPE NAME STATE PRIORITY
+	operate.POST("/keepalived/notify", func(ctx *gin.Context) {
+		priority, _ := strconv.Atoi(ctx.Query("priority"))
+		n := KeepalivedNotification{
+			Type:     ctx.Query("type"),
+			Name:     ctx.Query("name"),
+			State:    ctx.Query("state"),
+			Priority: priority,
+			Source:   "api",
+		}
+		if err := arbiter.HandleKeepalivedNotify(n); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"status": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{"status": "ok"})
+	})
+
+	read.GET("/maintenance", func(ctx *gin.Context) {
+		// 以前用 GET /maintenance?enable=true 切換 舊的腳本要明確失敗 不能當成查詢
+		if _, ok := ctx.GetQuery("enable"); ok {
+			ctx.Header("Allow", http.MethodPost)
+			ctx.JSON(http.StatusMethodNotAllowed, gin.H{
+				"status": "請改用 POST /maintenance?enable=true|false",
+			})
+			return
+		}
+
+		arbiter.mu.RLock()
+		enable := arbiter.Maintenance
+		arbiter.mu.RUnlock()
 
-		arbiter.mu.Lock()
-		arbiter.Maintenance = enable
-		arbiter.mu.Unlock()
+		ctx.JSON(http.StatusOK, gin.H{
+			"enable": enable,
+		})
+	})
+
+	operate.POST("/maintenance", func(ctx *gin.Context) {
+		enable := ctx.Query("enable") == "true"
+		arbiter.SetMaintenance(enable, ctx.GetString(principalKey))
 
 		ctx.JSON(http.StatusOK, gin.H{
 			"status": "ok",
@@ -71,5 +282,17 @@ func StartRestWebApi(arbiter *Arbiter) {
 
 	})
 
-	r.Run(":" + config.Cfg.WEB_API_PORT)
+	// 手動把 VIP 切到另外一台 (本機進入維修模式) force=true 跳過另外一台的檢查
+	operate.POST("/switchover", func(ctx *gin.Context) {
+		if err := arbiter.Switchover(ctx.GetString(principalKey), ctx.Query("force") == "true"); err != nil {
+			ctx.JSON(http.StatusConflict, gin.H{"status": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{"status": "ok"})
+	})
+
+	// 網頁版的 dashboard
+	registerDashboard(r)
+
+	return r
 }
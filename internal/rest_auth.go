@@ -0,0 +1,207 @@
+package internal
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"kenmec/ha/jimmy/config"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// API 權限等級
+type apiScope int
+
+const (
+	scopeNone apiScope = iota
+	scopeRead
+	scopeOperator
+)
+
+func (s apiScope) String() string {
+	switch s {
+	case scopeRead:
+		return "read"
+	case scopeOperator:
+		return "operator"
+	default:
+		return "none"
+	}
+}
+
+type unixSocketKey struct{}
+
+const (
+	principalKey = "principal"
+	scopeKey     = "scope"
+)
+
+type apiAuth struct {
+	cfg     config.APIAuthConfig
+	enabled bool
+}
+
+func newAPIAuth(cfg config.APIAuthConfig) *apiAuth {
+	enabled := len(cfg.READ_TOKENS) > 0 || len(cfg.OPERATOR_TOKENS) > 0
+	if !enabled {
+		config.LogWarnf("⚠️  REST API 沒有設定任何 token 只有本機可以變更狀態 其他人只能查詢")
+	}
+	return &apiAuth{cfg: cfg, enabled: enabled}
+}
+
+func isUnixSocketRequest(r *http.Request) bool {
+	v, _ := r.Context().Value(unixSocketKey{}).(bool)
+	return v
+}
+
+func isLoopbackRequest(r *http.Request) bool {
+	if isUnixSocketRequest(r) {
+		return true
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+func matchToken(tokens []string, token string) (int, bool) {
+	for i, t := range tokens {
+		if subtle.ConstantTimeCompare([]byte(t), []byte(token)) == 1 {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// 從請求判斷呼叫者以及權限 principal 只用在稽核紀錄 不會記錄 token 本身
+func (a *apiAuth) identify(r *http.Request) (string, apiScope) {
+	if isUnixSocketRequest(r) {
+		return "unix-socket", scopeOperator
+	}
+	if !a.enabled {
+		// 沒有 token 時只有本機可以變更狀態 遠端只能查詢
+		if isLoopbackRequest(r) {
+			return "anonymous", scopeOperator
+		}
+		return "anonymous", scopeRead
+	}
+
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		return "anonymous", scopeNone
+	}
+	if i, ok := matchToken(a.cfg.OPERATOR_TOKENS, token); ok {
+		return fmt.Sprintf("operator#%d", i+1), scopeOperator
+	}
+	if i, ok := matchToken(a.cfg.READ_TOKENS, token); ok {
+		return fmt.Sprintf("read#%d", i+1), scopeRead
+	}
+	if a.cfg.PEER_TOKEN != "" && subtle.ConstantTimeCompare([]byte(a.cfg.PEER_TOKEN), []byte(token)) == 1 {
+		return "peer", scopeRead
+	}
+	return "invalid-token", scopeNone
+}
+
+// 會被定時呼叫的 API 成功時不寫稽核紀錄 不然日誌都是 keepalived 以及 Prometheus 的請求
+func quietAuditPath(path string) bool {
+	return path == "/health" || strings.HasPrefix(path, "/health/") ||
+		path == "/metrics" || path == "/events" || path == "/events/stream"
+}
+
+// 每個請求都要經過 記錄呼叫者 並寫稽核紀錄
+func (a *apiAuth) audit() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		start := time.Now()
+		principal, scope := a.identify(ctx.Request)
+		ctx.Set(principalKey, principal)
+		ctx.Set(scopeKey, scope)
+
+		ctx.Next()
+
+		status := ctx.Writer.Status()
+		if quietAuditPath(ctx.Request.URL.Path) && status != http.StatusUnauthorized && status != http.StatusForbidden {
+			return
+		}
+		source := ctx.Request.RemoteAddr
+		if isUnixSocketRequest(ctx.Request) {
+			source = "unix"
+		}
+		log.Printf("📝 [AUDIT] %s %s from=%s principal=%s status=%d (%v)",
+			ctx.Request.Method, ctx.Request.URL.RequestURI(),
+			source, principal, status, time.Since(start).Round(time.Microsecond))
+	}
+}
+
+// 需要某個權限以上才能呼叫
+func (a *apiAuth) require(scope apiScope) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		got, _ := ctx.Get(scopeKey)
+		if got.(apiScope) >= scope {
+			ctx.Next()
+			return
+		}
+
+		if got.(apiScope) == scopeNone {
+			ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"status": "unauthorized",
+			})
+			return
+		}
+		ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+			"status":   "forbidden",
+			"required": scope.String(),
+		})
+	}
+}
+
+// 變更狀態的 API 設定 LOCAL_ONLY_MUTATIONS 時只接受本機來的請求
+func (a *apiAuth) localOnly() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if a.cfg.LOCAL_ONLY_MUTATIONS && !isLoopbackRequest(ctx.Request) {
+			ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"status": "only allowed from loopback or unix socket",
+			})
+			return
+		}
+		ctx.Next()
+	}
+}
+
+// 同一個 router 額外聽在 unix socket 上
+func serveUnixSocket(path string, handler http.Handler) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		config.LogErrorf("❌ 無法建立 unix socket 目錄: %v", err)
+		return
+	}
+	os.Remove(path)
+
+	lis, err := net.Listen("unix", path)
+	if err != nil {
+		config.LogErrorf("❌ unix socket 監聽失敗: %v", err)
+		return
+	}
+	if err := os.Chmod(path, 0o660); err != nil {
+		config.LogErrorf("❌ 無法設定 unix socket 權限: %v", err)
+	}
+
+	server := &http.Server{
+		Handler: handler,
+		ConnContext: func(ctx context.Context, c net.Conn) context.Context {
+			return context.WithValue(ctx, unixSocketKey{}, true)
+		},
+	}
+
+	log.Printf("🚀 REST API 監聽 unix socket %s", path)
+	if err := server.Serve(lis); err != nil {
+		config.LogErrorf("❌ unix socket 服務停止: %v", err)
+	}
+}
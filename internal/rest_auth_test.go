@@ -0,0 +1,136 @@
+package internal
+
+import (
+	"bytes"
+	"kenmec/ha/jimmy/config"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAPIAuthIdentify(t *testing.T) {
+	auth := newAPIAuth(config.APIAuthConfig{
+		READ_TOKENS:     []string{"r1"},
+		OPERATOR_TOKENS: []string{"o1"},
+		PEER_TOKEN:      "p1",
+	})
+	tests := []struct {
+		header    string
+		principal string
+		scope     apiScope
+	}{
+		{"Bearer o1", "operator#1", scopeOperator},
+		{"Bearer r1", "read#1", scopeRead},
+		// 另外一台的 token 只能查詢
+		{"Bearer p1", "peer", scopeRead},
+		{"Bearer x", "invalid-token", scopeNone},
+		{"", "anonymous", scopeNone},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/status", nil)
+		if tt.header != "" {
+			req.Header.Set("Authorization", tt.header)
+		}
+		principal, scope := auth.identify(req)
+		if principal != tt.principal || scope != tt.scope {
+			t.Errorf("%q: got %s %v, want %s %v", tt.header, principal, scope, tt.principal, tt.scope)
+		}
+	}
+}
+
+func TestAPIAuthWithoutTokens(t *testing.T) {
+	auth := newAPIAuth(config.APIAuthConfig{})
+	tests := []struct {
+		remote string
+		scope  apiScope
+	}{
+		{"127.0.0.1:40000", scopeOperator},
+		{"[::1]:40000", scopeOperator},
+		// 沒有 token 時遠端只能查詢 不能切換角色
+		{"192.168.100.99:40000", scopeRead},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("POST", "/maintenance?enable=true", nil)
+		req.RemoteAddr = tt.remote
+		if _, scope := auth.identify(req); scope != tt.scope {
+			t.Errorf("%s: scope = %v, want %v", tt.remote, scope, tt.scope)
+		}
+	}
+}
+
+func newRestArbiter(t *testing.T) *Arbiter {
+	t.Helper()
+	prev := config.Current()
+	t.Cleanup(func() { config.Set(prev) })
+	config.Set(&config.Config{})
+
+	a := NewArbiter(nil, nil, nil, nil)
+	t.Cleanup(a.cancel)
+	return a
+}
+
+func TestRestMaintenanceMethods(t *testing.T) {
+	a := newRestArbiter(t)
+	r := newRestRouter(a, &config.Config{})
+
+	serve := func(method, target, remote string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, nil)
+		req.RemoteAddr = remote
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	// 舊的 GET ?enable=true 要明確失敗 不能當成查詢回 200
+	if w := serve("GET", "/maintenance?enable=true", "127.0.0.1:40000"); w.Code != http.StatusMethodNotAllowed || w.Header().Get("Allow") != "POST" {
+		t.Errorf("GET ?enable=true: %d Allow=%q, want 405 POST", w.Code, w.Header().Get("Allow"))
+	}
+	if a.Maintenance {
+		t.Fatal("GET changed the maintenance mode")
+	}
+	if w := serve("GET", "/maintenance", "192.168.100.99:40000"); w.Code != http.StatusOK {
+		t.Errorf("GET from a remote caller: %d, want 200", w.Code)
+	}
+
+	if w := serve("POST", "/maintenance?enable=true", "192.168.100.99:40000"); w.Code != http.StatusForbidden || a.Maintenance {
+		t.Errorf("POST from a remote caller without tokens: %d maintenance=%v, want 403", w.Code, a.Maintenance)
+	}
+	if w := serve("POST", "/maintenance?enable=true", "127.0.0.1:40000"); w.Code != http.StatusOK || !a.Maintenance {
+		t.Errorf("POST from loopback: %d maintenance=%v, want 200 and enabled", w.Code, a.Maintenance)
+	}
+}
+
+func TestAuditSkipsPolledPaths(t *testing.T) {
+	var buf bytes.Buffer
+	prev := log.Writer()
+	log.SetOutput(&buf)
+	defer log.SetOutput(prev)
+
+	a := newRestArbiter(t)
+	auth := newAPIAuth(config.APIAuthConfig{READ_TOKENS: []string{"r1"}})
+	r := newRestRouter(a, &config.Config{API_AUTH: auth.cfg})
+
+	for _, tt := range []struct {
+		target, token string
+		audited       bool
+	}{
+		{"/health", "", false},
+		{"/health/ready", "", false},
+		{"/metrics", "r1", false},
+		{"/roles", "r1", true},
+		// 被拒絕的請求還是要記錄
+		{"/metrics", "", true},
+	} {
+		buf.Reset()
+		req := httptest.NewRequest("GET", tt.target, nil)
+		if tt.token != "" {
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+		}
+		r.ServeHTTP(httptest.NewRecorder(), req)
+		if got := strings.Contains(buf.String(), "[AUDIT] GET "+tt.target); got != tt.audited {
+			t.Errorf("%s (token %q): audited = %v, want %v\n%s", tt.target, tt.token, got, tt.audited, buf.String())
+		}
+	}
+}
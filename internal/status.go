@@ -0,0 +1,152 @@
+package internal
+
+import (
+	"kenmec/ha/jimmy/api"
+	"kenmec/ha/jimmy/config"
+	"runtime/debug"
+	"time"
+)
+
+// Version 編譯時用 -ldflags "-X kenmec/ha/jimmy/internal.Version=1.2.3" 設定
+// 沒有設定時用 go build 記錄的 git commit
+var Version = ""
+
+func version() string {
+	if Version != "" {
+		return Version
+	}
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "dev"
+	}
+	if info.Main.Version != "" && info.Main.Version != "(devel)" {
+		return info.Main.Version
+	}
+
+	revision, dirty := "", false
+	for _, s := range info.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			revision = s.Value
+		case "vcs.modified":
+			dirty = s.Value == "true"
+		}
+	}
+	if revision == "" {
+		return "dev"
+	}
+	if len(revision) > 12 {
+		revision = revision[:12]
+	}
+	if dirty {
+		revision += "-dirty"
+	}
+	return revision
+}
+
+// 最後一次收到心跳距離現在幾毫秒
+type HeartbeatAges struct {
+	Fleet   int64            `json:"fleet_ms"`              // 所有交管裡最近的一次
+	Fleets  map[string]int64 `json:"fleets_ms"`             // 每個交管
+	Peer    int64            `json:"peer_ms"`               // 另外一台 gRPC 的心跳 (任何一條路徑)
+	PeerUDP int64            `json:"peer_udp_ms,omitempty"` // 另外一台的 UDP 心跳 沒有啟用或還沒收到時不顯示
+}
+
+// 每個心跳到 now 的時間 呼叫前要先拿到 a.mu
+func (a *Arbiter) heartbeatAgesLocked(now time.Time) HeartbeatAges {
+	ages := HeartbeatAges{
+		Fleets: map[string]int64{},
+		Peer:   now.Sub(a.lastOtherHaHb).Milliseconds(),
+	}
+	if a.peerUDP != nil {
+		ages.PeerUDP = now.Sub(a.lastUDPHb).Milliseconds()
+	}
+	for i, f := range a.fleets {
+		age := now.Sub(f.lastHb).Milliseconds()
+		ages.Fleets[f.name] = age
+		if i == 0 || age < ages.Fleet {
+			ages.Fleet = age
+		}
+	}
+	return ages
+}
+
+// 連到另外一台的 gRPC 連線 每條網路路徑一個
+type PeerStreamStatus struct {
+	Path int `json:"path"`
+	api.StreamClientStats
+}
+
+// 連到本機交管的 gRPC 連線
+type FleetStreamStatus struct {
+	Name string `json:"name"`
+	api.StreamClientStats
+}
+
+// ArbiterStatus 是 GET /status 回傳的完整狀態
+type ArbiterStatus struct {
+	Version   string    `json:"version"`
+	NodeID    string    `json:"node_id"`
+	StartedAt time.Time `json:"started_at"`
+	Uptime    int64     `json:"uptime_s"` // 啟動了幾秒
+
+	Role        string    `json:"role"`       // 交管跟著的 instance 的角色 MASTER / BACKUP
+	RoleSince   time.Time `json:"role_since"` // 從什麼時候開始是這個角色
+	Epoch       uint64    `json:"epoch"`      // 角色變更的次數
+	Maintenance bool      `json:"maintenance"`
+
+	Self         Connectivity `json:"self"`  // 本機的連線狀態
+	Other        Connectivity `json:"other"` // 另外一台回報的連線狀態
+	PeerLiveness PeerLiveness `json:"peer_liveness"`
+
+	Heartbeats  HeartbeatAges     `json:"heartbeats"`
+	Replication ReplicationStatus `json:"replication"` // 跟另外一台之間的資料同步
+
+	PeerClients   []PeerStreamStatus  `json:"peer_clients"`   // GRPCHAClient 的連線狀態以及重試次數
+	FleetClients  []FleetStreamStatus `json:"fleet_clients"`  // GRPCFleetClient 的連線狀態以及重試次數
+	ServerClients int                 `json:"server_clients"` // 另外一台連進來的連線數
+}
+
+// Status 回傳仲裁程式目前的完整狀態
+func (a *Arbiter) Status() ArbiterStatus {
+	serverClients := len(a.otherHaServer.Clients())
+
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	now := time.Now()
+	status := ArbiterStatus{
+		Version:       version(),
+		NodeID:        config.Current().NODE_ID,
+		StartedAt:     a.startedAt,
+		Uptime:        int64(now.Sub(a.startedAt).Seconds()),
+		Role:          roleName(a.IsMaster),
+		Epoch:         a.epoch,
+		Maintenance:   a.Maintenance,
+		Self:          a.Self,
+		Other:         a.Other,
+		PeerLiveness:  a.peerLiveness,
+		ServerClients: serverClients,
+		Heartbeats:    a.heartbeatAgesLocked(now),
+		Replication:   a.replication.status(),
+		PeerClients:   []PeerStreamStatus{},
+		FleetClients:  []FleetStreamStatus{},
+	}
+	if inst := a.instanceLocked(""); inst != nil {
+		status.RoleSince = inst.since
+	}
+
+	for _, f := range a.fleets {
+		status.FleetClients = append(status.FleetClients, FleetStreamStatus{
+			Name:              f.name,
+			StreamClientStats: f.client.Stats(),
+		})
+	}
+	for _, p := range a.peerPaths {
+		status.PeerClients = append(status.PeerClients, PeerStreamStatus{
+			Path:              p.client.Path(),
+			StreamClientStats: p.client.Stats(),
+		})
+	}
+	return status
+}
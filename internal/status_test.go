@@ -0,0 +1,153 @@
+package internal
+
+import (
+	"encoding/json"
+	"kenmec/ha/jimmy/api"
+	"kenmec/ha/jimmy/config"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// 一個交管 兩條到另外一台的路徑 client 不會真的連線
+func newStatusArbiter(t *testing.T) *Arbiter {
+	t.Helper()
+	prev := config.Current()
+	t.Cleanup(func() { config.Set(prev) })
+	config.Set(&config.Config{
+		NODE_ID:    "ha-a",
+		PHI_WINDOW: 100,
+		KEEPALIVED: config.KeepalivedConfig{INSTANCES: []config.KeepalivedInstance{
+			{NAME: "TC_VI", SERVICE: "tc", VIP: "192.168.0.200/24"},
+		}},
+	})
+
+	creds := insecure.NewCredentials()
+	fleets := []FleetEndpoint{{Name: "fleet", Client: api.NewGRPCFleetClient("127.0.0.1:1", creds)}}
+	peers := []*api.GRPCHAClient{
+		api.NewGRPCClient("127.0.0.1:1", 0, "ha-a", creds),
+		api.NewGRPCClient("127.0.0.1:2", 1, "ha-a", creds),
+	}
+	a := NewArbiter(fleets, peers, api.NewHAToOtherServer(api.HAServerOptions{}), nil)
+	t.Cleanup(a.cancel)
+	return a
+}
+
+func getStatus(t *testing.T, a *Arbiter) map[string]any {
+	t.Helper()
+	r := newRestRouter(a, &config.Config{})
+	req := httptest.NewRequest("GET", "/status", nil)
+	req.RemoteAddr = "127.0.0.1:40000"
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /status: %d %s", w.Code, w.Body)
+	}
+	var status map[string]any
+	if err := json.Unmarshal(w.Body.Bytes(), &status); err != nil {
+		t.Fatal(err)
+	}
+	return status
+}
+
+func TestRestStatusShape(t *testing.T) {
+	a := newStatusArbiter(t)
+	status := getStatus(t, a)
+
+	// 給 dashboard 以及另外一台用的欄位 名稱跟型別都不能變
+	tests := []struct {
+		key  string
+		kind string
+	}{
+		{"version", "string"},
+		{"node_id", "string"},
+		{"started_at", "string"},
+		{"uptime_s", "number"},
+		{"role", "string"},
+		{"role_since", "string"},
+		{"epoch", "number"},
+		{"maintenance", "bool"},
+		{"self", "object"},
+		{"other", "object"},
+		{"peer_liveness", "string"},
+		{"heartbeats", "object"},
+		{"replication", "object"},
+		{"peer_clients", "array"},
+		{"fleet_clients", "array"},
+		{"server_clients", "number"},
+	}
+	for _, tt := range tests {
+		v, ok := status[tt.key]
+		if !ok {
+			t.Errorf("missing %s", tt.key)
+			continue
+		}
+		kind := ""
+		switch v.(type) {
+		case string:
+			kind = "string"
+		case float64:
+			kind = "number"
+		case bool:
+			kind = "bool"
+		case map[string]any:
+			kind = "object"
+		case []any:
+			kind = "array"
+		}
+		if kind != tt.kind {
+			t.Errorf("%s = %v (%s), want %s", tt.key, v, kind, tt.kind)
+		}
+	}
+	if len(status) != len(tests) {
+		t.Errorf("got %d fields, want %d: %v", len(status), len(tests), status)
+	}
+
+	if status["node_id"] != "ha-a" || status["role"] != "BACKUP" || status["epoch"] != 0.0 {
+		t.Errorf("node_id = %v role = %v epoch = %v", status["node_id"], status["role"], status["epoch"])
+	}
+	self := status["self"].(map[string]any)
+	for _, key := range []string{"ecs", "fleet", "ha", "deps"} {
+		if _, ok := self[key].(bool); !ok {
+			t.Errorf("self.%s = %v, want a bool", key, self[key])
+		}
+	}
+
+	heartbeats := status["heartbeats"].(map[string]any)
+	if _, ok := heartbeats["fleets_ms"].(map[string]any)["fleet"]; !ok {
+		t.Errorf("heartbeats.fleets_ms = %v, want the fleet", heartbeats["fleets_ms"])
+	}
+	// 沒有啟用 UDP 心跳時不顯示
+	if _, ok := heartbeats["peer_udp_ms"]; ok {
+		t.Error("heartbeats.peer_udp_ms shown without the UDP heartbeat")
+	}
+
+	peers := status["peer_clients"].([]any)
+	if len(peers) != 2 {
+		t.Fatalf("peer_clients = %v, want 2 paths", peers)
+	}
+	for i, p := range peers {
+		p := p.(map[string]any)
+		if p["path"] != float64(i) || p["address"] == "" || p["retries"] == nil || p["state"] == nil {
+			t.Errorf("peer_clients[%d] = %v", i, p)
+		}
+	}
+	if fleets := status["fleet_clients"].([]any); len(fleets) != 1 || fleets[0].(map[string]any)["name"] != "fleet" {
+		t.Errorf("fleet_clients = %v", fleets)
+	}
+}
+
+func TestRestStatusRole(t *testing.T) {
+	a := newStatusArbiter(t)
+	if err := a.UpdateRole("TC_VI", true, DecisionCause{Source: CauseKeepalived}); err != nil {
+		t.Fatal(err)
+	}
+	a.SetMaintenance(true, "test")
+
+	status := getStatus(t, a)
+	if status["role"] != "MASTER" || status["epoch"] != 1.0 || status["maintenance"] != true {
+		t.Errorf("role = %v epoch = %v maintenance = %v, want MASTER 1 true", status["role"], status["epoch"], status["maintenance"])
+	}
+}
@@ -0,0 +1,142 @@
+package internal
+
+import (
+	"kenmec/ha/jimmy/api"
+	"kenmec/ha/jimmy/config"
+	"log"
+	"time"
+)
+
+// 綜合 gRPC stream 心跳以及 UDP 心跳判斷另外一台的狀態
+type PeerLiveness string
+
+const (
+	PeerAlive       PeerLiveness = "alive"        // stream 心跳正常
+	PeerStreamStuck PeerLiveness = "stream_stuck" // 程式還活著 (UDP 正常) 但 stream 沒有心跳
+	PeerGone        PeerLiveness = "gone"         // 兩邊都沒有心跳
+)
+
+// 對外顯示用的另外一台狀態
+type PeerLivenessStatus struct {
+	Liveness   PeerLiveness      `json:"liveness"`
+	UDPEnabled bool              `json:"udp_enabled"`
+	LastUDPAge int64             `json:"last_udp_hb_ms"`
+	LastUDP    *api.UDPHeartbeat `json:"last_udp_hb,omitempty"`
+}
+
+// 定時送出 UDP 心跳 內容包含本機角色、epoch 以及健康狀態
+func (a *Arbiter) StartUDPHeartbeat() {
+	if a.udpHb == nil {
+		return
+	}
+
+	a.udpHb.OnReceive = a.onUDPHeartbeat
+	go a.udpHb.Listen()
+
+	interval := config.Current().OTHER_HA_HB_INTERVAL.Duration()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-a.ctx.Done():
+			return
+		case <-ticker.C:
+			a.mu.RLock()
+			hb := api.UDPHeartbeat{
+				Epoch:       a.epoch,
+				IsMaster:    a.IsMaster,
+				ECS:         a.Self.ECS,
+				Fleet:       a.Self.Fleet,
+				Maintenance: a.Maintenance,
+			}
+			a.mu.RUnlock()
+
+			if err := a.udpHb.Send(hb); err != nil {
+				log.Printf("💓 UDP 心跳發送失敗: %v", err)
+			}
+			retick(ticker, &interval, config.Current().OTHER_HA_HB_INTERVAL.Duration())
+		}
+	}
+}
+
+func (a *Arbiter) onUDPHeartbeat(hb api.UDPHeartbeat) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.peerUDP != nil && a.peerUDP.Epoch != hb.Epoch {
+		log.Printf("🔁 [UDP 心跳] 另外一台角色變更 epoch %d -> %d (master: %v)", a.peerUDP.Epoch, hb.Epoch, hb.IsMaster)
+	}
+
+	a.lastUDPHb = time.Now()
+	a.peerUDP = &hb
+}
+
+// 由 StartOtherHaHbMonitor 呼叫 streamAlive 代表至少一條路徑有 stream 心跳
+func (a *Arbiter) updatePeerLiveness(streamAlive bool, timeout time.Duration) PeerLiveness {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	udpAlive := a.udpHb != nil && time.Since(a.lastUDPHb) <= timeout
+
+	liveness := PeerGone
+	if streamAlive {
+		liveness = PeerAlive
+	} else if udpAlive {
+		liveness = PeerStreamStuck
+	}
+
+	if liveness != a.peerLiveness {
+		var detail string
+		switch liveness {
+		case PeerAlive:
+			detail = "心跳恢復正常"
+			log.Printf("✅ [另外一台HA] 心跳恢復正常")
+		case PeerStreamStuck:
+			detail = "UDP 心跳正常但 gRPC stream 沒有心跳"
+			config.LogWarnf("⚠️  [另外一台HA] UDP 心跳正常但 gRPC stream 沒有心跳 stream 可能卡住")
+		case PeerGone:
+			detail = "gRPC 以及 UDP 都沒有心跳"
+			config.LogWarnf("⚠️  [另外一台HA] gRPC 以及 UDP 都沒有心跳 判定另外一台不見")
+		}
+		a.decideLocked(Decision{
+			Kind:    DecisionPeer,
+			From:    string(a.peerLiveness),
+			To:      string(liveness),
+			Summary: "另外一台 " + string(liveness),
+			Cause:   DecisionCause{Source: CauseHeartbeat, Detail: detail},
+		})
+		if liveness == PeerAlive {
+			a.peerLostAt = time.Time{}
+		} else if a.peerLiveness == PeerAlive {
+			a.peerLostAt = time.Now()
+		}
+		a.events.Record(EventPeerLiveness, "另外一台 "+string(liveness), map[string]any{
+			"liveness": liveness,
+			"previous": a.peerLiveness,
+		})
+		a.peerLiveness = liveness
+	}
+
+	// 另外一台的程式還活著就算 HA 有連線
+	before := a.Other
+	a.Other.Ha = liveness != PeerGone
+	a.recordConnectivityLocked("other", before, a.Other)
+	return liveness
+}
+
+func (a *Arbiter) PeerLiveness() PeerLivenessStatus {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	status := PeerLivenessStatus{
+		Liveness:   a.peerLiveness,
+		UDPEnabled: a.udpHb != nil,
+	}
+	if a.peerUDP != nil {
+		last := *a.peerUDP
+		status.LastUDP = &last
+		status.LastUDPAge = time.Since(a.lastUDPHb).Milliseconds()
+	}
+	return status
+}
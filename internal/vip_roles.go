@@ -0,0 +1,348 @@
+package internal
+
+import (
+	"fmt"
+	"kenmec/ha/jimmy/config"
+	gen "kenmec/ha/jimmy/protoGen"
+	"log"
+	"net"
+	"slices"
+	"strings"
+	"time"
+)
+
+// 多久送一次本機每個 VIP 的角色到另外一台HA (角色變更時會馬上送)
+const vipRoleSyncInterval = 5 * time.Second
+
+// /health/service 檢查服務 TCP 位址的超時
+const serviceCheckTimeout = 2 * time.Second
+
+// 一個 VRRP instance (VIP) 的角色 欄位由 Arbiter.mu 保護
+type vipInstance struct {
+	name      string
+	service   string
+	vip       string
+	checkAddr string
+	depends   []string
+	fleet     bool // 交管的 is_master 跟著這個 instance
+
+	master     bool
+	peerMaster bool // 另外一台回報持有這個 VIP
+	since      time.Time
+
+	state    string // keepalived 最後通知的狀態 角色不是從通知來的時候是空白
+	priority int
+
+	heldVip       bool      // VIP 在本機上 (addrSource)
+	heldSince     time.Time // VIP 綁上 / 拿掉的時間
+	mismatchSince time.Time // heldVip 跟 master 開始不一樣的時間 一樣時是 zero
+}
+
+func newVipInstances(k config.KeepalivedConfig) []*vipInstance {
+	fleet := k.FleetInstance()
+	instances := make([]*vipInstance, 0, len(k.INSTANCES))
+	for i, inst := range k.INSTANCES {
+		instances = append(instances, &vipInstance{
+			name:      inst.NAME,
+			service:   inst.SERVICE,
+			vip:       inst.IP(),
+			checkAddr: inst.CHECK_ADDR,
+			depends:   inst.DEPENDS,
+			fleet:     i == fleet,
+			since:     time.Now(),
+			heldSince: time.Now(),
+		})
+	}
+	return instances
+}
+
+func roleName(master bool) string {
+	if master {
+		return "MASTER"
+	}
+	return "BACKUP"
+}
+
+// 用 instance 名稱或服務名稱找 空白代表交管跟著的 instance 呼叫前要先拿到 a.mu
+func (a *Arbiter) instanceLocked(name string) *vipInstance {
+	for _, inst := range a.instances {
+		if name == "" && inst.fleet || name != "" && (inst.name == name || inst.service == name) {
+			return inst
+		}
+	}
+	return nil
+}
+
+// UpdateRole 更新一個 instance 的角色 (keepalived notify 或啟動檢查)
+// 交管跟著的 instance 會同時更新 IsMaster 並通知交管 角色變更 (以及啟動檢查) 會連同 cause 記錄到決策紀錄
+func (a *Arbiter) UpdateRole(name string, master bool, cause DecisionCause) error {
+	a.mu.Lock()
+	inst := a.instanceLocked(name)
+	if inst == nil {
+		a.mu.Unlock()
+		return fmt.Errorf("找不到 instance %q", name)
+	}
+
+	changed := inst.master != master
+	if changed || cause.Source == CauseStartup {
+		summary := fmt.Sprintf("%s %s → %s", inst.name, roleName(inst.master), roleName(master))
+		if !changed {
+			summary = fmt.Sprintf("%s 維持 %s", inst.name, roleName(master))
+		}
+		a.decideLocked(Decision{
+			Kind:     DecisionRole,
+			Instance: inst.name,
+			From:     roleName(inst.master),
+			To:       roleName(master),
+			Summary:  summary,
+			Cause:    cause,
+		})
+	}
+	if changed {
+		now := time.Now()
+		a.metrics.roleTransitions.inc(inst.name, roleName(master))
+		a.metrics.roleDuration.observe(now.Sub(inst.since).Seconds(), inst.name, roleName(inst.master))
+		// 另外一台不見的時候這個 instance 還是 BACKUP 才算接手
+		if master && !a.peerLostAt.IsZero() && inst.since.Before(a.peerLostAt) {
+			a.metrics.failover.observe(now.Sub(a.peerLostAt).Seconds(), inst.name)
+		}
+		inst.master = master
+		inst.since = now
+		inst.state = ""
+		a.epoch++
+	}
+	if inst.fleet {
+		a.IsMaster = master
+	}
+	epoch := a.epoch
+	roles := a.vipRolesLocked()
+	a.mu.Unlock()
+
+	if changed {
+		log.Printf("👑 [角色] %s (%s) 變更為 %s", inst.name, inst.service, roleName(master))
+		a.events.Record(EventRoleChange, fmt.Sprintf("%s 角色變更為 %s", inst.name, roleName(master)), map[string]any{
+			"instance": inst.name,
+			"service":  inst.service,
+			"master":   master,
+			"epoch":    epoch,
+		})
+		a.sendToPeer(&gen.StatusRequest{
+			Payload: &gen.StatusRequest_VipRoles{VipRoles: roles},
+		})
+	}
+
+	if inst.fleet {
+		a.broadcastToFleets(&gen.ClientMessage{
+			Payload: &gen.ClientMessage_IsMaster{
+				IsMaster: master,
+			},
+		})
+	}
+	if changed {
+		a.logVipSplit(roles)
+		a.broadcastVipRoles(roles)
+	}
+	return nil
+}
+
+// 把本機以及另外一台每個 VIP 的角色整理成交管用的格式 呼叫前要先拿到 a.mu
+func (a *Arbiter) vipRolesLocked() *gen.VipRoles {
+	roles := &gen.VipRoles{}
+	local, peer := false, false
+	for _, inst := range a.instances {
+		roles.Roles = append(roles.Roles, &gen.VipRole{
+			Instance:   inst.name,
+			Service:    inst.service,
+			Vip:        inst.vip,
+			Master:     inst.master,
+			PeerMaster: inst.peerMaster,
+		})
+		if inst.master {
+			local = true
+		} else if inst.peerMaster {
+			peer = true
+		}
+	}
+	roles.Split = local && peer
+	return roles
+}
+
+func (a *Arbiter) broadcastVipRoles(roles *gen.VipRoles) {
+	a.broadcastToFleets(&gen.ClientMessage{
+		Payload: &gen.ClientMessage_VipRoles{VipRoles: roles},
+	})
+}
+
+// 收到另外一台每個 VIP 的角色
+func (a *Arbiter) handlePeerVipRoles(peer *gen.VipRoles) {
+	held := map[string]bool{}
+	for _, r := range peer.Roles {
+		held[r.Instance] = r.Master
+	}
+	a.setPeerVipRoles(held)
+}
+
+// 更新另外一台持有的 VIP 有變動時通知交管
+func (a *Arbiter) setPeerVipRoles(held map[string]bool) {
+	a.mu.Lock()
+	changed := false
+	for _, inst := range a.instances {
+		if inst.peerMaster != held[inst.name] {
+			inst.peerMaster = held[inst.name]
+			changed = true
+		}
+	}
+	roles := a.vipRolesLocked()
+	a.mu.Unlock()
+
+	if !changed {
+		return
+	}
+	a.logVipSplit(roles)
+	a.broadcastVipRoles(roles)
+}
+
+// VIP 開始或不再分散在兩台時寫日誌
+func (a *Arbiter) logVipSplit(roles *gen.VipRoles) {
+	a.mu.Lock()
+	wasSplit := a.vipSplit
+	a.vipSplit = roles.Split
+	a.mu.Unlock()
+
+	if roles.Split && !wasSplit {
+		var holders []string
+		for _, r := range roles.Roles {
+			holder := "無"
+			if r.Master {
+				holder = "本機"
+			} else if r.PeerMaster {
+				holder = "另外一台"
+			}
+			holders = append(holders, r.Instance+"="+holder)
+		}
+		config.LogWarnf("⚠️  [角色] VIP 分散在兩台上 %s", strings.Join(holders, " "))
+	} else if !roles.Split && wasSplit {
+		log.Printf("✅ [角色] VIP 已經不再分散在兩台上")
+	}
+}
+
+// 定時把本機每個 VIP 的角色送到另外一台 另外一台不見時清掉它的角色
+func (a *Arbiter) StartVipRoleSync() {
+	ticker := time.NewTicker(vipRoleSyncInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-a.ctx.Done():
+			return
+		case <-ticker.C:
+			a.mu.RLock()
+			roles := a.vipRolesLocked()
+			gone := a.peerLiveness == PeerGone
+			a.mu.RUnlock()
+
+			if gone {
+				a.setPeerVipRoles(nil)
+				continue
+			}
+			a.sendToPeer(&gen.StatusRequest{
+				Payload: &gen.StatusRequest_VipRoles{VipRoles: roles},
+			})
+		}
+	}
+}
+
+// 對外顯示用的 VIP 角色
+type VipRoleStatus struct {
+	Instance   string    `json:"instance"`
+	Service    string    `json:"service"`
+	VIP        string    `json:"vip"`
+	Fleet      bool      `json:"fleet"`
+	Master     bool      `json:"master"`
+	PeerMaster bool      `json:"peer_master"`
+	Since      time.Time `json:"since"`
+	// keepalived 最後通知的狀態以及 priority
+	State    string `json:"state,omitempty"`
+	Priority int    `json:"priority,omitempty"`
+	// VIP 實際上在不在本機 跟 master 不一樣時 mismatch 為 true (超過 RECONCILE_GRACE 會校正)
+	HoldsVIP  bool      `json:"holds_vip"`
+	HeldSince time.Time `json:"held_since"`
+	Mismatch  bool      `json:"mismatch"`
+}
+
+type VipRolesStatus struct {
+	Split bool            `json:"split"`
+	Roles []VipRoleStatus `json:"roles"`
+}
+
+func (a *Arbiter) VipRoles() VipRolesStatus {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	status := VipRolesStatus{Split: a.vipRolesLocked().Split}
+	for _, inst := range a.instances {
+		status.Roles = append(status.Roles, VipRoleStatus{
+			Instance:   inst.name,
+			Service:    inst.service,
+			VIP:        inst.vip,
+			Fleet:      inst.fleet,
+			Master:     inst.master,
+			PeerMaster: inst.peerMaster,
+			Since:      inst.since,
+			State:      inst.state,
+			Priority:   inst.priority,
+			HoldsVIP:   inst.heldVip,
+			HeldSince:  inst.heldSince,
+			Mismatch:   inst.heldVip != inst.master,
+		})
+	}
+	return status
+}
+
+// 一個服務的健康狀態 給 keepalived 的 track_script 檢查
+type ServiceHealth struct {
+	Instance string `json:"instance"`
+	Service  string `json:"service"`
+	OK       bool   `json:"ok"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+// ServiceHealth 檢查一個 instance 的服務 找不到 instance 時 ok 為 false
+// 交管跟著的 instance 看交管以及 ECS 另外看 DEPENDS 的依賴 有設定 CHECK_ADDR 的檢查 TCP 連線
+func (a *Arbiter) ServiceHealth(name string) (ServiceHealth, bool) {
+	a.mu.RLock()
+	inst := a.instanceLocked(name)
+	if inst == nil || name == "" {
+		a.mu.RUnlock()
+		return ServiceHealth{}, false
+	}
+	health := ServiceHealth{Instance: inst.name, Service: inst.service, OK: true}
+	maintenance := a.Maintenance
+	ecs, fleet := a.Self.ECS, a.Self.Fleet
+	checkAddr := inst.checkAddr
+	isFleet := inst.fleet
+	depDown := ""
+	for _, d := range a.deps {
+		if slices.Contains(inst.depends, d.cfg.NAME) && !d.up && depDown == "" {
+			depDown = fmt.Sprintf("%s 異常: %s", d.cfg.NAME, d.lastErr)
+		}
+	}
+	a.mu.RUnlock()
+
+	switch {
+	case maintenance:
+		health.OK, health.Reason = false, "維修此機器中"
+	case isFleet && !(ecs && fleet):
+		health.OK, health.Reason = false, fmt.Sprintf("ecs: %v, fleet: %v", ecs, fleet)
+	case depDown != "":
+		health.OK, health.Reason = false, depDown
+	case checkAddr != "":
+		conn, err := net.DialTimeout("tcp", checkAddr, serviceCheckTimeout)
+		if err != nil {
+			health.OK, health.Reason = false, err.Error()
+		} else {
+			conn.Close()
+		}
+	}
+	return health, true
+}
@@ -0,0 +1,176 @@
+package internal
+
+import (
+	"kenmec/ha/jimmy/config"
+	gen "kenmec/ha/jimmy/protoGen"
+	"testing"
+)
+
+// 三個 instance 交管跟著 TC_VI
+func newVipRolesArbiter(t *testing.T) *Arbiter {
+	t.Helper()
+	prev := config.Current()
+	t.Cleanup(func() { config.Set(prev) })
+	config.Set(&config.Config{KEEPALIVED: config.KeepalivedConfig{INSTANCES: []config.KeepalivedInstance{
+		{NAME: "TC_VI", SERVICE: "tc", VIP: "192.168.0.200/24"},
+		{NAME: "DB_VI", SERVICE: "db", VIP: "192.168.0.202/24"},
+		{NAME: "MQ_VI", SERVICE: "mq", VIP: "192.168.0.203/24"},
+	}}})
+
+	a := NewArbiter(nil, nil, nil, nil)
+	t.Cleanup(a.cancel)
+	return a
+}
+
+func masters(a *Arbiter) map[string]bool {
+	out := map[string]bool{}
+	for _, r := range a.VipRoles().Roles {
+		out[r.Instance] = r.Master
+	}
+	return out
+}
+
+func TestUpdateRolePerInstance(t *testing.T) {
+	tests := []struct {
+		name     string
+		updates  []string // instance 或服務名稱 加上 + (MASTER) / - (BACKUP)
+		masters  map[string]bool
+		isMaster bool
+	}{
+		{"fleet instance", []string{"+TC_VI"}, map[string]bool{"TC_VI": true}, true},
+		// 其他 instance 的角色不影響交管的 is_master
+		{"other instance", []string{"+DB_VI"}, map[string]bool{"DB_VI": true}, false},
+		{"by service name", []string{"+db", "+mq"}, map[string]bool{"DB_VI": true, "MQ_VI": true}, false},
+		{"empty name is the fleet instance", []string{"+"}, map[string]bool{"TC_VI": true}, true},
+		{"fleet back to backup", []string{"+TC_VI", "+DB_VI", "-TC_VI"}, map[string]bool{"DB_VI": true}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newVipRolesArbiter(t)
+			for _, u := range tt.updates {
+				if err := a.UpdateRole(u[1:], u[0] == '+', DecisionCause{Source: CauseKeepalived}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			got := masters(a)
+			for _, name := range []string{"TC_VI", "DB_VI", "MQ_VI"} {
+				if got[name] != tt.masters[name] {
+					t.Errorf("%s master = %v, want %v", name, got[name], tt.masters[name])
+				}
+			}
+			if a.IsMaster != tt.isMaster {
+				t.Errorf("IsMaster = %v, want %v", a.IsMaster, tt.isMaster)
+			}
+		})
+	}
+
+	a := newVipRolesArbiter(t)
+	if err := a.UpdateRole("XX_VI", true, DecisionCause{Source: CauseKeepalived}); err == nil {
+		t.Error("unknown instance updated")
+	}
+	// 角色沒變不算轉換
+	a.UpdateRole("DB_VI", true, DecisionCause{Source: CauseKeepalived})
+	a.UpdateRole("DB_VI", true, DecisionCause{Source: CauseKeepalived})
+	if n := len(ParseEventFilter(EventRoleChange).Filter(a.Events().Since(0))); n != 1 {
+		t.Errorf("got %d role change events, want 1", n)
+	}
+}
+
+func TestVipSplit(t *testing.T) {
+	tests := []struct {
+		name  string
+		local []string
+		peer  []string
+		split bool
+	}{
+		{"all on this node", []string{"TC_VI", "DB_VI", "MQ_VI"}, nil, false},
+		{"all on the peer", nil, []string{"TC_VI", "DB_VI", "MQ_VI"}, false},
+		{"split", []string{"TC_VI"}, []string{"DB_VI", "MQ_VI"}, true},
+		// 沒有人持有的 VIP 不算分散
+		{"one unheld", []string{"TC_VI", "DB_VI"}, nil, false},
+		{"nobody", nil, nil, false},
+		// 兩台都說自己持有 (剛切換) 以本機為準 另外一台沒有其他 VIP 時不算分散
+		{"both claim the same VIP", []string{"TC_VI"}, []string{"TC_VI"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newVipRolesArbiter(t)
+			for _, name := range tt.local {
+				a.UpdateRole(name, true, DecisionCause{Source: CauseKeepalived})
+			}
+			peer := &gen.VipRoles{}
+			for _, name := range tt.peer {
+				peer.Roles = append(peer.Roles, &gen.VipRole{Instance: name, Master: true})
+			}
+			a.handlePeerVipRoles(peer)
+
+			status := a.VipRoles()
+			if status.Split != tt.split || a.vipSplit != tt.split {
+				t.Errorf("split = %v (logged %v), want %v", status.Split, a.vipSplit, tt.split)
+			}
+			for _, r := range status.Roles {
+				want := false
+				for _, name := range tt.peer {
+					want = want || name == r.Instance
+				}
+				if r.PeerMaster != want {
+					t.Errorf("%s peer master = %v, want %v", r.Instance, r.PeerMaster, want)
+				}
+			}
+		})
+	}
+}
+
+func TestVipSplitClearedWhenPeerGone(t *testing.T) {
+	a := newVipRolesArbiter(t)
+	a.UpdateRole("TC_VI", true, DecisionCause{Source: CauseKeepalived})
+	a.setPeerVipRoles(map[string]bool{"DB_VI": true})
+	if !a.VipRoles().Split {
+		t.Fatal("split not detected")
+	}
+
+	// 另外一台不見時清掉它的角色
+	a.setPeerVipRoles(nil)
+	if status := a.VipRoles(); status.Split || a.vipSplit {
+		t.Errorf("split = %v after the peer was gone", status.Split)
+	}
+	if masters(a)["TC_VI"] != true {
+		t.Error("local role changed with the peer roles")
+	}
+}
+
+func TestServiceHealthLookup(t *testing.T) {
+	a := newVipRolesArbiter(t)
+	a.Self.ECS, a.Self.Fleet = true, true
+
+	tests := []struct {
+		name  string
+		found bool
+		ok    bool
+	}{
+		{"TC_VI", true, true},
+		{"db", true, true},
+		// 空白不是合法的服務名稱
+		{"", false, false},
+		{"XX_VI", false, false},
+	}
+	for _, tt := range tests {
+		h, found := a.ServiceHealth(tt.name)
+		if found != tt.found || h.OK != tt.ok {
+			t.Errorf("ServiceHealth(%q) = %+v found = %v, want found = %v ok = %v", tt.name, h, found, tt.found, tt.ok)
+		}
+	}
+
+	// 交管跟著的 instance 才看交管以及 ECS
+	a.Self.Fleet = false
+	if h, _ := a.ServiceHealth("TC_VI"); h.OK {
+		t.Error("TC_VI ok without the fleet")
+	}
+	if h, _ := a.ServiceHealth("DB_VI"); !h.OK {
+		t.Errorf("DB_VI = %+v, want ok without the fleet", h)
+	}
+	a.Maintenance = true
+	if h, _ := a.ServiceHealth("DB_VI"); h.OK {
+		t.Error("DB_VI ok in maintenance")
+	}
+}
@@ -0,0 +1,184 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"kenmec/ha/jimmy/config"
+	"log"
+	"net"
+	"time"
+)
+
+// 位址來源不支援即時監看 只能定時檢查
+var errNoWatch = errors.New("不支援即時監看")
+
+// addrSource 提供本機持有的 IPv4 位址 VIP 在不在本機以這裡為準
+type addrSource interface {
+	Addrs() (map[string]bool, error)
+	// Watch 在位址變動時送到 changed 直到 ctx 結束 不支援時回傳錯誤
+	Watch(ctx context.Context, changed chan<- struct{}) error
+}
+
+func newAddrSource(k config.KeepalivedConfig) addrSource {
+	switch k.ADDR_SOURCE {
+	case "poll":
+		return ifaceAddrSource{iface: k.INTERFACE}
+	default:
+		return ifaceAddrSource{iface: k.INTERFACE, netlink: true}
+	}
+}
+
+// 網卡上的位址 iface 空白代表所有網卡
+type ifaceAddrSource struct {
+	iface   string
+	netlink bool
+}
+
+func (s ifaceAddrSource) Addrs() (map[string]bool, error) {
+	if s.iface == "" {
+		return localIPv4s()
+	}
+	ifi, err := net.InterfaceByName(s.iface)
+	if err != nil {
+		return nil, err
+	}
+	addrs, err := ifi.Addrs()
+	if err != nil {
+		return nil, err
+	}
+	return ipv4Set(addrs), nil
+}
+
+func (s ifaceAddrSource) Watch(ctx context.Context, changed chan<- struct{}) error {
+	if !s.netlink {
+		return errNoWatch
+	}
+	return watchAddrChanges(ctx, changed)
+}
+
+func ipv4Set(addrs []net.Addr) map[string]bool {
+	local := map[string]bool{}
+	for _, addr := range addrs {
+
+		if ipnet, ok := addr.(*net.IPNet); ok {
+
+			if ipnet.IP.IsLoopback() {
+				continue
+			}
+
+			ip := ipnet.IP.To4()
+			if ip == nil {
+				continue
+			}
+
+			local[ip.String()] = true
+		}
+	}
+	return local
+}
+
+// StartVipWatch 監看本機的位址 VIP 綁上或拿掉時馬上檢查角色 另外每 RECONCILE_INTERVAL 檢查一次
+// netlink 不能用時只剩定時檢查
+func (a *Arbiter) StartVipWatch() {
+	changed := make(chan struct{}, 1)
+	go func() {
+		err := a.addrs.Watch(a.ctx, changed)
+		switch {
+		case errors.Is(err, errNoWatch):
+		case err != nil && a.ctx.Err() == nil:
+			config.LogWarnf("⚠️  [VIP] 無法監看網卡位址的變動 只用定時檢查: %v", err)
+		}
+	}()
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-a.ctx.Done():
+			return
+		case <-changed:
+		case <-timer.C:
+		}
+		wait := a.reconcileRoles()
+		timer.Reset(wait)
+	}
+}
+
+// 依照本機持有的 VIP 檢查每個 instance 的角色 回傳下次要多久後檢查
+// 不一致持續 RECONCILE_GRACE 時發出警告並以 VIP 為準校正角色
+// (keepalived 綁上 VIP 之後才通知 切換中會短暫不一致)
+func (a *Arbiter) reconcileRoles() time.Duration {
+	k := config.Current().KEEPALIVED
+	interval := k.RECONCILE_INTERVAL.Duration()
+	grace := k.RECONCILE_GRACE.Duration()
+
+	local, err := a.addrs.Addrs()
+	a.mu.Lock()
+	if err != nil {
+		if msg := err.Error(); msg != a.addrErr {
+			config.LogErrorf("❌ [VIP] 無法取得本機位址: %v", err)
+			a.addrErr = msg
+		}
+		a.mu.Unlock()
+		return interval
+	}
+	if a.addrErr != "" {
+		log.Printf("✅ [VIP] 可以取得本機位址")
+		a.addrErr = ""
+	}
+
+	type fix struct {
+		name, vip string
+		held      bool
+		since     time.Time
+	}
+	var fixes []fix
+	now := time.Now()
+	for _, inst := range a.instances {
+		held := local[inst.vip]
+		if held != inst.heldVip {
+			inst.heldVip = held
+			inst.heldSince = now
+		}
+
+		if held == inst.master {
+			inst.mismatchSince = time.Time{}
+			continue
+		}
+		if inst.mismatchSince.IsZero() {
+			inst.mismatchSince = now
+		}
+		if elapsed := now.Sub(inst.mismatchSince); elapsed < grace {
+			interval = min(interval, grace-elapsed)
+			continue
+		}
+		fixes = append(fixes, fix{name: inst.name, vip: inst.vip, held: held, since: inst.mismatchSince})
+		inst.mismatchSince = time.Time{}
+	}
+	a.mu.Unlock()
+
+	for _, f := range fixes {
+		config.LogWarnf("⚠️  [角色校正] %s 的 VIP (%s) %s 但是角色是 %s 已經 %v 可能漏掉了通知 校正為 %s",
+			f.name, f.vip, heldText(f.held), roleName(!f.held), now.Sub(f.since).Round(time.Millisecond), roleName(f.held))
+		a.metrics.reconciled.inc(f.name)
+		a.events.Record(EventRoleReconcile, fmt.Sprintf("%s 的 VIP %s 但是角色是 %s 校正為 %s", f.name, heldText(f.held), roleName(!f.held), roleName(f.held)), map[string]any{
+			"instance": f.name,
+			"vip":      f.vip,
+			"master":   f.held,
+			"since":    f.since,
+		})
+		a.UpdateRole(f.name, f.held, DecisionCause{
+			Source: CauseReconcile,
+			Detail: fmt.Sprintf("VIP (%s) %s 已經 %v", f.vip, heldText(f.held), now.Sub(f.since).Round(time.Millisecond)),
+		})
+	}
+	return interval
+}
+
+func heldText(held bool) string {
+	if held {
+		return "在本機"
+	}
+	return "不在本機"
+}
@@ -0,0 +1,63 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"os"
+	"syscall"
+)
+
+// linux/rtnetlink.h 的 RTMGRP_IPV4_IFADDR syscall 沒有定義
+const rtmgrpIPv4Ifaddr = 0x10
+
+// 用 netlink 訂閱 IPv4 位址的新增 / 刪除 收到時通知 changed 由 Addrs 重新讀取
+func watchAddrChanges(ctx context.Context, changed chan<- struct{}) error {
+	fd, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_RAW|syscall.SOCK_CLOEXEC, syscall.NETLINK_ROUTE)
+	if err != nil {
+		return err
+	}
+	if err := syscall.Bind(fd, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK, Groups: rtmgrpIPv4Ifaddr}); err != nil {
+		syscall.Close(fd)
+		return err
+	}
+	// 設成 non-blocking 交給 runtime 的 poller ctx 結束時 Close 才能打斷 Read
+	if err := syscall.SetNonblock(fd, true); err != nil {
+		syscall.Close(fd)
+		return err
+	}
+	f := os.NewFile(uintptr(fd), "netlink")
+	go func() {
+		<-ctx.Done()
+		f.Close()
+	}()
+
+	buf := make([]byte, os.Getpagesize())
+	for {
+		n, err := f.Read(buf)
+		if errors.Is(err, syscall.ENOBUFS) {
+			// 來不及讀 漏掉了一些通知 直接重新檢查
+			notifyAddrChange(changed)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		msgs, err := syscall.ParseNetlinkMessage(buf[:n])
+		if err != nil {
+			continue
+		}
+		for _, m := range msgs {
+			if m.Header.Type == syscall.RTM_NEWADDR || m.Header.Type == syscall.RTM_DELADDR {
+				notifyAddrChange(changed)
+				break
+			}
+		}
+	}
+}
+
+func notifyAddrChange(changed chan<- struct{}) {
+	select {
+	case changed <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package internal
+
+import (
+	"context"
+	"errors"
+)
+
+// 只有 linux 有 netlink 其他平台只用定時檢查
+func watchAddrChanges(ctx context.Context, changed chan<- struct{}) error {
+	return errors.New("只有 linux 支援 netlink")
+}
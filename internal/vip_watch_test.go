@@ -0,0 +1,162 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"kenmec/ha/jimmy/config"
+	"testing"
+	"time"
+)
+
+// 測試用的位址來源 直接改 addrs 模擬 VIP 綁上 / 拿掉
+type fakeAddrSource struct {
+	addrs map[string]bool
+	err   error
+}
+
+func (s *fakeAddrSource) Addrs() (map[string]bool, error) {
+	return s.addrs, s.err
+}
+
+func (s *fakeAddrSource) Watch(ctx context.Context, changed chan<- struct{}) error {
+	return errNoWatch
+}
+
+const (
+	testReconcileInterval = 5 * time.Second
+	testReconcileGrace    = 3 * time.Second
+)
+
+// 只有一個 instance VI_1 (192.168.0.200) 的仲裁程式 位址由 fakeAddrSource 提供
+func newVipWatchArbiter(t *testing.T) (*Arbiter, *fakeAddrSource) {
+	t.Helper()
+	prev := config.Current()
+	t.Cleanup(func() { config.Set(prev) })
+	config.Set(&config.Config{KEEPALIVED: config.KeepalivedConfig{
+		RECONCILE_INTERVAL: config.Duration(testReconcileInterval),
+		RECONCILE_GRACE:    config.Duration(testReconcileGrace),
+		INSTANCES:          []config.KeepalivedInstance{{NAME: "VI_1", SERVICE: "tc", VIP: "192.168.0.200/24"}},
+	}})
+
+	a := NewArbiter(nil, nil, nil, nil)
+	t.Cleanup(a.cancel)
+	src := &fakeAddrSource{addrs: map[string]bool{"192.168.0.10": true}}
+	a.addrs = src
+	return a, src
+}
+
+func reconcileEvents(a *Arbiter) []Event {
+	return ParseEventFilter(EventRoleReconcile).Filter(a.Events().Since(0))
+}
+
+func TestReconcileRolesWithinGrace(t *testing.T) {
+	a, src := newVipWatchArbiter(t)
+	inst := a.instances[0]
+
+	if wait := a.reconcileRoles(); wait != testReconcileInterval {
+		t.Errorf("consistent state: wait = %v, want %v", wait, testReconcileInterval)
+	}
+	if !inst.mismatchSince.IsZero() {
+		t.Fatal("mismatch recorded while role and VIP agree")
+	}
+
+	// keepalived 綁上 VIP 但通知還沒到 在 grace 之內只記錄不校正
+	before := inst.heldSince
+	src.addrs = map[string]bool{"192.168.0.10": true, "192.168.0.200": true}
+	wait := a.reconcileRoles()
+	if !inst.heldVip || !inst.heldSince.After(before) {
+		t.Errorf("heldVip = %v heldSince = %v, want the VIP held since now", inst.heldVip, inst.heldSince)
+	}
+	if inst.mismatchSince.IsZero() {
+		t.Error("mismatch not recorded")
+	}
+	if wait <= 0 || wait > testReconcileGrace {
+		t.Errorf("wait = %v, want the rest of the grace period", wait)
+	}
+	if inst.master {
+		t.Error("role corrected within the grace period")
+	}
+
+	// 通知到了 角色跟 VIP 一致 不需要校正
+	if err := a.UpdateRole("VI_1", true, DecisionCause{Source: CauseKeepalived}); err != nil {
+		t.Fatal(err)
+	}
+	a.reconcileRoles()
+	if !inst.mismatchSince.IsZero() {
+		t.Error("mismatch not cleared after the notification")
+	}
+	if n := len(reconcileEvents(a)); n != 0 {
+		t.Errorf("got %d reconcile events, want none", n)
+	}
+}
+
+func TestReconcileRolesAfterGrace(t *testing.T) {
+	a, src := newVipWatchArbiter(t)
+	inst := a.instances[0]
+
+	src.addrs = map[string]bool{"192.168.0.200": true}
+	a.reconcileRoles()
+	heldSince := inst.heldSince
+
+	// 漏掉了通知 不一致超過 grace 以 VIP 為準校正為 MASTER
+	inst.mismatchSince = time.Now().Add(-testReconcileGrace)
+	a.reconcileRoles()
+	if !inst.master || !a.IsMaster {
+		t.Fatalf("master = %v IsMaster = %v, want corrected to MASTER", inst.master, a.IsMaster)
+	}
+	if !inst.mismatchSince.IsZero() {
+		t.Error("mismatch not cleared after the correction")
+	}
+	if !inst.heldSince.Equal(heldSince) {
+		t.Error("heldSince changed although the VIP stayed on this node")
+	}
+	events := reconcileEvents(a)
+	if len(events) != 1 {
+		t.Fatalf("got %d reconcile events, want 1", len(events))
+	}
+	if data := events[0].Data.(map[string]any); data["instance"] != "VI_1" || data["master"] != true {
+		t.Errorf("reconcile event data = %v", data)
+	}
+	decisions := a.Decisions()
+	if last := decisions[len(decisions)-1]; last.Cause.Source != CauseReconcile || last.To != "MASTER" {
+		t.Errorf("last decision = %+v, want a reconcile to MASTER", last)
+	}
+
+	// VIP 被拿掉 一樣等 grace 之後校正為 BACKUP
+	src.addrs = map[string]bool{}
+	a.reconcileRoles()
+	if inst.heldVip || !inst.master {
+		t.Fatalf("heldVip = %v master = %v right after the VIP was removed", inst.heldVip, inst.master)
+	}
+	inst.mismatchSince = time.Now().Add(-testReconcileGrace)
+	a.reconcileRoles()
+	if inst.master || a.IsMaster {
+		t.Error("not corrected to BACKUP after the VIP was removed")
+	}
+	if n := len(reconcileEvents(a)); n != 2 {
+		t.Errorf("got %d reconcile events, want 2", n)
+	}
+}
+
+func TestReconcileRolesAddrError(t *testing.T) {
+	a, src := newVipWatchArbiter(t)
+	inst := a.instances[0]
+
+	src.err = errors.New("no such network interface")
+	if wait := a.reconcileRoles(); wait != testReconcileInterval {
+		t.Errorf("wait = %v, want %v", wait, testReconcileInterval)
+	}
+	if a.addrErr == "" {
+		t.Error("address error not remembered")
+	}
+	// 拿不到位址時不能當成 VIP 不在本機
+	if inst.heldVip || !inst.mismatchSince.IsZero() {
+		t.Error("state changed although the addresses are unknown")
+	}
+
+	src.err = nil
+	a.reconcileRoles()
+	if a.addrErr != "" {
+		t.Error("address error not cleared after recovery")
+	}
+}
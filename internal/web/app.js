@@ -0,0 +1,242 @@
+// HA 仲裁 dashboard 只用 REST API 權限跟 curl 一樣 token 存在瀏覽器的 localStorage
+"use strict";
+
+const REFRESH_MS = 2000;
+const MAX_EVENTS = 200;
+
+const $ = (sel, root = document) => root.querySelector(sel);
+let token = localStorage.getItem("ha_token") || "";
+let lastSeq = 0;
+let streamAbort = null;
+
+function headers() {
+  return token ? { Authorization: "Bearer " + token } : {};
+}
+
+async function api(path, options = {}) {
+  const resp = await fetch(path, { ...options, headers: headers() });
+  let body = null;
+  try {
+    body = await resp.json();
+  } catch (e) {
+    // 沒有內容
+  }
+  if (!resp.ok) {
+    const reason = body && body.status ? body.status : resp.statusText;
+    const err = new Error(`${resp.status} ${reason}`);
+    err.status = resp.status;
+    throw err;
+  }
+  return body;
+}
+
+function el(tag, cls, text) {
+  const e = document.createElement(tag);
+  if (cls) e.className = cls;
+  if (text !== undefined) e.textContent = text;
+  return e;
+}
+
+function pill(label, ok, warn) {
+  return el("span", "pill " + (ok ? "ok" : warn ? "warn" : "bad"), label);
+}
+
+function ms(v) {
+  if (v === undefined || v < 0) return "—";
+  if (v < 1000) return `${Math.round(v)} ms`;
+  return `${(v / 1000).toFixed(1)} s`;
+}
+
+function duration(seconds) {
+  const d = Math.floor(seconds / 86400);
+  const h = Math.floor((seconds % 86400) / 3600);
+  const m = Math.floor((seconds % 3600) / 60);
+  if (d > 0) return `${d} 天 ${h} 小時`;
+  if (h > 0) return `${h} 小時 ${m} 分`;
+  return `${m} 分 ${seconds % 60} 秒`;
+}
+
+function showError(message) {
+  const banner = $("#error");
+  banner.hidden = !message;
+  banner.textContent = message || "";
+}
+
+function connectivity(c) {
+  const cell = document.createDocumentFragment();
+  cell.append(pill("ECS", c.ecs), pill("交管", c.fleet), pill("HA", c.ha), pill("依賴", c.deps));
+  return cell;
+}
+
+function renderNode(card, status, error, local) {
+  card.replaceChildren($("#node-template").content.cloneNode(true));
+  card.className = "node";
+
+  if (!status) {
+    $(".name", card).textContent = local ? "本機" : "另外一台";
+    $(".role", card).hidden = true;
+    $(".details", card).hidden = true;
+    const box = $(".unavailable", card);
+    box.hidden = false;
+    box.textContent = "無法取得狀態: " + error;
+    return;
+  }
+
+  card.classList.add(status.role === "MASTER" ? "master" : "backup");
+  $(".name", card).textContent = `${status.node_id || "(沒有 NODE_ID)"} ${local ? "本機" : "另外一台"}`;
+  const role = $(".role", card);
+  role.textContent = status.role;
+  role.classList.add(status.role);
+  $(".maintenance", card).hidden = !status.maintenance;
+  $(".meta", card).textContent =
+    `版本 ${status.version} · 啟動 ${duration(status.uptime_s)} · ` +
+    `角色從 ${new Date(status.role_since).toLocaleString()} · epoch ${status.epoch}`;
+
+  $(".health", card).append(connectivity(status.self));
+  $(".other", card).append(connectivity(status.other));
+
+  const liveness = status.peer_liveness;
+  $(".liveness", card).append(pill(liveness, liveness === "alive", liveness === "stream_stuck"));
+
+  const hb = status.heartbeats;
+  const hbText = [`交管 ${ms(hb.fleet_ms)}`, `另外一台 ${ms(hb.peer_ms)}`];
+  if (hb.peer_udp_ms) hbText.push(`UDP ${ms(hb.peer_udp_ms)}`);
+  $(".heartbeats", card).textContent = hbText.join(" · ");
+
+  const r = status.replication;
+  $(".replication", card).textContent =
+    `單向延遲 ${ms(r.lag_ms)} (平均 ${ms(r.avg_lag_ms)} 最大 ${ms(r.max_lag_ms)} 包含時鐘差) · ` +
+    `送出 ${r.sent} 收到 ${r.received} 失敗 ${r.failed} · 最後收到 ${ms(r.last_received_ms)} 前`;
+
+  const streams = $(".streams", card);
+  for (const c of status.peer_clients) {
+    streams.append(pill(`HA 路徑 ${c.path} ${c.state}${c.retries ? " 重試 " + c.retries : ""}`, c.state === "ready"));
+  }
+  for (const c of status.fleet_clients) {
+    streams.append(pill(`交管 ${c.name} ${c.state}${c.retries ? " 重試 " + c.retries : ""}`, c.state === "ready"));
+  }
+  streams.append(el("span", "muted", ` 另外一台連進來 ${status.server_clients} 條`));
+
+  const actions = $(".actions", card);
+  if (!local) {
+    actions.append(el("span", "muted", "要操作另外一台請開另外一台的 dashboard"));
+    return;
+  }
+  const maintenance = el("button", "", status.maintenance ? "結束維修模式" : "進入維修模式");
+  maintenance.onclick = () => setMaintenance(!status.maintenance);
+  actions.append(maintenance);
+  if (status.role === "MASTER" && !status.maintenance) {
+    const switchover = el("button", "danger", "切換到另外一台");
+    switchover.onclick = () => doSwitchover(status.peer_liveness);
+    actions.append(switchover);
+  }
+}
+
+async function refresh() {
+  const [local, peer, roles] = await Promise.allSettled([api("/status"), api("/peer/status"), api("/roles")]);
+
+  if (local.status === "rejected" && local.reason.status === 401) {
+    showError("需要 API token 請在右上角輸入");
+  } else if (local.status === "rejected") {
+    showError("無法連線到仲裁程式: " + local.reason.message);
+  } else {
+    showError("");
+  }
+
+  renderNode($("#local"), local.value, local.reason && local.reason.message, true);
+  renderNode($("#peer"), peer.value, peer.reason && peer.reason.message, false);
+  $("#split").hidden = !(roles.value && roles.value.split);
+  $("#updated").textContent = "更新於 " + new Date().toLocaleTimeString();
+}
+
+async function setMaintenance(enable) {
+  const message = enable
+    ? "進入維修模式後健康檢查會失敗 如果這台是 MASTER VIP 會切到另外一台 確定?"
+    : "結束維修模式?";
+  if (!confirm(message)) return;
+  try {
+    await api(`/maintenance?enable=${enable}`, { method: "POST" });
+  } catch (e) {
+    alert("操作失敗: " + e.message);
+  }
+  refresh();
+}
+
+async function doSwitchover(liveness) {
+  let force = false;
+  if (liveness !== "alive") {
+    if (!confirm(`另外一台的狀態是 ${liveness} 切過去可能沒有人接手 仍然要切換?`)) return;
+    force = true;
+  } else if (!confirm("把 VIP 切到另外一台? 這台會進入維修模式 之後要手動結束維修模式")) {
+    return;
+  }
+  try {
+    await api(`/switchover?force=${force}`, { method: "POST" });
+  } catch (e) {
+    alert("切換失敗: " + e.message);
+  }
+  refresh();
+}
+
+function addEvent(e) {
+  lastSeq = Math.max(lastSeq, e.seq);
+  const list = $("#events");
+  const item = el("li");
+  const at = new Date(e.at);
+  item.append(
+    el("time", "", at.toLocaleDateString() + " " + at.toLocaleTimeString()),
+    el("span", "type " + e.type.split(".")[0], e.type),
+    el("span", "", e.message),
+  );
+  list.prepend(item);
+  while (list.children.length > MAX_EVENTS) list.lastChild.remove();
+}
+
+// EventSource 不能帶 Authorization 所以用 fetch 讀 SSE 斷線後用 since 補回漏掉的事件
+async function streamEvents() {
+  if (streamAbort) streamAbort.abort();
+  const abort = new AbortController();
+  streamAbort = abort;
+  const state = $("#stream-state");
+
+  while (!abort.signal.aborted) {
+    const query = lastSeq ? `since=${lastSeq}` : "last=50";
+    try {
+      const resp = await fetch(`/events/stream?${query}`, { headers: headers(), signal: abort.signal });
+      if (!resp.ok) throw new Error(`${resp.status} ${resp.statusText}`);
+      state.textContent = "即時";
+
+      const reader = resp.body.pipeThrough(new TextDecoderStream()).getReader();
+      let buffer = "";
+      for (;;) {
+        const { value, done } = await reader.read();
+        if (done) break;
+        buffer += value;
+        let end;
+        while ((end = buffer.indexOf("\n\n")) >= 0) {
+          const block = buffer.slice(0, end);
+          buffer = buffer.slice(end + 2);
+          const data = block.split("\n").filter((l) => l.startsWith("data: ")).map((l) => l.slice(6)).join("\n");
+          if (data) addEvent(JSON.parse(data));
+        }
+      }
+    } catch (e) {
+      if (abort.signal.aborted) return;
+      state.textContent = "斷線 " + e.message;
+    }
+    await new Promise((resolve) => setTimeout(resolve, 3000));
+  }
+}
+
+$("#token").value = token;
+$("#auth").onsubmit = (e) => {
+  e.preventDefault();
+  token = $("#token").value.trim();
+  localStorage.setItem("ha_token", token);
+  refresh();
+  streamEvents();
+};
+
+refresh();
+setInterval(refresh, REFRESH_MS);
+streamEvents();
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"kenmec/ha/jimmy/config"
+	"kenmec/ha/jimmy/internal"
+	"os"
+)
+
+const keepalivedUsage = `用法:
+  ha_arbiter keepalived render [--config 設定檔] [-o keepalived.conf]
+  ha_arbiter keepalived lint   [--config 設定檔] [--root /]`
+
+// ha_arbiter keepalived render|lint 回傳 exit code
+func runKeepalived(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, keepalivedUsage)
+		return 2
+	}
+
+	fs := flag.NewFlagSet("keepalived "+args[0], flag.ExitOnError)
+	configPath := fs.String("config", config.DefaultPath(), "設定檔路徑 (也可以用環境變數 HA_CONFIG)")
+	output := fs.String("o", "", "輸出的檔案 空白代表 stdout")
+	root := fs.String("root", "/", "檢查腳本是否存在時的根目錄")
+
+	switch args[0] {
+	case "render", "lint":
+	default:
+		fmt.Fprintln(os.Stderr, keepalivedUsage)
+		return 2
+	}
+	fs.Parse(args[1:])
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ 設定檔 %s 有錯誤:\n%v\n", *configPath, err)
+		return 1
+	}
+
+	// render 不檢查腳本檔案 產生的機器不一定是執行的機器
+	lintRoot := *root
+	if args[0] == "render" {
+		lintRoot = ""
+	}
+	issues := internal.LintKeepalived(cfg.KEEPALIVED, lintRoot)
+	failed := false
+	for _, issue := range issues {
+		fmt.Fprintln(os.Stderr, issue)
+		failed = failed || issue.Error
+	}
+
+	data, err := internal.RenderKeepalived(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ 產生 keepalived.conf 失敗: %v\n", err)
+		return 1
+	}
+	if failed {
+		return 1
+	}
+
+	if args[0] == "lint" {
+		if len(issues) == 0 {
+			fmt.Fprintln(os.Stderr, "✅ keepalived 設定沒有問題")
+		}
+		return 0
+	}
+
+	if *output == "" {
+		os.Stdout.Write(data)
+		return 0
+	}
+	if err := os.WriteFile(*output, data, 0o644); err != nil {
+		fmt.Fprintf(os.Stderr, "❌ 寫入 %s 失敗: %v\n", *output, err)
+		return 1
+	}
+	fmt.Fprintf(os.Stderr, "📄 已產生 %s\n", *output)
+	return 0
+}
@@ -1,33 +1,105 @@
 package main
 
 import (
+	"flag"
 	"kenmec/ha/jimmy/api"
 	"kenmec/ha/jimmy/config"
 	"kenmec/ha/jimmy/internal"
+	"log"
+	"os"
 )
 
 func main() {
-	//跟本主機的交管系統連線
-	grpcFleetClient := api.NewGRPCFleetClient("localhost:50051")
-	go grpcFleetClient.MaintainConnectionWithFleet()
-	go grpcFleetClient.StartHeartbeatToFleet()
-	go grpcFleetClient.LoggingConnectionStatus()
+	// 子指令
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "keepalived":
+			os.Exit(runKeepalived(os.Args[2:]))
+		case "install":
+			os.Exit(runInstall(os.Args[2:]))
+		case "explain":
+			os.Exit(runExplain(os.Args[2:]))
+		}
+	}
+
+	configPath := flag.String("config", config.DefaultPath(), "設定檔路徑 (也可以用環境變數 HA_CONFIG)")
+	flag.Parse()
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		config.LogFatalf("❌ 設定檔 %s 有錯誤:\n%v", *configPath, err)
+	}
+	config.Set(cfg)
+	internal.SetupLogging(cfg.LOG_LEVEL)
+	log.Printf("📄 載入設定檔 %s", *configPath)
+
+	haServerCreds, err := api.ServerCredentials(config.Current().HA_TLS)
+	if err != nil {
+		config.LogFatalf("❌ HA server TLS 設定錯誤: %v", err)
+	}
+	haClientCreds, err := api.ClientCredentials(config.Current().HA_TLS)
+	if err != nil {
+		config.LogFatalf("❌ HA client TLS 設定錯誤: %v", err)
+	}
+	fleetCreds, err := api.ClientCredentials(config.Current().FLEET_TLS)
+	if err != nil {
+		config.LogFatalf("❌ 交管 TLS 設定錯誤: %v", err)
+	}
+
+	//跟本主機的交管系統連線 每個交管一個連線
+	var fleets []internal.FleetEndpoint
+	for _, f := range config.Current().FLEETS {
+		grpcFleetClient := api.NewGRPCFleetClient(f.ADDRESS, fleetCreds)
+		go grpcFleetClient.MaintainConnectionWithFleet()
+		go grpcFleetClient.StartHeartbeatToFleet()
+		fleets = append(fleets, internal.FleetEndpoint{Name: f.NAME, Routes: f.ROUTES, Client: grpcFleetClient})
+	}
 
 	// 監聽到另外一台的 HA
-	haServer := api.NewHAToOtherServer()
-	go haServer.ListenServer(config.Cfg.SERVER_PORT)
+	admission, err := api.NewPeerAdmission(config.Current().PEER_NODE_ID, config.Current().PeerAllowedAddrs())
+	if err != nil {
+		config.LogFatalf("❌ PEER_NODE_ID / PEER_ALLOWED_ADDRS 設定錯誤: %v", err)
+	}
+	haServer := api.NewHAToOtherServer(api.HAServerOptions{
+		Creds:      haServerCreds,
+		Admission:  admission,
+		Reflection: config.Current().GRPC_REFLECTION,
+		Channelz:   config.Current().GRPC_CHANNELZ,
+	})
+	go haServer.ListenServer(config.Current().SERVER_PORT)
+
+	// 連線到另外一台的 HA 每條網路路徑一個連線
+	var haClients []*api.GRPCHAClient
+	for i, addr := range config.Current().PeerAddresses() {
+		haClient := api.NewGRPCClient(addr, i, config.Current().NODE_ID, haClientCreds)
+		go haClient.MaintainConnection()
+		haClients = append(haClients, haClient)
+	}
 
-	// 連線到另外一台的 HA
-	haClient := api.NewGRPCClient(config.Cfg.CLIENT_IP + ":" + config.Cfg.CLIENT_PORT)
-	go haClient.MaintainConnection()
-	go haClient.LoggingConnectionStatus()
+	// 跟 gRPC 分開的 UDP 心跳
+	var udpHb *api.UDPHeartbeatChannel
+	if config.Current().UDP_HB_PORT != "" {
+		cfg := config.Current()
+		udpHb = api.NewUDPHeartbeatChannel(cfg.UDP_HB_PORT, cfg.PeerIPs(), cfg.UDP_HB_KEY, cfg.NODE_ID, cfg.PEER_NODE_ID)
+	}
 
-	arbiter := internal.NewArbiter(grpcFleetClient, haClient, haServer)
+	arbiter := internal.NewArbiter(fleets, haClients, haServer, udpHb)
 	arbiter.CheckInitRole()
 	go arbiter.MsgHandler()
 	go arbiter.StartHeartbeatToOtherHA()
 	go arbiter.StartFleetHbMonitor()
 	go arbiter.StartOtherHaHbMonitor()
+	go arbiter.StartSyncArbiter()
+	go arbiter.StartConfigSync()
+	go arbiter.StartVipRoleSync()
+	go arbiter.StartNotifyFifo()
+	go arbiter.StartVipWatch()
+	go arbiter.StartUDPHeartbeat()
+	go arbiter.StartGrpcHealthUpdater()
+	go arbiter.StartFleetHealthProbe()
+	go arbiter.StartFleetProbe()
+	arbiter.StartDependencyProbes()
+	go arbiter.StartConfigReload(*configPath)
 
 	internal.StartRestWebApi(arbiter)
 }
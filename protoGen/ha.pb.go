@@ -733,6 +733,191 @@ func (x *SyncAllMemoryCargo) GetAreaType() string {
 	return ""
 }
 
+// 確認交管處理訊息的流程還活著
+// ha 送出 probe 交管必須經過自己的訊息處理流程 原封不動用 probe_echo 送回
+type Probe struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Token         string                 `protobuf:"bytes,1,opt,name=token,proto3" json:"token,omitempty"`
+	SentAtUnixMs  int64                  `protobuf:"varint,2,opt,name=sent_at_unix_ms,json=sentAtUnixMs,proto3" json:"sent_at_unix_ms,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Probe) Reset() {
+	*x = Probe{}
+	mi := &file_ha_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Probe) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Probe) ProtoMessage() {}
+
+func (x *Probe) ProtoReflect() protoreflect.Message {
+	mi := &file_ha_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Probe.ProtoReflect.Descriptor instead.
+func (*Probe) Descriptor() ([]byte, []int) {
+	return file_ha_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *Probe) GetToken() string {
+	if x != nil {
+		return x.Token
+	}
+	return ""
+}
+
+func (x *Probe) GetSentAtUnixMs() int64 {
+	if x != nil {
+		return x.SentAtUnixMs
+	}
+	return 0
+}
+
+// 一個 VRRP instance (VIP) 的角色
+type VipRole struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Instance      string                 `protobuf:"bytes,1,opt,name=instance,proto3" json:"instance,omitempty"`
+	Service       string                 `protobuf:"bytes,2,opt,name=service,proto3" json:"service,omitempty"`
+	Vip           string                 `protobuf:"bytes,3,opt,name=vip,proto3" json:"vip,omitempty"`
+	Master        bool                   `protobuf:"varint,4,opt,name=master,proto3" json:"master,omitempty"`                           // 本機持有這個 VIP
+	PeerMaster    bool                   `protobuf:"varint,5,opt,name=peer_master,json=peerMaster,proto3" json:"peer_master,omitempty"` // 另外一台持有這個 VIP (另外一台回報的)
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *VipRole) Reset() {
+	*x = VipRole{}
+	mi := &file_ha_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *VipRole) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*VipRole) ProtoMessage() {}
+
+func (x *VipRole) ProtoReflect() protoreflect.Message {
+	mi := &file_ha_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use VipRole.ProtoReflect.Descriptor instead.
+func (*VipRole) Descriptor() ([]byte, []int) {
+	return file_ha_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *VipRole) GetInstance() string {
+	if x != nil {
+		return x.Instance
+	}
+	return ""
+}
+
+func (x *VipRole) GetService() string {
+	if x != nil {
+		return x.Service
+	}
+	return ""
+}
+
+func (x *VipRole) GetVip() string {
+	if x != nil {
+		return x.Vip
+	}
+	return ""
+}
+
+func (x *VipRole) GetMaster() bool {
+	if x != nil {
+		return x.Master
+	}
+	return false
+}
+
+func (x *VipRole) GetPeerMaster() bool {
+	if x != nil {
+		return x.PeerMaster
+	}
+	return false
+}
+
+// 所有 VIP 的角色 角色變更時送出
+type VipRoles struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Roles []*VipRole             `protobuf:"bytes,1,rep,name=roles,proto3" json:"roles,omitempty"`
+	// VIP 分散在兩台 例如交管的 VIP 在本機 DB 的 VIP 在另外一台
+	Split         bool `protobuf:"varint,2,opt,name=split,proto3" json:"split,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *VipRoles) Reset() {
+	*x = VipRoles{}
+	mi := &file_ha_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *VipRoles) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*VipRoles) ProtoMessage() {}
+
+func (x *VipRoles) ProtoReflect() protoreflect.Message {
+	mi := &file_ha_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use VipRoles.ProtoReflect.Descriptor instead.
+func (*VipRoles) Descriptor() ([]byte, []int) {
+	return file_ha_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *VipRoles) GetRoles() []*VipRole {
+	if x != nil {
+		return x.Roles
+	}
+	return nil
+}
+
+func (x *VipRoles) GetSplit() bool {
+	if x != nil {
+		return x.Split
+	}
+	return false
+}
+
 // 從ha送過去給交管的資料
 type ClientMessage struct {
 	state protoimpl.MessageState `protogen:"open.v1"`
@@ -752,6 +937,8 @@ type ClientMessage struct {
 	//	*ClientMessage_SyncAllMission
 	//	*ClientMessage_SyncAllDbCargo
 	//	*ClientMessage_SyncAllMemoryCargo
+	//	*ClientMessage_Probe
+	//	*ClientMessage_VipRoles
 	Payload       isClientMessage_Payload `protobuf_oneof:"payload"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
@@ -759,7 +946,7 @@ type ClientMessage struct {
 
 func (x *ClientMessage) Reset() {
 	*x = ClientMessage{}
-	mi := &file_ha_proto_msgTypes[10]
+	mi := &file_ha_proto_msgTypes[13]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -771,7 +958,7 @@ func (x *ClientMessage) String() string {
 func (*ClientMessage) ProtoMessage() {}
 
 func (x *ClientMessage) ProtoReflect() protoreflect.Message {
-	mi := &file_ha_proto_msgTypes[10]
+	mi := &file_ha_proto_msgTypes[13]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -784,7 +971,7 @@ func (x *ClientMessage) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use ClientMessage.ProtoReflect.Descriptor instead.
 func (*ClientMessage) Descriptor() ([]byte, []int) {
-	return file_ha_proto_rawDescGZIP(), []int{10}
+	return file_ha_proto_rawDescGZIP(), []int{13}
 }
 
 func (x *ClientMessage) GetPayload() isClientMessage_Payload {
@@ -920,6 +1107,24 @@ func (x *ClientMessage) GetSyncAllMemoryCargo() *SyncAllMemoryCargo {
 	return nil
 }
 
+func (x *ClientMessage) GetProbe() *Probe {
+	if x != nil {
+		if x, ok := x.Payload.(*ClientMessage_Probe); ok {
+			return x.Probe
+		}
+	}
+	return nil
+}
+
+func (x *ClientMessage) GetVipRoles() *VipRoles {
+	if x != nil {
+		if x, ok := x.Payload.(*ClientMessage_VipRoles); ok {
+			return x.VipRoles
+		}
+	}
+	return nil
+}
+
 type isClientMessage_Payload interface {
 	isClientMessage_Payload()
 }
@@ -980,6 +1185,14 @@ type ClientMessage_SyncAllMemoryCargo struct {
 	SyncAllMemoryCargo *SyncAllMemoryCargo `protobuf:"bytes,14,opt,name=sync_all_memory_cargo,json=syncAllMemoryCargo,proto3,oneof"`
 }
 
+type ClientMessage_Probe struct {
+	Probe *Probe `protobuf:"bytes,15,opt,name=probe,proto3,oneof"`
+}
+
+type ClientMessage_VipRoles struct {
+	VipRoles *VipRoles `protobuf:"bytes,16,opt,name=vip_roles,json=vipRoles,proto3,oneof"`
+}
+
 func (*ClientMessage_Hb) isClientMessage_Payload() {}
 
 func (*ClientMessage_IsMaster) isClientMessage_Payload() {}
@@ -1008,6 +1221,10 @@ func (*ClientMessage_SyncAllDbCargo) isClientMessage_Payload() {}
 
 func (*ClientMessage_SyncAllMemoryCargo) isClientMessage_Payload() {}
 
+func (*ClientMessage_Probe) isClientMessage_Payload() {}
+
+func (*ClientMessage_VipRoles) isClientMessage_Payload() {}
+
 // 從交管送過來的資料
 type ServerMessage struct {
 	state protoimpl.MessageState `protogen:"open.v1"`
@@ -1027,6 +1244,7 @@ type ServerMessage struct {
 	//	*ServerMessage_SyncAllMission
 	//	*ServerMessage_SyncAllDbCargo
 	//	*ServerMessage_SyncAllMemoryCargo
+	//	*ServerMessage_ProbeEcho
 	Payload       isServerMessage_Payload `protobuf_oneof:"payload"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
@@ -1034,7 +1252,7 @@ type ServerMessage struct {
 
 func (x *ServerMessage) Reset() {
 	*x = ServerMessage{}
-	mi := &file_ha_proto_msgTypes[11]
+	mi := &file_ha_proto_msgTypes[14]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -1046,7 +1264,7 @@ func (x *ServerMessage) String() string {
 func (*ServerMessage) ProtoMessage() {}
 
 func (x *ServerMessage) ProtoReflect() protoreflect.Message {
-	mi := &file_ha_proto_msgTypes[11]
+	mi := &file_ha_proto_msgTypes[14]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -1059,7 +1277,7 @@ func (x *ServerMessage) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use ServerMessage.ProtoReflect.Descriptor instead.
 func (*ServerMessage) Descriptor() ([]byte, []int) {
-	return file_ha_proto_rawDescGZIP(), []int{11}
+	return file_ha_proto_rawDescGZIP(), []int{14}
 }
 
 func (x *ServerMessage) GetPayload() isServerMessage_Payload {
@@ -1195,6 +1413,15 @@ func (x *ServerMessage) GetSyncAllMemoryCargo() *SyncAllMemoryCargo {
 	return nil
 }
 
+func (x *ServerMessage) GetProbeEcho() *Probe {
+	if x != nil {
+		if x, ok := x.Payload.(*ServerMessage_ProbeEcho); ok {
+			return x.ProbeEcho
+		}
+	}
+	return nil
+}
+
 type isServerMessage_Payload interface {
 	isServerMessage_Payload()
 }
@@ -1256,6 +1483,10 @@ type ServerMessage_SyncAllMemoryCargo struct {
 	SyncAllMemoryCargo *SyncAllMemoryCargo `protobuf:"bytes,14,opt,name=sync_all_memory_cargo,json=syncAllMemoryCargo,proto3,oneof"`
 }
 
+type ServerMessage_ProbeEcho struct {
+	ProbeEcho *Probe `protobuf:"bytes,15,opt,name=probe_echo,json=probeEcho,proto3,oneof"`
+}
+
 func (*ServerMessage_Hb) isServerMessage_Payload() {}
 
 func (*ServerMessage_IsEcsConnected) isServerMessage_Payload() {}
@@ -1284,6 +1515,8 @@ func (*ServerMessage_SyncAllDbCargo) isServerMessage_Payload() {}
 
 func (*ServerMessage_SyncAllMemoryCargo) isServerMessage_Payload() {}
 
+func (*ServerMessage_ProbeEcho) isServerMessage_Payload() {}
+
 var File_ha_proto protoreflect.FileDescriptor
 
 const file_ha_proto_rawDesc = "" +
@@ -1354,7 +1587,20 @@ const file_ha_proto_rawDesc = "" +
 	"\x12SyncAllMemoryCargo\x12\x1d\n" +
 	"\n" +
 	"cargo_json\x18\x01 \x01(\tR\tcargoJson\x12\x1b\n" +
-	"\tarea_type\x18\x02 \x01(\tR\bareaType\"\xfb\x05\n" +
+	"\tarea_type\x18\x02 \x01(\tR\bareaType\"D\n" +
+	"\x05Probe\x12\x14\n" +
+	"\x05token\x18\x01 \x01(\tR\x05token\x12%\n" +
+	"\x0fsent_at_unix_ms\x18\x02 \x01(\x03R\fsentAtUnixMs\"\x8a\x01\n" +
+	"\aVipRole\x12\x1a\n" +
+	"\binstance\x18\x01 \x01(\tR\binstance\x12\x18\n" +
+	"\aservice\x18\x02 \x01(\tR\aservice\x12\x10\n" +
+	"\x03vip\x18\x03 \x01(\tR\x03vip\x12\x16\n" +
+	"\x06master\x18\x04 \x01(\bR\x06master\x12\x1f\n" +
+	"\vpeer_master\x18\x05 \x01(\bR\n" +
+	"peerMaster\"F\n" +
+	"\bVipRoles\x12$\n" +
+	"\x05roles\x18\x01 \x03(\v2\x0e.ha_pb.VipRoleR\x05roles\x12\x14\n" +
+	"\x05split\x18\x02 \x01(\bR\x05split\"\xd1\x06\n" +
 	"\rClientMessage\x12\x10\n" +
 	"\x02hb\x18\x01 \x01(\x05H\x00R\x02hb\x12\x1d\n" +
 	"\tis_master\x18\x02 \x01(\bH\x00R\bisMaster\x12#\n" +
@@ -1371,8 +1617,10 @@ const file_ha_proto_rawDesc = "" +
 	"\x10backup_connected\x18\v \x01(\tH\x00R\x0fbackupConnected\x12*\n" +
 	"\x10sync_all_mission\x18\f \x01(\tH\x00R\x0esyncAllMission\x12+\n" +
 	"\x11sync_all_db_cargo\x18\r \x01(\tH\x00R\x0esyncAllDbCargo\x12N\n" +
-	"\x15sync_all_memory_cargo\x18\x0e \x01(\v2\x19.ha_pb.SyncAllMemoryCargoH\x00R\x12syncAllMemoryCargoB\t\n" +
-	"\apayload\"\x8b\x06\n" +
+	"\x15sync_all_memory_cargo\x18\x0e \x01(\v2\x19.ha_pb.SyncAllMemoryCargoH\x00R\x12syncAllMemoryCargo\x12$\n" +
+	"\x05probe\x18\x0f \x01(\v2\f.ha_pb.ProbeH\x00R\x05probe\x12.\n" +
+	"\tvip_roles\x18\x10 \x01(\v2\x0f.ha_pb.VipRolesH\x00R\bvipRolesB\t\n" +
+	"\apayload\"\xba\x06\n" +
 	"\rServerMessage\x12\x10\n" +
 	"\x02hb\x18\x01 \x01(\x05H\x00R\x02hb\x12*\n" +
 	"\x10is_ecs_connected\x18\x02 \x01(\bH\x00R\x0eisEcsConnected\x12.\n" +
@@ -1389,7 +1637,9 @@ const file_ha_proto_rawDesc = "" +
 	"book_block\x18\v \x01(\tH\x00R\tbookBlock\x12*\n" +
 	"\x10sync_all_mission\x18\f \x01(\tH\x00R\x0esyncAllMission\x12+\n" +
 	"\x11sync_all_db_cargo\x18\r \x01(\tH\x00R\x0esyncAllDbCargo\x12N\n" +
-	"\x15sync_all_memory_cargo\x18\x0e \x01(\v2\x19.ha_pb.SyncAllMemoryCargoH\x00R\x12syncAllMemoryCargoB\t\n" +
+	"\x15sync_all_memory_cargo\x18\x0e \x01(\v2\x19.ha_pb.SyncAllMemoryCargoH\x00R\x12syncAllMemoryCargo\x12-\n" +
+	"\n" +
+	"probe_echo\x18\x0f \x01(\v2\f.ha_pb.ProbeH\x00R\tprobeEchoB\t\n" +
 	"\apayload2J\n" +
 	"\tHAService\x12=\n" +
 	"\vHAStreaming\x12\x14.ha_pb.ClientMessage\x1a\x14.ha_pb.ServerMessage(\x010\x01B\x18Z\x16kenmec/ha/protoGen;genb\x06proto3"
@@ -1406,7 +1656,7 @@ func file_ha_proto_rawDescGZIP() []byte {
 	return file_ha_proto_rawDescData
 }
 
-var file_ha_proto_msgTypes = make([]protoimpl.MessageInfo, 12)
+var file_ha_proto_msgTypes = make([]protoimpl.MessageInfo, 15)
 var file_ha_proto_goTypes = []any{
 	(*BookingInfo)(nil),        // 0: ha_pb.BookingInfo
 	(*AgvWorkStatus)(nil),      // 1: ha_pb.AgvWorkStatus
@@ -1418,33 +1668,40 @@ var file_ha_proto_goTypes = []any{
 	(*SaveCargoInfo)(nil),      // 7: ha_pb.SaveCargoInfo
 	(*UpdateAmrCargoInfo)(nil), // 8: ha_pb.UpdateAmrCargoInfo
 	(*SyncAllMemoryCargo)(nil), // 9: ha_pb.SyncAllMemoryCargo
-	(*ClientMessage)(nil),      // 10: ha_pb.ClientMessage
-	(*ServerMessage)(nil),      // 11: ha_pb.ServerMessage
+	(*Probe)(nil),              // 10: ha_pb.Probe
+	(*VipRole)(nil),            // 11: ha_pb.VipRole
+	(*VipRoles)(nil),           // 12: ha_pb.VipRoles
+	(*ClientMessage)(nil),      // 13: ha_pb.ClientMessage
+	(*ServerMessage)(nil),      // 14: ha_pb.ServerMessage
 }
 var file_ha_proto_depIdxs = []int32{
 	5,  // 0: ha_pb.UpdateCargoInfo.cargo:type_name -> ha_pb.UCICargo
 	5,  // 1: ha_pb.UpdateAmrCargoInfo.cargo:type_name -> ha_pb.UCICargo
-	1,  // 2: ha_pb.ClientMessage.agv_work_status:type_name -> ha_pb.AgvWorkStatus
-	2,  // 3: ha_pb.ClientMessage.mission_report:type_name -> ha_pb.MissionReport
-	6,  // 4: ha_pb.ClientMessage.update_cargo_info:type_name -> ha_pb.UpdateCargoInfo
-	7,  // 5: ha_pb.ClientMessage.save_cargo_info:type_name -> ha_pb.SaveCargoInfo
-	8,  // 6: ha_pb.ClientMessage.update_amr_cargo_info:type_name -> ha_pb.UpdateAmrCargoInfo
-	3,  // 7: ha_pb.ClientMessage.mission_assign:type_name -> ha_pb.MissionAssign
-	9,  // 8: ha_pb.ClientMessage.sync_all_memory_cargo:type_name -> ha_pb.SyncAllMemoryCargo
-	1,  // 9: ha_pb.ServerMessage.agv_work_status:type_name -> ha_pb.AgvWorkStatus
-	2,  // 10: ha_pb.ServerMessage.mission_report:type_name -> ha_pb.MissionReport
-	6,  // 11: ha_pb.ServerMessage.update_cargo_info:type_name -> ha_pb.UpdateCargoInfo
-	7,  // 12: ha_pb.ServerMessage.save_cargo_info:type_name -> ha_pb.SaveCargoInfo
-	8,  // 13: ha_pb.ServerMessage.update_amr_cargo_info:type_name -> ha_pb.UpdateAmrCargoInfo
-	3,  // 14: ha_pb.ServerMessage.mission_assign:type_name -> ha_pb.MissionAssign
-	9,  // 15: ha_pb.ServerMessage.sync_all_memory_cargo:type_name -> ha_pb.SyncAllMemoryCargo
-	10, // 16: ha_pb.HAService.HAStreaming:input_type -> ha_pb.ClientMessage
-	11, // 17: ha_pb.HAService.HAStreaming:output_type -> ha_pb.ServerMessage
-	17, // [17:18] is the sub-list for method output_type
-	16, // [16:17] is the sub-list for method input_type
-	16, // [16:16] is the sub-list for extension type_name
-	16, // [16:16] is the sub-list for extension extendee
-	0,  // [0:16] is the sub-list for field type_name
+	11, // 2: ha_pb.VipRoles.roles:type_name -> ha_pb.VipRole
+	1,  // 3: ha_pb.ClientMessage.agv_work_status:type_name -> ha_pb.AgvWorkStatus
+	2,  // 4: ha_pb.ClientMessage.mission_report:type_name -> ha_pb.MissionReport
+	6,  // 5: ha_pb.ClientMessage.update_cargo_info:type_name -> ha_pb.UpdateCargoInfo
+	7,  // 6: ha_pb.ClientMessage.save_cargo_info:type_name -> ha_pb.SaveCargoInfo
+	8,  // 7: ha_pb.ClientMessage.update_amr_cargo_info:type_name -> ha_pb.UpdateAmrCargoInfo
+	3,  // 8: ha_pb.ClientMessage.mission_assign:type_name -> ha_pb.MissionAssign
+	9,  // 9: ha_pb.ClientMessage.sync_all_memory_cargo:type_name -> ha_pb.SyncAllMemoryCargo
+	10, // 10: ha_pb.ClientMessage.probe:type_name -> ha_pb.Probe
+	12, // 11: ha_pb.ClientMessage.vip_roles:type_name -> ha_pb.VipRoles
+	1,  // 12: ha_pb.ServerMessage.agv_work_status:type_name -> ha_pb.AgvWorkStatus
+	2,  // 13: ha_pb.ServerMessage.mission_report:type_name -> ha_pb.MissionReport
+	6,  // 14: ha_pb.ServerMessage.update_cargo_info:type_name -> ha_pb.UpdateCargoInfo
+	7,  // 15: ha_pb.ServerMessage.save_cargo_info:type_name -> ha_pb.SaveCargoInfo
+	8,  // 16: ha_pb.ServerMessage.update_amr_cargo_info:type_name -> ha_pb.UpdateAmrCargoInfo
+	3,  // 17: ha_pb.ServerMessage.mission_assign:type_name -> ha_pb.MissionAssign
+	9,  // 18: ha_pb.ServerMessage.sync_all_memory_cargo:type_name -> ha_pb.SyncAllMemoryCargo
+	10, // 19: ha_pb.ServerMessage.probe_echo:type_name -> ha_pb.Probe
+	13, // 20: ha_pb.HAService.HAStreaming:input_type -> ha_pb.ClientMessage
+	14, // 21: ha_pb.HAService.HAStreaming:output_type -> ha_pb.ServerMessage
+	21, // [21:22] is the sub-list for method output_type
+	20, // [20:21] is the sub-list for method input_type
+	20, // [20:20] is the sub-list for extension type_name
+	20, // [20:20] is the sub-list for extension extendee
+	0,  // [0:20] is the sub-list for field type_name
 }
 
 func init() { file_ha_proto_init() }
@@ -1453,7 +1710,7 @@ func file_ha_proto_init() {
 		return
 	}
 	file_ha_proto_msgTypes[2].OneofWrappers = []any{}
-	file_ha_proto_msgTypes[10].OneofWrappers = []any{
+	file_ha_proto_msgTypes[13].OneofWrappers = []any{
 		(*ClientMessage_Hb)(nil),
 		(*ClientMessage_IsMaster)(nil),
 		(*ClientMessage_SyncMission)(nil),
@@ -1468,8 +1725,10 @@ func file_ha_proto_init() {
 		(*ClientMessage_SyncAllMission)(nil),
 		(*ClientMessage_SyncAllDbCargo)(nil),
 		(*ClientMessage_SyncAllMemoryCargo)(nil),
+		(*ClientMessage_Probe)(nil),
+		(*ClientMessage_VipRoles)(nil),
 	}
-	file_ha_proto_msgTypes[11].OneofWrappers = []any{
+	file_ha_proto_msgTypes[14].OneofWrappers = []any{
 		(*ServerMessage_Hb)(nil),
 		(*ServerMessage_IsEcsConnected)(nil),
 		(*ServerMessage_IsFleetConnected)(nil),
@@ -1484,6 +1743,7 @@ func file_ha_proto_init() {
 		(*ServerMessage_SyncAllMission)(nil),
 		(*ServerMessage_SyncAllDbCargo)(nil),
 		(*ServerMessage_SyncAllMemoryCargo)(nil),
+		(*ServerMessage_ProbeEcho)(nil),
 	}
 	type x struct{}
 	out := protoimpl.TypeBuilder{
@@ -1491,7 +1751,7 @@ func file_ha_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_ha_proto_rawDesc), len(file_ha_proto_rawDesc)),
 			NumEnums:      0,
-			NumMessages:   12,
+			NumMessages:   15,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
@@ -26,6 +26,7 @@ type PeerArbiter struct {
 	Ecs           bool                   `protobuf:"varint,1,opt,name=ecs,proto3" json:"ecs,omitempty"`
 	Fleet         bool                   `protobuf:"varint,2,opt,name=fleet,proto3" json:"fleet,omitempty"`
 	Ha            bool                   `protobuf:"varint,3,opt,name=ha,proto3" json:"ha,omitempty"`
+	Deps          bool                   `protobuf:"varint,4,opt,name=deps,proto3" json:"deps,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -81,6 +82,13 @@ func (x *PeerArbiter) GetHa() bool {
 	return false
 }
 
+func (x *PeerArbiter) GetDeps() bool {
+	if x != nil {
+		return x.Deps
+	}
+	return false
+}
+
 // 從此ha送給另外一台ha的資料 不可接收資料 （client）
 type StatusRequest struct {
 	state protoimpl.MessageState `protogen:"open.v1"`
@@ -102,7 +110,11 @@ type StatusRequest struct {
 	//	*StatusRequest_SyncAllMission
 	//	*StatusRequest_SyncAllDbCargo
 	//	*StatusRequest_SyncAllMemoryCargo
-	Payload       isStatusRequest_Payload `protobuf_oneof:"payload"`
+	//	*StatusRequest_PeerConfig
+	//	*StatusRequest_VipRoles
+	Payload isStatusRequest_Payload `protobuf_oneof:"payload"`
+	// 送出的時間 (unix nano) 另外一台用來計算資料同步的延遲 舊版不會帶
+	SentAt        int64 `protobuf:"varint,19,opt,name=sent_at,json=sentAt,proto3" json:"sent_at,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -288,6 +300,31 @@ func (x *StatusRequest) GetSyncAllMemoryCargo() *SyncAllMemoryCargo {
 	return nil
 }
 
+func (x *StatusRequest) GetPeerConfig() string {
+	if x != nil {
+		if x, ok := x.Payload.(*StatusRequest_PeerConfig); ok {
+			return x.PeerConfig
+		}
+	}
+	return ""
+}
+
+func (x *StatusRequest) GetVipRoles() *VipRoles {
+	if x != nil {
+		if x, ok := x.Payload.(*StatusRequest_VipRoles); ok {
+			return x.VipRoles
+		}
+	}
+	return nil
+}
+
+func (x *StatusRequest) GetSentAt() int64 {
+	if x != nil {
+		return x.SentAt
+	}
+	return 0
+}
+
 type isStatusRequest_Payload interface {
 	isStatusRequest_Payload()
 }
@@ -356,6 +393,16 @@ type StatusRequest_SyncAllMemoryCargo struct {
 	SyncAllMemoryCargo *SyncAllMemoryCargo `protobuf:"bytes,16,opt,name=sync_all_memory_cargo,json=syncAllMemoryCargo,proto3,oneof"`
 }
 
+type StatusRequest_PeerConfig struct {
+	// 本機生效中的設定 (JSON, 敏感欄位已遮蔽) 用來比對兩台設定是否一致
+	PeerConfig string `protobuf:"bytes,17,opt,name=peer_config,json=peerConfig,proto3,oneof"`
+}
+
+type StatusRequest_VipRoles struct {
+	// 本機每個 VIP 的角色 (peer_master 不使用)
+	VipRoles *VipRoles `protobuf:"bytes,18,opt,name=vip_roles,json=vipRoles,proto3,oneof"`
+}
+
 func (*StatusRequest_Hb) isStatusRequest_Payload() {}
 
 func (*StatusRequest_IsHaConnected) isStatusRequest_Payload() {}
@@ -388,6 +435,10 @@ func (*StatusRequest_SyncAllDbCargo) isStatusRequest_Payload() {}
 
 func (*StatusRequest_SyncAllMemoryCargo) isStatusRequest_Payload() {}
 
+func (*StatusRequest_PeerConfig) isStatusRequest_Payload() {}
+
+func (*StatusRequest_VipRoles) isStatusRequest_Payload() {}
+
 // 另外一台ha送來這台ha的資料 原則上不從此發送訊息到另外的ha (server)
 type StatusResponse struct {
 	state protoimpl.MessageState `protogen:"open.v1"`
@@ -409,6 +460,8 @@ type StatusResponse struct {
 	//	*StatusResponse_SyncAllMission
 	//	*StatusResponse_SyncAllDbCargo
 	//	*StatusResponse_SyncAllMemoryCargo
+	//	*StatusResponse_PeerConfig
+	//	*StatusResponse_VipRoles
 	Payload       isStatusResponse_Payload `protobuf_oneof:"payload"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
@@ -595,6 +648,24 @@ func (x *StatusResponse) GetSyncAllMemoryCargo() *SyncAllMemoryCargo {
 	return nil
 }
 
+func (x *StatusResponse) GetPeerConfig() string {
+	if x != nil {
+		if x, ok := x.Payload.(*StatusResponse_PeerConfig); ok {
+			return x.PeerConfig
+		}
+	}
+	return ""
+}
+
+func (x *StatusResponse) GetVipRoles() *VipRoles {
+	if x != nil {
+		if x, ok := x.Payload.(*StatusResponse_VipRoles); ok {
+			return x.VipRoles
+		}
+	}
+	return nil
+}
+
 type isStatusResponse_Payload interface {
 	isStatusResponse_Payload()
 }
@@ -663,6 +734,16 @@ type StatusResponse_SyncAllMemoryCargo struct {
 	SyncAllMemoryCargo *SyncAllMemoryCargo `protobuf:"bytes,16,opt,name=sync_all_memory_cargo,json=syncAllMemoryCargo,proto3,oneof"`
 }
 
+type StatusResponse_PeerConfig struct {
+	// 本機生效中的設定 (JSON, 敏感欄位已遮蔽) 用來比對兩台設定是否一致
+	PeerConfig string `protobuf:"bytes,17,opt,name=peer_config,json=peerConfig,proto3,oneof"`
+}
+
+type StatusResponse_VipRoles struct {
+	// 本機每個 VIP 的角色 (peer_master 不使用)
+	VipRoles *VipRoles `protobuf:"bytes,18,opt,name=vip_roles,json=vipRoles,proto3,oneof"`
+}
+
 func (*StatusResponse_Hb) isStatusResponse_Payload() {}
 
 func (*StatusResponse_IsHaConnected) isStatusResponse_Payload() {}
@@ -695,16 +776,21 @@ func (*StatusResponse_SyncAllDbCargo) isStatusResponse_Payload() {}
 
 func (*StatusResponse_SyncAllMemoryCargo) isStatusResponse_Payload() {}
 
+func (*StatusResponse_PeerConfig) isStatusResponse_Payload() {}
+
+func (*StatusResponse_VipRoles) isStatusResponse_Payload() {}
+
 var File_server_proto protoreflect.FileDescriptor
 
 const file_server_proto_rawDesc = "" +
 	"\n" +
 	"\fserver.proto\x12\n" +
-	"ha_sync_pb\x1a\bha.proto\"E\n" +
+	"ha_sync_pb\x1a\bha.proto\"Y\n" +
 	"\vPeerArbiter\x12\x10\n" +
 	"\x03ecs\x18\x01 \x01(\bR\x03ecs\x12\x14\n" +
 	"\x05fleet\x18\x02 \x01(\bR\x05fleet\x12\x0e\n" +
-	"\x02ha\x18\x03 \x01(\bR\x02ha\"\xf3\x06\n" +
+	"\x02ha\x18\x03 \x01(\bR\x02ha\x12\x12\n" +
+	"\x04deps\x18\x04 \x01(\bR\x04deps\"\xdf\a\n" +
 	"\rStatusRequest\x12\x10\n" +
 	"\x02hb\x18\x01 \x01(\x05H\x00R\x02hb\x12(\n" +
 	"\x0fis_ha_connected\x18\x02 \x01(\bH\x00R\risHaConnected\x12.\n" +
@@ -723,8 +809,12 @@ const file_server_proto_rawDesc = "" +
 	"book_block\x18\r \x01(\tH\x00R\tbookBlock\x12*\n" +
 	"\x10sync_all_mission\x18\x0e \x01(\tH\x00R\x0esyncAllMission\x12+\n" +
 	"\x11sync_all_db_cargo\x18\x0f \x01(\tH\x00R\x0esyncAllDbCargo\x12N\n" +
-	"\x15sync_all_memory_cargo\x18\x10 \x01(\v2\x19.ha_pb.SyncAllMemoryCargoH\x00R\x12syncAllMemoryCargoB\t\n" +
-	"\apayload\"\xf4\x06\n" +
+	"\x15sync_all_memory_cargo\x18\x10 \x01(\v2\x19.ha_pb.SyncAllMemoryCargoH\x00R\x12syncAllMemoryCargo\x12!\n" +
+	"\vpeer_config\x18\x11 \x01(\tH\x00R\n" +
+	"peerConfig\x12.\n" +
+	"\tvip_roles\x18\x12 \x01(\v2\x0f.ha_pb.VipRolesH\x00R\bvipRoles\x12\x17\n" +
+	"\asent_at\x18\x13 \x01(\x03R\x06sentAtB\t\n" +
+	"\apayload\"\xc7\a\n" +
 	"\x0eStatusResponse\x12\x10\n" +
 	"\x02hb\x18\x01 \x01(\x05H\x00R\x02hb\x12(\n" +
 	"\x0fis_ha_connected\x18\x02 \x01(\bH\x00R\risHaConnected\x12.\n" +
@@ -743,7 +833,10 @@ const file_server_proto_rawDesc = "" +
 	"book_block\x18\r \x01(\tH\x00R\tbookBlock\x12*\n" +
 	"\x10sync_all_mission\x18\x0e \x01(\tH\x00R\x0esyncAllMission\x12+\n" +
 	"\x11sync_all_db_cargo\x18\x0f \x01(\tH\x00R\x0esyncAllDbCargo\x12N\n" +
-	"\x15sync_all_memory_cargo\x18\x10 \x01(\v2\x19.ha_pb.SyncAllMemoryCargoH\x00R\x12syncAllMemoryCargoB\t\n" +
+	"\x15sync_all_memory_cargo\x18\x10 \x01(\v2\x19.ha_pb.SyncAllMemoryCargoH\x00R\x12syncAllMemoryCargo\x12!\n" +
+	"\vpeer_config\x18\x11 \x01(\tH\x00R\n" +
+	"peerConfig\x12.\n" +
+	"\tvip_roles\x18\x12 \x01(\v2\x0f.ha_pb.VipRolesH\x00R\bvipRolesB\t\n" +
 	"\apayload2\\\n" +
 	"\rHASyncService\x12K\n" +
 	"\x0eExchangeStatus\x12\x19.ha_sync_pb.StatusRequest\x1a\x1a.ha_sync_pb.StatusResponse(\x010\x01B\x18Z\x16kenmec/ha/protoGen;genb\x06proto3"
@@ -772,6 +865,7 @@ var file_server_proto_goTypes = []any{
 	(*UpdateAmrCargoInfo)(nil), // 7: ha_pb.UpdateAmrCargoInfo
 	(*MissionAssign)(nil),      // 8: ha_pb.MissionAssign
 	(*SyncAllMemoryCargo)(nil), // 9: ha_pb.SyncAllMemoryCargo
+	(*VipRoles)(nil),           // 10: ha_pb.VipRoles
 }
 var file_server_proto_depIdxs = []int32{
 	0,  // 0: ha_sync_pb.StatusRequest.peer_arbiter:type_name -> ha_sync_pb.PeerArbiter
@@ -782,21 +876,23 @@ var file_server_proto_depIdxs = []int32{
 	7,  // 5: ha_sync_pb.StatusRequest.update_amr_cargo_info:type_name -> ha_pb.UpdateAmrCargoInfo
 	8,  // 6: ha_sync_pb.StatusRequest.mission_assign:type_name -> ha_pb.MissionAssign
 	9,  // 7: ha_sync_pb.StatusRequest.sync_all_memory_cargo:type_name -> ha_pb.SyncAllMemoryCargo
-	0,  // 8: ha_sync_pb.StatusResponse.peer_arbiter:type_name -> ha_sync_pb.PeerArbiter
-	3,  // 9: ha_sync_pb.StatusResponse.agv_work_status:type_name -> ha_pb.AgvWorkStatus
-	4,  // 10: ha_sync_pb.StatusResponse.mission_report:type_name -> ha_pb.MissionReport
-	5,  // 11: ha_sync_pb.StatusResponse.update_cargo_info:type_name -> ha_pb.UpdateCargoInfo
-	6,  // 12: ha_sync_pb.StatusResponse.save_cargo_info:type_name -> ha_pb.SaveCargoInfo
-	7,  // 13: ha_sync_pb.StatusResponse.update_amr_cargo_info:type_name -> ha_pb.UpdateAmrCargoInfo
-	8,  // 14: ha_sync_pb.StatusResponse.mission_assign:type_name -> ha_pb.MissionAssign
-	9,  // 15: ha_sync_pb.StatusResponse.sync_all_memory_cargo:type_name -> ha_pb.SyncAllMemoryCargo
-	1,  // 16: ha_sync_pb.HASyncService.ExchangeStatus:input_type -> ha_sync_pb.StatusRequest
-	2,  // 17: ha_sync_pb.HASyncService.ExchangeStatus:output_type -> ha_sync_pb.StatusResponse
-	17, // [17:18] is the sub-list for method output_type
-	16, // [16:17] is the sub-list for method input_type
-	16, // [16:16] is the sub-list for extension type_name
-	16, // [16:16] is the sub-list for extension extendee
-	0,  // [0:16] is the sub-list for field type_name
+	10, // 8: ha_sync_pb.StatusRequest.vip_roles:type_name -> ha_pb.VipRoles
+	0,  // 9: ha_sync_pb.StatusResponse.peer_arbiter:type_name -> ha_sync_pb.PeerArbiter
+	3,  // 10: ha_sync_pb.StatusResponse.agv_work_status:type_name -> ha_pb.AgvWorkStatus
+	4,  // 11: ha_sync_pb.StatusResponse.mission_report:type_name -> ha_pb.MissionReport
+	5,  // 12: ha_sync_pb.StatusResponse.update_cargo_info:type_name -> ha_pb.UpdateCargoInfo
+	6,  // 13: ha_sync_pb.StatusResponse.save_cargo_info:type_name -> ha_pb.SaveCargoInfo
+	7,  // 14: ha_sync_pb.StatusResponse.update_amr_cargo_info:type_name -> ha_pb.UpdateAmrCargoInfo
+	8,  // 15: ha_sync_pb.StatusResponse.mission_assign:type_name -> ha_pb.MissionAssign
+	9,  // 16: ha_sync_pb.StatusResponse.sync_all_memory_cargo:type_name -> ha_pb.SyncAllMemoryCargo
+	10, // 17: ha_sync_pb.StatusResponse.vip_roles:type_name -> ha_pb.VipRoles
+	1,  // 18: ha_sync_pb.HASyncService.ExchangeStatus:input_type -> ha_sync_pb.StatusRequest
+	2,  // 19: ha_sync_pb.HASyncService.ExchangeStatus:output_type -> ha_sync_pb.StatusResponse
+	19, // [19:20] is the sub-list for method output_type
+	18, // [18:19] is the sub-list for method input_type
+	18, // [18:18] is the sub-list for extension type_name
+	18, // [18:18] is the sub-list for extension extendee
+	0,  // [0:18] is the sub-list for field type_name
 }
 
 func init() { file_server_proto_init() }
@@ -822,6 +918,8 @@ func file_server_proto_init() {
 		(*StatusRequest_SyncAllMission)(nil),
 		(*StatusRequest_SyncAllDbCargo)(nil),
 		(*StatusRequest_SyncAllMemoryCargo)(nil),
+		(*StatusRequest_PeerConfig)(nil),
+		(*StatusRequest_VipRoles)(nil),
 	}
 	file_server_proto_msgTypes[2].OneofWrappers = []any{
 		(*StatusResponse_Hb)(nil),
@@ -840,6 +938,8 @@ func file_server_proto_init() {
 		(*StatusResponse_SyncAllMission)(nil),
 		(*StatusResponse_SyncAllDbCargo)(nil),
 		(*StatusResponse_SyncAllMemoryCargo)(nil),
+		(*StatusResponse_PeerConfig)(nil),
+		(*StatusResponse_VipRoles)(nil),
 	}
 	type x struct{}
 	out := protoimpl.TypeBuilder{